@@ -1,20 +1,34 @@
 package main
 
 import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
 	"log"
 	"net/http"
 	"os"
+	"time"
 
 	"github.com/jehaj/new-year-wrapped/internal/db"
 	"github.com/jehaj/new-year-wrapped/internal/party"
 )
 
+const dbPath = "data/wrapped.db"
+
 func main() {
 	// Ensure data directory exists
 	if err := os.MkdirAll("data", 0755); err != nil {
 		log.Fatalf("failed to create data directory: %v", err)
 	}
 
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		if err := runMigrate(os.Args[2:]); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
 	// Setup logging to file
 	logFile, err := os.OpenFile("data/party.log", os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
 	if err != nil {
@@ -24,43 +38,34 @@ func main() {
 
 	partyLogger := log.New(logFile, "PARTY: ", log.LstdFlags)
 
-	database, err := db.Init("data/wrapped.db")
+	database, err := db.Init(dbPath)
 	if err != nil {
 		log.Fatalf("failed to init db: %v", err)
 	}
 	defer database.Close()
 
 	partyService := party.NewService(database, partyLogger)
+	musicProvider, err := newMusicProvider(os.Getenv("MUSIC_PROVIDER"))
+	if err != nil {
+		log.Fatal(err)
+	}
+	partyService.SetMusicProvider(party.NewCachedMusicProvider(musicProvider, 1000, 10*time.Minute))
+	go partyService.RunScheduler(context.Background(), time.Second)
 	partyHandler := party.NewHandler(partyService)
 
+	sessionKey, err := loadSessionKey("data/session.key")
+	if err != nil {
+		log.Fatalf("failed to load session key: %v", err)
+	}
+	partyHandler.SetSessionKey(sessionKey)
+
 	mux := http.NewServeMux()
 
-	// API Routes
-	mux.HandleFunc("POST /parties", partyHandler.CreateParty)
-	mux.HandleFunc("POST /parties/{id}/join", partyHandler.JoinParty)
-	mux.HandleFunc("GET /parties/{id}/users", partyHandler.GetUsers)
-	mux.HandleFunc("POST /parties/{id}/start", partyHandler.StartCompetition)
-	mux.HandleFunc("POST /parties/{id}/next", partyHandler.NextRound)
-	mux.HandleFunc("GET /parties/{id}/round", partyHandler.GetCurrentRound)
-	mux.HandleFunc("GET /parties/{id}/results", partyHandler.GetRoundResults)
-	mux.HandleFunc("POST /parties/{id}/guess", partyHandler.SubmitGuess)
-	mux.HandleFunc("GET /parties/{id}/leaderboard", partyHandler.GetLeaderboard)
-	mux.HandleFunc("GET /api/search", partyHandler.SearchSongs)
-
-	// UI Routes
-	mux.HandleFunc("GET /", partyHandler.IndexPage)
-	mux.HandleFunc("GET /parties", partyHandler.UIPartyRedirect)
-	mux.HandleFunc("GET /parties/{id}", partyHandler.PartyPage)
-	mux.HandleFunc("GET /parties/{id}/game", partyHandler.GamePage)
-	mux.HandleFunc("GET /parties/{id}/song_list", partyHandler.SongListPage)
-	mux.HandleFunc("GET /parties/{id}/qrcode", partyHandler.QRCode)
-
-	// UI Action Routes
-	mux.HandleFunc("POST /ui/parties/create", partyHandler.UICreateParty)
-	mux.HandleFunc("POST /ui/parties/{id}/join", partyHandler.UIJoinParty)
-	mux.HandleFunc("POST /ui/parties/{id}/start", partyHandler.UIStartCompetition)
-	mux.HandleFunc("POST /ui/parties/{id}/next", partyHandler.UINextRound)
-	mux.HandleFunc("POST /ui/parties/{id}/guess", partyHandler.UIGuess)
+	searchLimiter := party.NewRateLimiter(3, 15)
+	searchLimiter.TrustForwardedFor = os.Getenv("TRUST_PROXY") != ""
+	for _, route := range partyHandler.Routes(searchLimiter) {
+		mux.HandleFunc(route.Pattern, route.Handler)
+	}
 
 	// Static Files
 	fs := http.FileServer(http.Dir("static"))
@@ -72,3 +77,88 @@ func main() {
 		log.Fatal(err)
 	}
 }
+
+// loadSessionKey returns the key used to sign player session cookies. It is
+// taken from SESSION_KEY if set, otherwise read from path and created there on
+// first start so sessions survive restarts.
+func loadSessionKey(path string) ([]byte, error) {
+	if key := os.Getenv("SESSION_KEY"); key != "" {
+		return []byte(key), nil
+	}
+
+	if data, err := os.ReadFile(path); err == nil {
+		return hex.DecodeString(string(data))
+	} else if !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(path, []byte(hex.EncodeToString(key)), 0600); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// runMigrate implements the "migrate" subcommand, which reports or applies
+// schema migrations without starting the server.
+func runMigrate(args []string) error {
+	if len(args) != 1 || (args[0] != "status" && args[0] != "up") {
+		return fmt.Errorf("usage: %s migrate status|up", os.Args[0])
+	}
+
+	database, err := db.Open(dbPath)
+	if err != nil {
+		return err
+	}
+	defer database.Close()
+
+	if args[0] == "up" {
+		applied, err := db.Migrate(database)
+		for _, m := range applied {
+			fmt.Printf("applied %d: %s\n", m.Version, m.Name)
+		}
+		if err != nil {
+			return err
+		}
+		if len(applied) == 0 {
+			fmt.Println("no pending migrations")
+		}
+		return nil
+	}
+
+	statuses, err := db.Status(database)
+	if err != nil {
+		return err
+	}
+	for _, st := range statuses {
+		state := "pending"
+		if st.Applied {
+			state = "applied " + st.AppliedAt.Format("2006-01-02 15:04:05")
+		}
+		fmt.Printf("%3d  %-40s %s\n", st.Version, st.Name, state)
+	}
+	return nil
+}
+
+// newMusicProvider returns the music catalog named by MUSIC_PROVIDER. YouTube
+// Music is searched in MUSIC_LANGUAGE and MUSIC_REGION, Danish by default.
+func newMusicProvider(name string) (party.MusicProvider, error) {
+	switch name {
+	case "", "youtube":
+		language, region := os.Getenv("MUSIC_LANGUAGE"), os.Getenv("MUSIC_REGION")
+		if language == "" {
+			language = "da"
+		}
+		if region == "" {
+			region = "DK"
+		}
+		return party.NewYouTubeMusic(language, region), nil
+	case "fake":
+		return party.DefaultFakeCatalog(), nil
+	default:
+		return nil, fmt.Errorf("unknown MUSIC_PROVIDER %q, use youtube or fake", name)
+	}
+}
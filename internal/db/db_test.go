@@ -0,0 +1,93 @@
+package db_test
+
+import (
+	"database/sql"
+	"testing"
+
+	"github.com/jehaj/new-year-wrapped/internal/db"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func TestMigrate(t *testing.T) {
+	t.Run("Fresh database", func(t *testing.T) {
+		// Given: An empty database
+		// When: Migrate is run twice
+		// Then: All migrations are applied once and reported as applied
+		database, _ := sql.Open("sqlite3", ":memory:")
+		defer database.Close()
+
+		applied, err := db.Migrate(database)
+		if err != nil {
+			t.Fatalf("Migrate failed: %v", err)
+		}
+		if len(applied) != len(db.Migrations) {
+			t.Errorf("expected %d migrations applied, got %d", len(db.Migrations), len(applied))
+		}
+
+		applied, err = db.Migrate(database)
+		if err != nil {
+			t.Fatalf("second Migrate failed: %v", err)
+		}
+		if len(applied) != 0 {
+			t.Errorf("expected no migrations on second run, got %d", len(applied))
+		}
+
+		statuses, err := db.Status(database)
+		if err != nil {
+			t.Fatalf("Status failed: %v", err)
+		}
+		for _, st := range statuses {
+			if !st.Applied {
+				t.Errorf("expected migration %d to be applied", st.Version)
+			}
+		}
+	})
+
+	t.Run("Database from before migrations", func(t *testing.T) {
+		// Given: A database with the original schema, lacking later columns
+		// When: Migrate is run
+		// Then: The missing columns are added and existing rows are kept
+		database, _ := sql.Open("sqlite3", ":memory:")
+		defer database.Close()
+
+		_, err := database.Exec(`
+			CREATE TABLE parties (id TEXT PRIMARY KEY, name TEXT NOT NULL, admin_token TEXT NOT NULL, started BOOLEAN DEFAULT FALSE, current_round INTEGER DEFAULT 0, show_results BOOLEAN DEFAULT FALSE, songs_per_round INTEGER DEFAULT 5);
+			CREATE TABLE users (id INTEGER PRIMARY KEY AUTOINCREMENT, party_id TEXT NOT NULL, name TEXT NOT NULL, UNIQUE(party_id, name));
+			CREATE TABLE songs (id INTEGER PRIMARY KEY AUTOINCREMENT, user_id INTEGER NOT NULL, title TEXT NOT NULL, shuffle_index INTEGER DEFAULT -1);
+			INSERT INTO parties (id, name, admin_token) VALUES ('old', 'Old Party', 'token');
+			INSERT INTO users (party_id, name) VALUES ('old', 'Alice');
+			INSERT INTO songs (user_id, title) VALUES (1, 'Old Song');`)
+		if err != nil {
+			t.Fatalf("failed to create old schema: %v", err)
+		}
+
+		if _, err := db.Migrate(database); err != nil {
+			t.Fatalf("Migrate failed: %v", err)
+		}
+
+		var title, youtubeID string
+		err = database.QueryRow("SELECT title, youtube_id FROM songs WHERE id = 1").Scan(&title, &youtubeID)
+		if err != nil {
+			t.Fatalf("failed to query migrated song: %v", err)
+		}
+		if title != "Old Song" || youtubeID != "" {
+			t.Errorf("unexpected migrated song: title=%q youtube_id=%q", title, youtubeID)
+		}
+
+		var songsPerPlayer int
+		err = database.QueryRow("SELECT songs_per_player FROM parties WHERE id = 'old'").Scan(&songsPerPlayer)
+		if err != nil {
+			t.Fatalf("failed to query migrated party: %v", err)
+		}
+		if songsPerPlayer != 3 {
+			t.Errorf("expected default songs_per_player 3, got %d", songsPerPlayer)
+		}
+
+		var adminToken string
+		database.QueryRow("SELECT admin_token FROM parties WHERE id = 'old'").Scan(&adminToken)
+		// SHA-256 of "token"
+		if adminToken != "3c469e9d6c5875d37a43f353d4f88e61fcf812c66eee3457465a40b0da4153e0" {
+			t.Errorf("expected admin token to be hashed, got %q", adminToken)
+		}
+	})
+}
@@ -0,0 +1,290 @@
+package db
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"time"
+)
+
+// Migration is one step in the evolution of the schema. Migrations are applied
+// in order of Version, each in its own transaction, and must never be edited
+// once released; add a new one instead.
+type Migration struct {
+	Version int
+	Name    string
+	Up      func(tx *sql.Tx) error
+}
+
+// MigrationStatus tells whether a migration has been applied to a database.
+type MigrationStatus struct {
+	Migration
+	Applied   bool
+	AppliedAt time.Time
+}
+
+// Migrations lists every migration in the order they are applied.
+var Migrations = []Migration{
+	{1, "initial schema", execSQL(initialSchema)},
+	{2, "song youtube and thumbnail columns", addColumns("songs",
+		"youtube_id TEXT NOT NULL DEFAULT ''",
+		"thumbnail_url TEXT NOT NULL DEFAULT ''",
+	)},
+	{3, "player sessions", addColumns("users",
+		"session_hash TEXT NOT NULL DEFAULT ''",
+	)},
+	{4, "songs per player", addColumns("parties",
+		"songs_per_player INTEGER NOT NULL DEFAULT 3",
+	)},
+	{5, "party settings", addColumns("parties",
+		"scoring_mode TEXT NOT NULL DEFAULT 'standard'",
+		"round_time_limit INTEGER NOT NULL DEFAULT 0",
+		"allow_late_join BOOLEAN NOT NULL DEFAULT FALSE",
+	)},
+	{6, "hash admin tokens", hashAdminTokens},
+	{7, "round deadlines", addColumns("parties",
+		"round_deadline INTEGER NOT NULL DEFAULT 0",
+	)},
+	{8, "guess timestamps", addColumns("guesses",
+		"created_at INTEGER NOT NULL DEFAULT 0",
+	)},
+	{9, "round opening times", execSQL(`
+CREATE TABLE IF NOT EXISTS rounds (
+	party_id TEXT NOT NULL,
+	number INTEGER NOT NULL,
+	opened_at INTEGER NOT NULL,
+	FOREIGN KEY (party_id) REFERENCES parties(id),
+	PRIMARY KEY (party_id, number)
+);
+`)},
+	{10, "song keys", addColumns("songs",
+		"song_key TEXT NOT NULL DEFAULT ''",
+	)},
+	{11, "teams", execSQL(`
+CREATE TABLE IF NOT EXISTS teams (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	party_id TEXT NOT NULL,
+	name TEXT NOT NULL,
+	FOREIGN KEY (party_id) REFERENCES parties(id),
+	UNIQUE(party_id, name)
+);
+`)},
+	{12, "team members", addColumns("users",
+		"team_id INTEGER NOT NULL DEFAULT 0",
+	)},
+	{13, "team settings", addColumns("parties",
+		"team_mode BOOLEAN NOT NULL DEFAULT FALSE",
+		"team_guess_policy TEXT NOT NULL DEFAULT 'first'",
+	)},
+	{14, "guess wagers", addColumns("guesses",
+		"wager INTEGER NOT NULL DEFAULT 1",
+	)},
+	{15, "wager budget", addColumns("parties",
+		"wager_budget INTEGER NOT NULL DEFAULT 10",
+	)},
+	{16, "party language", addColumns("parties",
+		"language TEXT NOT NULL DEFAULT ''",
+	)},
+	{17, "guess changes", addColumns("parties",
+		"allow_guess_changes BOOLEAN NOT NULL DEFAULT FALSE",
+	)},
+}
+
+// initialSchema is the schema from before migrations were tracked. It uses
+// IF NOT EXISTS so databases created back then are adopted as they are.
+const initialSchema = `
+CREATE TABLE IF NOT EXISTS parties (
+	id TEXT PRIMARY KEY,
+	name TEXT NOT NULL,
+	admin_token TEXT NOT NULL,
+	started BOOLEAN DEFAULT FALSE,
+	current_round INTEGER DEFAULT 0,
+	show_results BOOLEAN DEFAULT FALSE,
+	songs_per_round INTEGER DEFAULT 5
+);
+
+CREATE TABLE IF NOT EXISTS users (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	party_id TEXT NOT NULL,
+	name TEXT NOT NULL,
+	FOREIGN KEY (party_id) REFERENCES parties(id),
+	UNIQUE(party_id, name)
+);
+
+CREATE TABLE IF NOT EXISTS songs (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	user_id INTEGER NOT NULL,
+	title TEXT NOT NULL,
+	shuffle_index INTEGER DEFAULT -1,
+	FOREIGN KEY (user_id) REFERENCES users(id)
+);
+
+CREATE TABLE IF NOT EXISTS guesses (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	guesser_id INTEGER NOT NULL,
+	song_id INTEGER NOT NULL,
+	guessed_user_id INTEGER NOT NULL,
+	FOREIGN KEY (guesser_id) REFERENCES users(id),
+	FOREIGN KEY (song_id) REFERENCES songs(id),
+	FOREIGN KEY (guessed_user_id) REFERENCES users(id),
+	UNIQUE(guesser_id, song_id)
+);
+`
+
+const migrationsTable = `
+CREATE TABLE IF NOT EXISTS schema_migrations (
+	version INTEGER PRIMARY KEY,
+	name TEXT NOT NULL,
+	applied_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+`
+
+func execSQL(query string) func(tx *sql.Tx) error {
+	return func(tx *sql.Tx) error {
+		_, err := tx.Exec(query)
+		return err
+	}
+}
+
+// addColumns adds columns to a table, skipping those that already exist.
+// Databases created before migrations were tracked may have some of them.
+func addColumns(table string, columns ...string) func(tx *sql.Tx) error {
+	return func(tx *sql.Tx) error {
+		existing, err := columnNames(tx, table)
+		if err != nil {
+			return err
+		}
+		for _, column := range columns {
+			var name string
+			fmt.Sscan(column, &name)
+			if existing[name] {
+				continue
+			}
+			if _, err := tx.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s", table, column)); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+func columnNames(tx *sql.Tx, table string) (map[string]bool, error) {
+	rows, err := tx.Query(fmt.Sprintf("PRAGMA table_info(%s)", table))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	names := make(map[string]bool)
+	for rows.Next() {
+		var cid, notNull, pk int
+		var name, typ string
+		var dflt sql.NullString
+		if err := rows.Scan(&cid, &name, &typ, &notNull, &dflt, &pk); err != nil {
+			return nil, err
+		}
+		names[name] = true
+	}
+	return names, rows.Err()
+}
+
+// hashAdminTokens replaces plaintext admin tokens with their SHA-256 hex
+// digest, matching how the party package stores new tokens.
+func hashAdminTokens(tx *sql.Tx) error {
+	rows, err := tx.Query("SELECT id, admin_token FROM parties")
+	if err != nil {
+		return err
+	}
+	tokens := make(map[string]string)
+	for rows.Next() {
+		var id, token string
+		if err := rows.Scan(&id, &token); err != nil {
+			rows.Close()
+			return err
+		}
+		tokens[id] = token
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for id, token := range tokens {
+		sum := sha256.Sum256([]byte(token))
+		if _, err := tx.Exec("UPDATE parties SET admin_token = ? WHERE id = ?", hex.EncodeToString(sum[:]), id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Status reports which migrations have been applied to the database.
+func Status(db *sql.DB) ([]MigrationStatus, error) {
+	if _, err := db.Exec(migrationsTable); err != nil {
+		return nil, err
+	}
+
+	rows, err := db.Query("SELECT version, applied_at FROM schema_migrations")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	applied := make(map[int]time.Time)
+	for rows.Next() {
+		var version int
+		var appliedAt time.Time
+		if err := rows.Scan(&version, &appliedAt); err != nil {
+			return nil, err
+		}
+		applied[version] = appliedAt
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	statuses := make([]MigrationStatus, len(Migrations))
+	for i, m := range Migrations {
+		appliedAt, ok := applied[m.Version]
+		statuses[i] = MigrationStatus{Migration: m, Applied: ok, AppliedAt: appliedAt}
+	}
+	return statuses, nil
+}
+
+// Migrate applies all pending migrations in order and returns the ones it
+// applied. It stops at the first migration that fails, leaving it unapplied.
+func Migrate(db *sql.DB) ([]Migration, error) {
+	statuses, err := Status(db)
+	if err != nil {
+		return nil, err
+	}
+
+	var applied []Migration
+	for _, st := range statuses {
+		if st.Applied {
+			continue
+		}
+		if err := apply(db, st.Migration); err != nil {
+			return applied, fmt.Errorf("migration %d (%s): %w", st.Version, st.Name, err)
+		}
+		applied = append(applied, st.Migration)
+	}
+	return applied, nil
+}
+
+func apply(db *sql.DB, m Migration) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := m.Up(tx); err != nil {
+		return err
+	}
+	if _, err := tx.Exec("INSERT INTO schema_migrations (version, name) VALUES (?, ?)", m.Version, m.Name); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
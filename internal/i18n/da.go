@@ -0,0 +1,250 @@
+package i18n
+
+var da = map[string]string{
+	// Errors returned by the party service, keyed by error code
+	"error.party_not_found":         "festen %s eksisterer ikke",
+	"error.party_started":           "festen %s er allerede startet",
+	"error.not_started":             "konkurrencen er ikke startet",
+	"error.no_free_party_id":        "kunne ikke finde et ledigt fest-ID efter %d forsøg",
+	"error.no_songs":                "ingen sange fundet for festen %s",
+	"error.song_count":              "der kræves præcis %d sange, fik %d",
+	"error.name_taken":              "navnet %s er allerede taget i denne fest",
+	"error.user_name_missing":       "spilleren mangler et navn",
+	"error.user_not_found":          "spilleren %d findes ikke i festen",
+	"error.session_claim_failed":    "spilleren %s findes ikke eller er allerede logget ind",
+	"error.invalid_session":         "ugyldig session",
+	"error.round_closed":            "tiden er løbet ud for denne runde",
+	"error.round_not_revealed":      "runde %d er ikke blevet afsløret endnu",
+	"error.game_not_over":           "spillet er ikke slut endnu",
+	"error.song_not_found":          "sangen %d findes ikke i festen",
+	"error.song_title_missing":      "sangen mangler en titel",
+	"error.song_lookup_failed":      "sangen %s blev ikke fundet",
+	"error.songs_per_round_range":   "antal sange per runde skal være mellem %d og %d, fik %d",
+	"error.songs_per_player_range":  "antal sange per spiller skal være mellem %d og %d, fik %d",
+	"error.songs_per_player_locked": "antal sange per spiller kan ikke ændres, når spillere har tilmeldt sig",
+	"error.unknown_scoring_mode":    "ukendt pointsystem %q",
+	"error.round_time_limit_range":  "tidsgrænsen skal være mellem 0 og %d sekunder, fik %d",
+	"error.unknown_team_policy":     "ukendt regel for holdgæt %q",
+	"error.wager_budget_range":      "indsatsbudgettet skal være mellem %d og %d, fik %d",
+	"error.unknown_language":        "ukendt sprog %q",
+	"error.team_name_missing":       "holdet mangler et navn",
+	"error.team_name_taken":         "holdnavnet %s er allerede taget",
+	"error.team_not_found":          "holdet %d findes ikke i festen",
+	"error.no_teams":                "opret mindst ét hold for at spille i hold",
+	"error.team_already_guessed":    "dit hold har allerede gættet på denne sang",
+	"error.guess_locked":            "du har allerede gættet på denne sang",
+	"error.song_not_in_round":       "sang %d er ikke med i den åbne runde",
+	"error.own_song":                "du kan ikke gætte på din egen sang",
+	"error.self_guess":              "du kan ikke gætte på dig selv",
+	"error.wager_range":             "indsatsen skal være mellem %d og %d, fik %d",
+	"error.wager_budget_exceeded":   "du har kun %d point tilbage at satse i denne runde",
+	"error.import_version":          "ukendt eksportversion %d, forventede %d",
+	"error.import_party_name":       "festen mangler et navn",
+	"error.import_round":            "ugyldig runde %d",
+	"error.import_team":             "ugyldigt hold %d",
+	"error.import_team_name":        "holdnavnet %q mangler eller findes flere gange",
+	"error.import_user_duplicate":   "spiller %d findes flere gange",
+	"error.import_user_name":        "spiller %d mangler et navn",
+	"error.import_name_duplicate":   "navnet %q findes flere gange",
+	"error.import_user_team":        "spiller %d er på et ukendt hold %d",
+	"error.import_song_duplicate":   "sang %d findes flere gange",
+	"error.import_song_user":        "sang %d tilhører en ukendt spiller %d",
+	"error.import_song_title":       "sang %d mangler en titel",
+	"error.import_song_shuffled":    "sang %d er blandet, men festen er ikke startet",
+	"error.import_shuffle_index":    "sang %d har en ugyldig plads %d i rækkefølgen",
+	"error.import_guess_user":       "et gæt på sang %d henviser til en ukendt spiller",
+	"error.import_guess_song":       "et gæt henviser til en ukendt sang %d",
+	"error.import_wager":            "ugyldig indsats %d på sang %d",
+	"error.import_guess_duplicate":  "spiller %d har gættet på sang %d flere gange",
+
+	// Errors written by the handlers
+	"error.unauthorized":       "Uautoriseret",
+	"error.no_session":         "ingen gyldig session",
+	"error.invalid_request":    "ugyldig forespørgsel: %v",
+	"error.missing_party_id":   "mangler fest-ID",
+	"error.missing_round":      "mangler runde",
+	"error.invalid_round":      "ugyldig runde",
+	"error.invalid_player":     "ugyldig spiller",
+	"error.invalid_team":       "ugyldigt hold",
+	"error.invalid_song":       "ugyldig sang",
+	"error.invalid_song_count": "ugyldigt antal sange",
+	"error.invalid_settings":   "ugyldige indstillinger",
+	"error.templates_missing":  "skabeloner ikke indlæst",
+	"error.method_not_allowed": "Metode ikke tilladt",
+	"error.qr_failed":          "Kunne ikke generere QR-kode",
+	"error.streaming":          "streaming understøttes ikke",
+	"error.too_many_requests":  "for mange søgninger, prøv igen om lidt",
+
+	// Layout
+	"app.title":       "Nytårs Wrapped",
+	"app.description": "Nytårs Wrapped - Gæt hinandens yndlingssange.",
+	"app.keywords":    "Nytårs Wrapped, Musikkonkurrence, YouTube Music, Selskabsleg",
+	"app.built_with":  "Bygget med Go & Pico CSS",
+	"app.language":    "Sprog",
+	"app.error_title": "Noget gik galt",
+	"app.error_back":  "Tilbage",
+
+	// Front page
+	"index.create_title":  "Opret en fest",
+	"index.party_name":    "Festnavn",
+	"index.create_button": "Opret fest",
+	"index.join_title":    "Deltag i en fest",
+	"index.party_id":      "Fest-ID",
+	"index.join_button":   "Deltag i fest",
+
+	// Party settings
+	"settings.title":               "Indstillinger",
+	"settings.songs_per_round":     "Sange per runde",
+	"settings.songs_per_player":    "Sange per spiller",
+	"settings.scoring_mode":        "Pointsystem",
+	"settings.scoring.standard":    "Standard: 1 point per rigtigt gæt",
+	"settings.scoring.speed":       "Hurtighed: op til 10 point, færre jo længere du tøver",
+	"settings.scoring.wager":       "Indsats: sats 1–3 point per gæt, og vind eller tab indsatsen",
+	"settings.round_time_limit":    "Tidsgrænse per runde (sekunder, 0 = ingen)",
+	"settings.wager_budget":        "Indsatsbudget per runde (kun med indsats)",
+	"settings.allow_late_join":     "Tillad at deltage efter start",
+	"settings.allow_guess_changes": "Lad spillerne ændre deres gæt indtil afsløringen",
+	"settings.team_mode":           "Spil i hold",
+	"settings.team_guess_policy":   "Holdgæt",
+	"settings.team_policy.first":   "Holdets første gæt tæller",
+	"settings.team_policy.last":    "Holdets seneste gæt tæller",
+	"settings.language":            "Sprog",
+	"settings.language_auto":       "Følg browseren",
+	"settings.save":                "Gem indstillinger",
+
+	// Lobby
+	"lobby.qr_alt":            "QR-kode til at deltage",
+	"lobby.qr_hint":           "Andre kan deltage med denne QR-kode!",
+	"lobby.join_title":        "Deltag i festen",
+	"lobby.your_name":         "Dit navn",
+	"lobby.your_songs.one":    "Din yndlingssang",
+	"lobby.your_songs.other":  "Dine top %d sange",
+	"lobby.search_song":       "Søg efter sang %d...",
+	"lobby.pick_all_songs":    "Vælg venligst alle sange fra søgeforslagene.",
+	"lobby.join_button":       "Indsend & deltag",
+	"lobby.waiting":           "Venter på spillere...",
+	"lobby.playing_as":        "Du spiller som",
+	"lobby.my_songs":          "Dine sange",
+	"lobby.save_my_songs":     "Gem mine sange",
+	"lobby.start":             "Start konkurrencen",
+	"lobby.waiting_for_admin": "Venter på at administratoren starter...",
+	"lobby.refresh":           "Opdater spillere",
+	"lobby.song_list":         "Se sangliste",
+
+	// Teams
+	"teams.title":         "Hold",
+	"teams.assign_hint":   "Spillere uden hold fordeles på de mindste hold, når konkurrencen starter.",
+	"teams.members.one":   "%d spiller",
+	"teams.members.other": "%d spillere",
+	"teams.delete":        "Slet hold",
+	"teams.name":          "Holdnavn",
+	"teams.create":        "Opret hold",
+	"teams.your_team":     "(dit hold)",
+	"teams.no_members":    "ingen endnu",
+	"teams.none":          "Administratoren har ikke oprettet nogen hold endnu.",
+	"teams.assign_me":     "Tildel mig et hold",
+	"teams.pick":          "Vælg hold",
+
+	// Lobby moderation
+	"moderation.players":        "Spillere (%d)",
+	"moderation.name":           "Navn",
+	"moderation.rename":         "Omdøb",
+	"moderation.song_title":     "Titel",
+	"moderation.youtube_id":     "YouTube-ID",
+	"moderation.save_song":      "Gem sang",
+	"moderation.confirm_remove": "Fjern %s og deres sange fra festen?",
+	"moderation.remove":         "Fjern spiller",
+	"moderation.hint":           "Ændr titlen og ryd YouTube-ID'et for at skrive en sang i hånden, eller indsæt et nyt YouTube-ID og ryd titlen for at slå den op.",
+
+	// Game
+	"game.over_title":          "Spillet er slut!",
+	"game.over_text":           "Alle sange er blevet gættet og afsløret. Se dine resultater og den endelige rangliste nedenfor!",
+	"game.see_wrapped":         "Se din Wrapped",
+	"game.your_guesses":        "Dine gæt",
+	"game.song":                "Sang",
+	"game.your_guess":          "Dit gæt",
+	"game.team_guess":          "Holdets gæt",
+	"game.owner":               "Rigtig ejer",
+	"game.no_guess":            "Intet gæt",
+	"game.round_guessing":      "Runde %d - Gæt",
+	"game.round_results":       "Runde %d - Resultater",
+	"game.time_left":           "Tid tilbage:",
+	"game.wager_left.one":      "Du har %d point tilbage at satse i denne runde.",
+	"game.wager_left.other":    "Du har %d point tilbage at satse i denne runde.",
+	"game.who_owns":            "Hvem ejer denne sang?",
+	"game.wager":               "Indsats",
+	"game.wager_option.one":    "Sats %d point",
+	"game.wager_option.other":  "Sats %d point",
+	"game.guess":               "Gæt",
+	"game.change_team_guess":   "Skift holdets gæt",
+	"game.change_guess":        "Skift gæt",
+	"game.own_song":            "Din sang",
+	"game.reveals":             "Afsløringer for runde %d",
+	"game.was_from":            "var fra",
+	"game.wager_note":          "(indsats %d)",
+	"game.not_guessed":         "Du gættede ikke på denne sang.",
+	"game.results_round":       "Resultater for runde %d",
+	"game.results_previous":    "Resultater fra forrige runde",
+	"game.player":              "Spiller",
+	"game.team":                "Hold",
+	"game.points":              "Point",
+	"game.final_leaderboard":   "Endelig rangliste",
+	"game.overall_leaderboard": "Samlet rangliste",
+	"game.team_leaderboard":    "Holdrangliste",
+	"game.next_round":          "Næste runde",
+	"game.reveal":              "Afslør resultater",
+	"game.refresh":             "Opdater runde",
+
+	// Song list
+	"song_list.title":        "Festens sangliste",
+	"song_list.subtitle":     "Administratorvisning af alle sange i festen.",
+	"song_list.owner":        "Ejer:",
+	"song_list.play":         "Afspil sangen",
+	"song_list.empty":        "Ingen sange er tilføjet endnu.",
+	"song_list.back":         "Tilbage til festen",
+	"playlists.title":        "Afspilningslister",
+	"playlists.text":         "Hent alle sange i den blandede rækkefølge som afspilningsliste.",
+	"playlists.m3u":          "Hent M3U",
+	"playlists.xspf":         "Hent XSPF",
+	"playlists.rounds":       "Afspil en hel runde på YouTube:",
+	"playlists.round":        "Runde %d",
+	"playlists.songs.one":    "(%d sang)",
+	"playlists.songs.other":  "(%d sange)",
+	"playlists.rounds_later": "Links til hver runde på YouTube vises, når konkurrencen er startet.",
+
+	// Wrapped
+	"wrapped.title":                "Wrapped for %s",
+	"wrapped.out_of.one":           "ud af %d spiller med",
+	"wrapped.out_of.other":         "ud af %d spillere med",
+	"wrapped.points.one":           "%d point",
+	"wrapped.points.other":         "%d point",
+	"wrapped.knew_you_best":        "Kendte dig bedst",
+	"wrapped.guessed_yours.one":    "gættede %[2]d af din ene sang",
+	"wrapped.guessed_yours.other":  "gættede %[2]d af dine %[1]d sange",
+	"wrapped.nobody_guessed_yours": "Ingen gættede dine sange.",
+	"wrapped.you_knew_best":        "Du kendte bedst",
+	"wrapped.guessed_theirs.one":   "du gættede %[2]d af deres ene sang",
+	"wrapped.guessed_theirs.other": "du gættede %[2]d af deres %[1]d sange",
+	"wrapped.you_guessed_none":     "Du gættede ingen sange rigtigt.",
+	"wrapped.songs_guessed.one":    "Din sang • %[2]d af %[1]d blev gættet",
+	"wrapped.songs_guessed.other":  "Dine sange • %[2]d af %[1]d blev gættet",
+	"wrapped.guessed_by":           "Gættet af",
+	"wrapped.nobody_guessed":       "Ingen gættede den.",
+	"wrapped.accuracy_title":       "Træfsikkerhed per runde",
+	"wrapped.round":                "Runde",
+	"wrapped.correct":              "Rigtige",
+	"wrapped.accuracy":             "Træfsikkerhed",
+	"wrapped.share":                "Del som billede",
+	"wrapped.back":                 "Tilbage til spillet",
+
+	// Wrapped card
+	"card.title":          "NYTÅRS WRAPPED",
+	"card.out_of.one":     "ud af %d spiller · %d point",
+	"card.out_of.other":   "ud af %d spillere · %d point",
+	"card.your_songs":     "Dine sange",
+	"card.nobody_guessed": "Ingen gættede den",
+	"card.guessed_by":     "Gættet af %d",
+	"card.knew_you_best":  "Kendte dig bedst",
+	"card.friend":         "%s · %d af %d",
+	"card.mystery":        "Ingen – du var et mysterium",
+}
@@ -0,0 +1,250 @@
+package i18n
+
+var en = map[string]string{
+	// Errors returned by the party service, keyed by error code
+	"error.party_not_found":         "party %s does not exist",
+	"error.party_started":           "party %s has already started",
+	"error.not_started":             "the competition has not started",
+	"error.no_free_party_id":        "could not find a free party ID after %d attempts",
+	"error.no_songs":                "no songs found for party %s",
+	"error.song_count":              "exactly %d songs are required, got %d",
+	"error.name_taken":              "the name %s is already taken in this party",
+	"error.user_name_missing":       "the player has no name",
+	"error.user_not_found":          "player %d is not in the party",
+	"error.session_claim_failed":    "player %s does not exist or is already logged in",
+	"error.invalid_session":         "invalid session",
+	"error.round_closed":            "time is up for this round",
+	"error.round_not_revealed":      "round %d has not been revealed yet",
+	"error.game_not_over":           "the game is not over yet",
+	"error.song_not_found":          "song %d is not in the party",
+	"error.song_title_missing":      "the song has no title",
+	"error.song_lookup_failed":      "song %s was not found",
+	"error.songs_per_round_range":   "songs per round must be between %d and %d, got %d",
+	"error.songs_per_player_range":  "songs per player must be between %d and %d, got %d",
+	"error.songs_per_player_locked": "songs per player cannot be changed once players have joined",
+	"error.unknown_scoring_mode":    "unknown scoring mode %q",
+	"error.round_time_limit_range":  "the time limit must be between 0 and %d seconds, got %d",
+	"error.unknown_team_policy":     "unknown team guess policy %q",
+	"error.wager_budget_range":      "the wager budget must be between %d and %d, got %d",
+	"error.unknown_language":        "unknown language %q",
+	"error.team_name_missing":       "the team has no name",
+	"error.team_name_taken":         "the team name %s is already taken",
+	"error.team_not_found":          "team %d is not in the party",
+	"error.no_teams":                "create at least one team to play in teams",
+	"error.team_already_guessed":    "your team has already guessed this song",
+	"error.guess_locked":            "you have already guessed this song",
+	"error.song_not_in_round":       "song %d is not in the open round",
+	"error.own_song":                "you cannot guess your own song",
+	"error.self_guess":              "you cannot guess yourself",
+	"error.wager_range":             "the wager must be between %d and %d, got %d",
+	"error.wager_budget_exceeded":   "you only have %d points left to wager this round",
+	"error.import_version":          "unknown export version %d, expected %d",
+	"error.import_party_name":       "the party has no name",
+	"error.import_round":            "invalid round %d",
+	"error.import_team":             "invalid team %d",
+	"error.import_team_name":        "team name %q is missing or appears more than once",
+	"error.import_user_duplicate":   "player %d appears more than once",
+	"error.import_user_name":        "player %d has no name",
+	"error.import_name_duplicate":   "the name %q appears more than once",
+	"error.import_user_team":        "player %d is on an unknown team %d",
+	"error.import_song_duplicate":   "song %d appears more than once",
+	"error.import_song_user":        "song %d belongs to an unknown player %d",
+	"error.import_song_title":       "song %d has no title",
+	"error.import_song_shuffled":    "song %d is shuffled, but the party has not started",
+	"error.import_shuffle_index":    "song %d has an invalid position %d in the order",
+	"error.import_guess_user":       "a guess on song %d refers to an unknown player",
+	"error.import_guess_song":       "a guess refers to an unknown song %d",
+	"error.import_wager":            "invalid wager %d on song %d",
+	"error.import_guess_duplicate":  "player %d guessed song %d more than once",
+
+	// Errors written by the handlers
+	"error.unauthorized":       "Unauthorized",
+	"error.no_session":         "no valid session",
+	"error.invalid_request":    "invalid request: %v",
+	"error.missing_party_id":   "missing party ID",
+	"error.missing_round":      "missing round",
+	"error.invalid_round":      "invalid round",
+	"error.invalid_player":     "invalid player",
+	"error.invalid_team":       "invalid team",
+	"error.invalid_song":       "invalid song",
+	"error.invalid_song_count": "invalid number of songs",
+	"error.invalid_settings":   "invalid settings",
+	"error.templates_missing":  "templates not loaded",
+	"error.method_not_allowed": "Method not allowed",
+	"error.qr_failed":          "Could not generate QR code",
+	"error.streaming":          "streaming is not supported",
+	"error.too_many_requests":  "too many searches, try again in a moment",
+
+	// Layout
+	"app.title":       "New Year Wrapped",
+	"app.description": "New Year Wrapped - Guess each other's favourite songs.",
+	"app.keywords":    "New Year Wrapped, Music quiz, YouTube Music, Party game",
+	"app.built_with":  "Built with Go & Pico CSS",
+	"app.language":    "Language",
+	"app.error_title": "Something went wrong",
+	"app.error_back":  "Go back",
+
+	// Front page
+	"index.create_title":  "Create a party",
+	"index.party_name":    "Party name",
+	"index.create_button": "Create party",
+	"index.join_title":    "Join a party",
+	"index.party_id":      "Party ID",
+	"index.join_button":   "Join party",
+
+	// Party settings
+	"settings.title":               "Settings",
+	"settings.songs_per_round":     "Songs per round",
+	"settings.songs_per_player":    "Songs per player",
+	"settings.scoring_mode":        "Scoring",
+	"settings.scoring.standard":    "Standard: 1 point per correct guess",
+	"settings.scoring.speed":       "Speed: up to 10 points, fewer the longer you hesitate",
+	"settings.scoring.wager":       "Wager: bet 1–3 points per guess and win or lose your bet",
+	"settings.round_time_limit":    "Time limit per round (seconds, 0 = none)",
+	"settings.wager_budget":        "Wager budget per round (wager scoring only)",
+	"settings.allow_late_join":     "Allow joining after the start",
+	"settings.allow_guess_changes": "Let players change their guesses until the reveal",
+	"settings.team_mode":           "Play in teams",
+	"settings.team_guess_policy":   "Team guesses",
+	"settings.team_policy.first":   "The team's first guess counts",
+	"settings.team_policy.last":    "The team's latest guess counts",
+	"settings.language":            "Language",
+	"settings.language_auto":       "Follow the browser",
+	"settings.save":                "Save settings",
+
+	// Lobby
+	"lobby.qr_alt":            "QR code to join",
+	"lobby.qr_hint":           "Others can join with this QR code!",
+	"lobby.join_title":        "Join the party",
+	"lobby.your_name":         "Your name",
+	"lobby.your_songs.one":    "Your favourite song",
+	"lobby.your_songs.other":  "Your top %d songs",
+	"lobby.search_song":       "Search for song %d...",
+	"lobby.pick_all_songs":    "Please pick every song from the search suggestions.",
+	"lobby.join_button":       "Submit & join",
+	"lobby.waiting":           "Waiting for players...",
+	"lobby.playing_as":        "You are playing as",
+	"lobby.my_songs":          "Your songs",
+	"lobby.save_my_songs":     "Save my songs",
+	"lobby.start":             "Start the competition",
+	"lobby.waiting_for_admin": "Waiting for the admin to start...",
+	"lobby.refresh":           "Refresh players",
+	"lobby.song_list":         "See song list",
+
+	// Teams
+	"teams.title":         "Teams",
+	"teams.assign_hint":   "Players without a team are put on the smallest teams when the competition starts.",
+	"teams.members.one":   "%d player",
+	"teams.members.other": "%d players",
+	"teams.delete":        "Delete team",
+	"teams.name":          "Team name",
+	"teams.create":        "Create team",
+	"teams.your_team":     "(your team)",
+	"teams.no_members":    "nobody yet",
+	"teams.none":          "The admin has not created any teams yet.",
+	"teams.assign_me":     "Assign me a team",
+	"teams.pick":          "Pick team",
+
+	// Lobby moderation
+	"moderation.players":        "Players (%d)",
+	"moderation.name":           "Name",
+	"moderation.rename":         "Rename",
+	"moderation.song_title":     "Title",
+	"moderation.youtube_id":     "YouTube ID",
+	"moderation.save_song":      "Save song",
+	"moderation.confirm_remove": "Remove %s and their songs from the party?",
+	"moderation.remove":         "Remove player",
+	"moderation.hint":           "Change the title and clear the YouTube ID to type a song by hand, or paste a new YouTube ID and clear the title to look it up.",
+
+	// Game
+	"game.over_title":          "The game is over!",
+	"game.over_text":           "Every song has been guessed and revealed. See your results and the final leaderboard below!",
+	"game.see_wrapped":         "See your Wrapped",
+	"game.your_guesses":        "Your guesses",
+	"game.song":                "Song",
+	"game.your_guess":          "Your guess",
+	"game.team_guess":          "Team's guess",
+	"game.owner":               "Actual owner",
+	"game.no_guess":            "No guess",
+	"game.round_guessing":      "Round %d - Guess",
+	"game.round_results":       "Round %d - Results",
+	"game.time_left":           "Time left:",
+	"game.wager_left.one":      "You have %d point left to wager this round.",
+	"game.wager_left.other":    "You have %d points left to wager this round.",
+	"game.who_owns":            "Who owns this song?",
+	"game.wager":               "Wager",
+	"game.wager_option.one":    "Bet %d point",
+	"game.wager_option.other":  "Bet %d points",
+	"game.guess":               "Guess",
+	"game.change_team_guess":   "Change the team's guess",
+	"game.change_guess":        "Change guess",
+	"game.own_song":            "Your song",
+	"game.reveals":             "Reveals for round %d",
+	"game.was_from":            "was from",
+	"game.wager_note":          "(wager %d)",
+	"game.not_guessed":         "You did not guess this song.",
+	"game.results_round":       "Results for round %d",
+	"game.results_previous":    "Results from the previous round",
+	"game.player":              "Player",
+	"game.team":                "Team",
+	"game.points":              "Points",
+	"game.final_leaderboard":   "Final leaderboard",
+	"game.overall_leaderboard": "Overall leaderboard",
+	"game.team_leaderboard":    "Team leaderboard",
+	"game.next_round":          "Next round",
+	"game.reveal":              "Reveal results",
+	"game.refresh":             "Refresh round",
+
+	// Song list
+	"song_list.title":        "The party's song list",
+	"song_list.subtitle":     "Admin view of every song in the party.",
+	"song_list.owner":        "Owner:",
+	"song_list.play":         "Play the song",
+	"song_list.empty":        "No songs have been added yet.",
+	"song_list.back":         "Back to the party",
+	"playlists.title":        "Playlists",
+	"playlists.text":         "Download every song in the shuffled order as a playlist.",
+	"playlists.m3u":          "Download M3U",
+	"playlists.xspf":         "Download XSPF",
+	"playlists.rounds":       "Play a whole round on YouTube:",
+	"playlists.round":        "Round %d",
+	"playlists.songs.one":    "(%d song)",
+	"playlists.songs.other":  "(%d songs)",
+	"playlists.rounds_later": "Links to each round on YouTube appear once the competition has started.",
+
+	// Wrapped
+	"wrapped.title":                "Wrapped for %s",
+	"wrapped.out_of.one":           "out of %d player with",
+	"wrapped.out_of.other":         "out of %d players with",
+	"wrapped.points.one":           "%d point",
+	"wrapped.points.other":         "%d points",
+	"wrapped.knew_you_best":        "Knew you best",
+	"wrapped.guessed_yours.one":    "guessed %[2]d of your one song",
+	"wrapped.guessed_yours.other":  "guessed %[2]d of your %[1]d songs",
+	"wrapped.nobody_guessed_yours": "Nobody guessed your songs.",
+	"wrapped.you_knew_best":        "You knew best",
+	"wrapped.guessed_theirs.one":   "you guessed %[2]d of their one song",
+	"wrapped.guessed_theirs.other": "you guessed %[2]d of their %[1]d songs",
+	"wrapped.you_guessed_none":     "You did not guess any songs right.",
+	"wrapped.songs_guessed.one":    "Your song • %[2]d of %[1]d was guessed",
+	"wrapped.songs_guessed.other":  "Your songs • %[2]d of %[1]d were guessed",
+	"wrapped.guessed_by":           "Guessed by",
+	"wrapped.nobody_guessed":       "Nobody guessed it.",
+	"wrapped.accuracy_title":       "Accuracy per round",
+	"wrapped.round":                "Round",
+	"wrapped.correct":              "Correct",
+	"wrapped.accuracy":             "Accuracy",
+	"wrapped.share":                "Share as image",
+	"wrapped.back":                 "Back to the game",
+
+	// Wrapped card
+	"card.title":          "NEW YEAR WRAPPED",
+	"card.out_of.one":     "out of %d player · %d points",
+	"card.out_of.other":   "out of %d players · %d points",
+	"card.your_songs":     "Your songs",
+	"card.nobody_guessed": "Nobody guessed it",
+	"card.guessed_by":     "Guessed by %d",
+	"card.knew_you_best":  "Knew you best",
+	"card.friend":         "%s · %d of %d",
+	"card.mystery":        "Nobody – you were a mystery",
+}
@@ -0,0 +1,155 @@
+// Package i18n translates the text shown to players and admins. Messages are
+// looked up by key in a catalog per language and formatted with fmt, so a
+// message can use verbs like %d and %[2]s for its arguments.
+package i18n
+
+import (
+	"fmt"
+	"net/http"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Supported languages.
+const (
+	Danish  = "da"
+	English = "en"
+
+	// Default is used when nothing else decides the language. Messages
+	// missing from a catalog also fall back to it.
+	Default = Danish
+)
+
+// Language is a supported language and its name in that language.
+type Language struct {
+	Code string
+	Name string
+}
+
+// Languages lists the supported languages in the order they are offered.
+var Languages = []Language{
+	{Danish, "Dansk"},
+	{English, "English"},
+}
+
+// CookieName is the cookie holding the language a visitor picked.
+const CookieName = "lang"
+
+var catalogs = map[string]map[string]string{
+	Danish:  da,
+	English: en,
+}
+
+// Supported reports whether there is a catalog for lang.
+func Supported(lang string) bool {
+	_, ok := catalogs[lang]
+	return ok
+}
+
+// Lookup returns the unformatted message for key in lang, without falling
+// back to another language.
+func Lookup(lang, key string) (string, bool) {
+	msg, ok := catalogs[lang][key]
+	return msg, ok
+}
+
+// Keys returns the keys of the catalog for lang in sorted order.
+func Keys(lang string) []string {
+	keys := make([]string, 0, len(catalogs[lang]))
+	for key := range catalogs[lang] {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// T returns the message for key in lang formatted with args. Keys missing
+// from lang fall back to the default language and then to the key itself.
+func T(lang, key string, args ...any) string {
+	msg, ok := catalogs[lang][key]
+	if !ok {
+		msg, ok = catalogs[Default][key]
+	}
+	if !ok {
+		return key
+	}
+	if len(args) == 0 {
+		return msg
+	}
+	return fmt.Sprintf(msg, args...)
+}
+
+// Plural returns the form of the message for key that fits the count n.
+// The forms are stored as key.one and key.other, and n is passed as the
+// first argument before args.
+func Plural(lang, key string, n int, args ...any) string {
+	form := ".other"
+	if n == 1 {
+		form = ".one"
+	}
+	return T(lang, key+form, append([]any{n}, args...)...)
+}
+
+// Negotiate picks the language of a response. A language the visitor picked
+// wins, then the party's language, then the best match in the browser's
+// Accept-Language header. Unsupported choices are skipped.
+func Negotiate(picked, partyDefault, acceptLanguage string) string {
+	if Supported(picked) {
+		return picked
+	}
+	if Supported(partyDefault) {
+		return partyDefault
+	}
+	for _, lang := range parseAcceptLanguage(acceptLanguage) {
+		if Supported(lang) {
+			return lang
+		}
+	}
+	return Default
+}
+
+// FromRequest negotiates the language of a response to r.
+func FromRequest(r *http.Request, partyDefault string) string {
+	picked := ""
+	if c, err := r.Cookie(CookieName); err == nil {
+		picked = c.Value
+	}
+	return Negotiate(picked, partyDefault, r.Header.Get("Accept-Language"))
+}
+
+// parseAcceptLanguage returns the primary language subtags of an
+// Accept-Language header, most preferred first.
+func parseAcceptLanguage(header string) []string {
+	type weighted struct {
+		lang string
+		q    float64
+	}
+	var langs []weighted
+	for _, part := range strings.Split(header, ",") {
+		tag, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		q := 1.0
+		if v, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			parsed, err := strconv.ParseFloat(v, 64)
+			if err != nil {
+				continue
+			}
+			q = parsed
+		}
+		primary, _, _ := strings.Cut(strings.ToLower(strings.TrimSpace(tag)), "-")
+		if primary == "" || q <= 0 {
+			continue
+		}
+		langs = append(langs, weighted{primary, q})
+	}
+	sort.SliceStable(langs, func(i, j int) bool { return langs[i].q > langs[j].q })
+
+	var result []string
+	for _, l := range langs {
+		if !slices.Contains(result, l.lang) {
+			result = append(result, l.lang)
+		}
+	}
+	return result
+}
@@ -0,0 +1,103 @@
+package i18n_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"slices"
+	"testing"
+
+	"github.com/jehaj/new-year-wrapped/internal/i18n"
+)
+
+func TestTranslate(t *testing.T) {
+	t.Run("Messages are formatted in the requested language", func(t *testing.T) {
+		if got := i18n.T(i18n.English, "error.party_not_found", "ABC123"); got != "party ABC123 does not exist" {
+			t.Errorf("unexpected English message %q", got)
+		}
+		if got := i18n.T(i18n.Danish, "error.party_not_found", "ABC123"); got != "festen ABC123 eksisterer ikke" {
+			t.Errorf("unexpected Danish message %q", got)
+		}
+	})
+
+	t.Run("Unknown languages and keys fall back", func(t *testing.T) {
+		if got := i18n.T("xx", "game.guess"); got != "Gæt" {
+			t.Errorf("expected the Danish message, got %q", got)
+		}
+		if got := i18n.T(i18n.English, "no.such.key"); got != "no.such.key" {
+			t.Errorf("expected the key, got %q", got)
+		}
+	})
+
+	t.Run("Plural forms follow the count", func(t *testing.T) {
+		if got := i18n.Plural(i18n.English, "teams.members", 1); got != "1 player" {
+			t.Errorf("unexpected singular %q", got)
+		}
+		if got := i18n.Plural(i18n.English, "teams.members", 0); got != "0 players" {
+			t.Errorf("unexpected plural %q", got)
+		}
+		if got := i18n.Plural(i18n.English, "wrapped.guessed_yours", 3, 2); got != "guessed 2 of your 3 songs" {
+			t.Errorf("unexpected message with extra arguments %q", got)
+		}
+	})
+}
+
+// verbs matches the fmt verbs of a message, ignoring escaped percent signs.
+var verbs = regexp.MustCompile(`%(\[\d+\])?[a-z]`)
+
+func TestCatalogs(t *testing.T) {
+	// Given: The catalog of every supported language
+	// When: Their keys are compared with the default catalog
+	// Then: Every language has every message with the same arguments
+	for _, lang := range i18n.Languages {
+		for _, key := range i18n.Keys(i18n.Default) {
+			want := verbs.FindAllString(i18n.T(i18n.Default, key), -1)
+			msg, ok := i18n.Lookup(lang.Code, key)
+			if !ok {
+				t.Errorf("%s: missing %q", lang.Code, key)
+				continue
+			}
+			got := verbs.FindAllString(msg, -1)
+			slices.Sort(want)
+			slices.Sort(got)
+			if !slices.Equal(got, want) {
+				t.Errorf("%s: %q has verbs %v, want %v", lang.Code, key, got, want)
+			}
+		}
+		if got, want := len(i18n.Keys(lang.Code)), len(i18n.Keys(i18n.Default)); got != want {
+			t.Errorf("%s: %d messages, want %d", lang.Code, got, want)
+		}
+	}
+}
+
+func TestNegotiate(t *testing.T) {
+	tests := []struct {
+		name                                 string
+		picked, partyDefault, acceptLanguage string
+		want                                 string
+	}{
+		{"Nothing set", "", "", "", i18n.Default},
+		{"Browser", "", "", "en-GB,en;q=0.9", i18n.English},
+		{"Browser by quality", "", "", "fr;q=0.5, en;q=0.8, de", i18n.English},
+		{"Unsupported browser languages", "", "", "fr, de", i18n.Default},
+		{"Party default beats the browser", "", i18n.Danish, "en", i18n.Danish},
+		{"Picked language beats everything", i18n.English, i18n.Danish, "da", i18n.English},
+		{"Unsupported picks are skipped", "xx", "", "en", i18n.English},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := i18n.Negotiate(tt.picked, tt.partyDefault, tt.acceptLanguage); got != tt.want {
+				t.Errorf("expected %q, got %q", tt.want, got)
+			}
+		})
+	}
+
+	t.Run("From a request", func(t *testing.T) {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Header.Set("Accept-Language", "da")
+		req.AddCookie(&http.Cookie{Name: i18n.CookieName, Value: i18n.English})
+		if got := i18n.FromRequest(req, ""); got != i18n.English {
+			t.Errorf("expected the cookie to win, got %q", got)
+		}
+	})
+}
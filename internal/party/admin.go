@@ -0,0 +1,48 @@
+package party
+
+import (
+	"net/http"
+	"strings"
+)
+
+// requestAdminToken returns the admin token sent with an API request in an
+// "Authorization: Bearer" header or the X-Admin-Token header.
+func requestAdminToken(r *http.Request) string {
+	if scheme, token, ok := strings.Cut(r.Header.Get("Authorization"), " "); ok && strings.EqualFold(scheme, "Bearer") {
+		return strings.TrimSpace(token)
+	}
+	return r.Header.Get("X-Admin-Token")
+}
+
+// RequireAdmin only lets requests carrying the admin token of the party in
+// the path through to next. Other requests get 401 Unauthorized.
+func (h *Handler) RequireAdmin(next http.HandlerFunc) http.HandlerFunc {
+	return h.requireAdmin(next, requestAdminToken)
+}
+
+// RequireAdminDownload is RequireAdmin for download links, which can't send
+// headers. They may carry the admin token in the admin_token query parameter
+// instead.
+func (h *Handler) RequireAdminDownload(next http.HandlerFunc) http.HandlerFunc {
+	return h.requireAdmin(next, func(r *http.Request) string {
+		if token := requestAdminToken(r); token != "" {
+			return token
+		}
+		return r.URL.Query().Get("admin_token")
+	})
+}
+
+func (h *Handler) requireAdmin(next http.HandlerFunc, adminToken func(*http.Request) string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		isAdmin, err := h.service.VerifyAdmin(r.Context(), h.getPartyID(r), adminToken(r))
+		if err != nil {
+			h.writeError(w, r, err)
+			return
+		}
+		if !isAdmin {
+			h.writeError(w, r, newError(CodeNotAdmin))
+			return
+		}
+		next(w, r)
+	}
+}
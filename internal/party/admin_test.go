@@ -0,0 +1,208 @@
+package party_test
+
+import (
+	"context"
+	"database/sql"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/jehaj/new-year-wrapped/internal/db"
+	"github.com/jehaj/new-year-wrapped/internal/party"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func TestHandler_RequireAdmin(t *testing.T) {
+	database, _ := sql.Open("sqlite3", ":memory:")
+	defer database.Close()
+	_, _ = db.Migrate(database)
+
+	service := party.NewService(database, nil)
+	handler := party.NewHandler(service)
+	ctx := context.Background()
+	partyID, adminToken, _ := service.CreateParty(ctx, "Admin Party", 1)
+	service.JoinParty(ctx, partyID, "Alice", []party.SongInput{{Title: "S1"}})
+	service.JoinParty(ctx, partyID, "Bob", []party.SongInput{{Title: "S2"}})
+
+	post := func(path string, header http.Header, next http.HandlerFunc) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "/parties/"+partyID+path, nil)
+		req.SetPathValue("id", partyID)
+		for k, v := range header {
+			req.Header[k] = v
+		}
+		rr := httptest.NewRecorder()
+		handler.RequireAdmin(next)(rr, req)
+		return rr
+	}
+
+	t.Run("Rejects requests without a token", func(t *testing.T) {
+		// Given: A party that has not started
+		// When: The start and next endpoints are called without an admin token
+		// Then: A 401 status is returned and the game is left alone
+		for _, tc := range []struct {
+			path string
+			next http.HandlerFunc
+		}{
+			{"/start", handler.StartCompetition},
+			{"/next", handler.NextRound},
+		} {
+			rr := post(tc.path, nil, tc.next)
+			if rr.Code != http.StatusUnauthorized {
+				t.Errorf("%s: expected status 401, got %d", tc.path, rr.Code)
+			}
+		}
+
+		started, _, _, _ := service.GetPartyState(ctx, partyID)
+		if started {
+			t.Error("expected the party not to have started")
+		}
+	})
+
+	t.Run("Rejects a wrong token", func(t *testing.T) {
+		// Given: A party that has not started
+		// When: The start endpoint is called with someone else's token
+		// Then: A 401 status is returned
+		rr := post("/start", http.Header{"Authorization": {"Bearer wrong"}}, handler.StartCompetition)
+		if rr.Code != http.StatusUnauthorized {
+			t.Errorf("expected status 401, got %d", rr.Code)
+		}
+	})
+
+	t.Run("Accepts a bearer token", func(t *testing.T) {
+		// Given: A party that has not started
+		// When: The start endpoint is called with the admin token as a bearer token
+		// Then: The competition starts
+		rr := post("/start", http.Header{"Authorization": {"Bearer " + adminToken}}, handler.StartCompetition)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("expected status 200, got %d: %s", rr.Code, rr.Body.String())
+		}
+		started, _, _, _ := service.GetPartyState(ctx, partyID)
+		if !started {
+			t.Error("expected the party to have started")
+		}
+	})
+
+	t.Run("Accepts an X-Admin-Token header", func(t *testing.T) {
+		// Given: A started party in round 1
+		// When: The next endpoint is called with the X-Admin-Token header
+		// Then: The results of round 1 are revealed
+		rr := post("/next", http.Header{"X-Admin-Token": {adminToken}}, handler.NextRound)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("expected status 200, got %d: %s", rr.Code, rr.Body.String())
+		}
+		_, _, showResults, _ := service.GetPartyState(ctx, partyID)
+		if !showResults {
+			t.Error("expected the results to be shown")
+		}
+	})
+}
+
+func TestRoutes_Admin(t *testing.T) {
+	database, _ := sql.Open("sqlite3", ":memory:")
+	defer database.Close()
+	_, _ = db.Migrate(database)
+
+	service := party.NewService(database, nil)
+	handler := party.NewHandler(service)
+	ctx := context.Background()
+	partyID, adminToken, _ := service.CreateParty(ctx, "Routes Party", 1)
+	userID, _, _ := service.JoinParty(ctx, partyID, "Alice", []party.SongInput{{Title: "S1"}})
+
+	mux := http.NewServeMux()
+	routes := handler.Routes(nil)
+	for _, route := range routes {
+		mux.HandleFunc(route.Pattern, route.Handler)
+	}
+
+	adminRoutes := []string{
+		"GET /parties/{id}/players",
+		"PATCH /parties/{id}/users/{user}",
+		"DELETE /parties/{id}/users/{user}",
+		"PUT /parties/{id}/songs/{song}",
+		"POST /parties/{id}/start",
+		"POST /parties/{id}/next",
+		"POST /parties/{id}/teams",
+		"DELETE /parties/{id}/teams/{team}",
+		"GET /parties/{id}/settings",
+		"PATCH /parties/{id}/settings",
+		"GET /parties/{id}/export",
+		"GET /parties/{id}/playlist.m3u",
+		"GET /parties/{id}/playlist.xspf",
+		"GET /parties/{id}/playlist/rounds",
+		"POST " + party.APIPrefix + "/parties/{id}/start",
+		"POST " + party.APIPrefix + "/parties/{id}/next",
+	}
+
+	t.Run("Every admin route is known", func(t *testing.T) {
+		for _, route := range routes {
+			if route.Admin && !slices.Contains(adminRoutes, route.Pattern) {
+				t.Errorf("%s needs the admin token but is not tested", route.Pattern)
+			}
+		}
+	})
+
+	t.Run("Admin routes reject requests without a token", func(t *testing.T) {
+		// Given: A party with a player that has not started
+		// When: Every admin route is requested without an admin token
+		// Then: Each answers 401 with a JSON error and the party is left alone
+		wildcard := regexp.MustCompile(`\{(\w+)\}`)
+		for _, pattern := range adminRoutes {
+			method, path, _ := strings.Cut(pattern, " ")
+			path = wildcard.ReplaceAllStringFunc(path, func(w string) string {
+				if w == "{id}" {
+					return partyID
+				}
+				return "1"
+			})
+			req := httptest.NewRequest(method, path, strings.NewReader(`{"name": "Bob"}`))
+			rr := httptest.NewRecorder()
+			mux.ServeHTTP(rr, req)
+
+			if rr.Code != http.StatusUnauthorized || !strings.HasPrefix(rr.Body.String(), "{") {
+				t.Errorf("%s: expected status 401 with a JSON error, got %d: %s", pattern, rr.Code, rr.Body.String())
+			}
+		}
+
+		started, _, _, _ := service.GetPartyState(ctx, partyID)
+		users, _ := service.GetUsers(ctx, partyID)
+		if started || len(users) != 1 || users[0].ID != userID || users[0].Name != "Alice" {
+			t.Errorf("expected the party to be left alone, got started %v and users %+v", started, users)
+		}
+	})
+
+	t.Run("Only downloads accept a query token", func(t *testing.T) {
+		// Given: A party with a player that has not started
+		// When: Admin routes are requested with the admin token in the query
+		// Then: The JSON routes answer 401 and the downloads are served
+		for _, tc := range []struct {
+			pattern string
+			status  int
+		}{
+			{"POST /parties/{id}/start", http.StatusUnauthorized},
+			{"GET /parties/{id}/settings", http.StatusUnauthorized},
+			{"GET /parties/{id}/playlist/rounds", http.StatusUnauthorized},
+			{"POST " + party.APIPrefix + "/parties/{id}/start", http.StatusUnauthorized},
+			{"GET /parties/{id}/export", http.StatusOK},
+			{"GET /parties/{id}/playlist.m3u", http.StatusOK},
+			{"GET /parties/{id}/playlist.xspf", http.StatusOK},
+		} {
+			method, path, _ := strings.Cut(tc.pattern, " ")
+			path = strings.ReplaceAll(path, "{id}", partyID) + "?admin_token=" + adminToken
+			req := httptest.NewRequest(method, path, nil)
+			rr := httptest.NewRecorder()
+			mux.ServeHTTP(rr, req)
+
+			if rr.Code != tc.status {
+				t.Errorf("%s: expected status %d, got %d: %s", tc.pattern, tc.status, rr.Code, rr.Body.String())
+			}
+		}
+
+		started, _, _, _ := service.GetPartyState(ctx, partyID)
+		if started {
+			t.Error("expected the party not to have started")
+		}
+	})
+}
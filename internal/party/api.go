@@ -0,0 +1,501 @@
+package party
+
+import (
+	_ "embed"
+	"encoding/json"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+)
+
+// The versioned JSON API is served under APIPrefix. Its routes are listed by
+// APIRoutes, which main registers and the OpenAPI document is generated from.
+// Every response is a JSON object: a single resource, or an object holding a
+// list of them. Errors are answered like the rest of the API with
+// errorResponse.
+const APIPrefix = "/api/v1"
+
+// openAPIDocument is the OpenAPI document of the API, generated by OpenAPI.
+// A test keeps it in sync with the routes.
+//
+//go:embed openapi.json
+var openAPIDocument []byte
+
+// APIRoute is a route of the versioned JSON API. Besides the handler it
+// describes what the route accepts and returns, for the OpenAPI document.
+type APIRoute struct {
+	Method  string
+	Path    string // Relative to APIPrefix, with {name} for path parameters.
+	Summary string
+	Admin   bool // Needs the admin token of the party.
+	Player  bool // Needs the session of a player in the party.
+	Query   []APIParam
+	// Request and Response are values of the types of the request and
+	// response bodies. Request is nil for routes without a body.
+	Request  any
+	Response any
+	Status   int // Status of a successful response.
+	Handler  http.HandlerFunc
+}
+
+// Pattern returns the pattern to register the route with on a ServeMux.
+func (rt APIRoute) Pattern() string {
+	return rt.Method + " " + APIPrefix + rt.Path
+}
+
+// APIParam is a query parameter of an API route.
+type APIParam struct {
+	Name        string
+	Type        string // A JSON schema type, "string" or "integer".
+	Description string
+}
+
+// APIParty is a party and how far its game has come.
+type APIParty struct {
+	ID           string `json:"id"`
+	Name         string `json:"name"`
+	Started      bool   `json:"started"`
+	CurrentRound int    `json:"current_round"`
+	ShowResults  bool   `json:"show_results"` // Whether the current round is revealed.
+	TotalSongs   int    `json:"total_songs"`
+}
+
+// APICreatedParty is a new party with the token that lets its creator run it.
+type APICreatedParty struct {
+	APIParty
+	AdminToken string `json:"admin_token"`
+}
+
+// APICreateParty is the request to create a party.
+type APICreateParty struct {
+	Name           string `json:"name"`
+	SongsPerPlayer int    `json:"songs_per_player,omitempty"` // DefaultSongsPerPlayer if left out.
+}
+
+// APIJoinParty is the request to join a party. The response sets the session
+// cookie of the new player.
+type APIJoinParty struct {
+	Name  string      `json:"name"`
+	Songs []SongInput `json:"songs"`
+}
+
+// APIUsers lists the players of a party.
+type APIUsers struct {
+	Users []User `json:"users"`
+}
+
+// APISongs lists songs.
+type APISongs struct {
+	Songs []Song `json:"songs"`
+}
+
+// APISongInputs lists songs to submit, or songs found by a search.
+type APISongInputs struct {
+	Songs []SongInput `json:"songs"`
+}
+
+// APIRound is a round and its songs. The owners of the songs are only filled
+// in once the round is revealed.
+type APIRound struct {
+	Number   int          `json:"number"`
+	Revealed bool         `json:"revealed"`
+	Deadline *time.Time   `json:"deadline,omitempty"` // When an open round with a time limit closes.
+	Songs    []SongResult `json:"songs"`
+}
+
+// APIGuess is a guess on who owns a song. Wager is only used in wager mode
+// and defaults to MinWager.
+type APIGuess struct {
+	SongID        int `json:"song_id"`
+	GuessedUserID int `json:"guessed_user_id"`
+	Wager         int `json:"wager,omitempty"`
+}
+
+// APIGuesses lists the guesses of a player, or of their team in team mode.
+type APIGuesses struct {
+	Guesses []APIGuess `json:"guesses"`
+}
+
+// APILeaderboard lists the players by score.
+type APILeaderboard struct {
+	Entries []LeaderboardEntry `json:"entries"`
+}
+
+// APITeamLeaderboard lists the teams by score.
+type APITeamLeaderboard struct {
+	Entries []TeamLeaderboardEntry `json:"entries"`
+}
+
+var roundParam = APIParam{Name: "round", Type: "integer", Description: "Only count this round, once it is revealed. All revealed rounds are counted if left out."}
+
+// APIRoutes returns the routes of the versioned JSON API. Searches are rate
+// limited by searchLimiter, if set.
+func (h *Handler) APIRoutes(searchLimiter *RateLimiter) []APIRoute {
+	search := h.apiSearch
+	if searchLimiter != nil {
+		search = h.RateLimit(searchLimiter, h.apiSearch)
+	}
+
+	routes := []APIRoute{
+		{Method: "GET", Path: "/openapi.json", Summary: "Get this OpenAPI document", Response: map[string]any{}, Handler: h.apiOpenAPI},
+		{Method: "POST", Path: "/parties", Summary: "Create a party", Request: APICreateParty{}, Response: APICreatedParty{}, Status: http.StatusCreated, Handler: h.apiCreateParty},
+		{Method: "GET", Path: "/parties/{id}", Summary: "Get a party", Response: APIParty{}, Handler: h.apiGetParty},
+		{Method: "POST", Path: "/parties/{id}/start", Summary: "Start the competition", Admin: true, Response: APIParty{}, Handler: h.apiStart},
+		{Method: "POST", Path: "/parties/{id}/next", Summary: "Reveal the current round, or open the next one if it is revealed", Admin: true, Response: APIParty{}, Handler: h.apiNext},
+		{Method: "GET", Path: "/parties/{id}/users", Summary: "List the players", Response: APIUsers{}, Handler: h.apiGetUsers},
+		{Method: "POST", Path: "/parties/{id}/users", Summary: "Join a party", Request: APIJoinParty{}, Response: User{}, Status: http.StatusCreated, Handler: h.apiJoin},
+		{Method: "GET", Path: "/parties/{id}/me/songs", Summary: "List your songs", Player: true, Response: APISongs{}, Handler: h.apiGetMySongs},
+		{Method: "PUT", Path: "/parties/{id}/me/songs", Summary: "Replace your songs before the start", Player: true, Request: APISongInputs{}, Response: APISongs{}, Handler: h.apiUpdateMySongs},
+		{Method: "GET", Path: "/parties/{id}/rounds/{round}", Summary: "Get a round up to the current one", Response: APIRound{}, Handler: h.apiGetRound},
+		{Method: "GET", Path: "/parties/{id}/me/guesses", Summary: "List your guesses", Player: true, Response: APIGuesses{}, Handler: h.apiGetGuesses},
+		{Method: "POST", Path: "/parties/{id}/me/guesses", Summary: "Guess who owns a song in the open round", Player: true, Request: APIGuess{}, Response: APIGuess{}, Status: http.StatusCreated, Handler: h.apiGuess},
+		{Method: "GET", Path: "/parties/{id}/leaderboard", Summary: "Get the leaderboard", Query: []APIParam{roundParam}, Response: APILeaderboard{}, Handler: h.apiLeaderboard},
+		{Method: "GET", Path: "/parties/{id}/leaderboard/teams", Summary: "Get the team leaderboard", Query: []APIParam{roundParam}, Response: APITeamLeaderboard{}, Handler: h.apiTeamLeaderboard},
+		{Method: "GET", Path: "/search", Summary: "Search for songs", Query: []APIParam{{Name: "q", Type: "string", Description: "What to search for."}}, Response: APISongInputs{}, Handler: search},
+	}
+	for i, rt := range routes {
+		if rt.Status == 0 {
+			routes[i].Status = http.StatusOK
+		}
+		if rt.Admin {
+			routes[i].Handler = h.RequireAdmin(rt.Handler)
+		}
+	}
+	return routes
+}
+
+// writeJSON answers an API request with v as JSON.
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// apiParty returns the party of a request as an API resource.
+func (h *Handler) apiParty(r *http.Request, partyID string) (APIParty, error) {
+	started, currentRound, showResults, err := h.service.GetPartyState(r.Context(), partyID)
+	if err != nil {
+		return APIParty{}, err
+	}
+	name, err := h.service.GetPartyName(r.Context(), partyID)
+	if err != nil {
+		return APIParty{}, err
+	}
+	totalSongs, err := h.service.GetTotalSongs(r.Context(), partyID)
+	if err != nil {
+		return APIParty{}, err
+	}
+	return APIParty{
+		ID:           partyID,
+		Name:         name,
+		Started:      started,
+		CurrentRound: currentRound,
+		ShowResults:  showResults,
+		TotalSongs:   totalSongs,
+	}, nil
+}
+
+// apiRound returns the query parameter round, or 0 if it is left out.
+func apiRound(r *http.Request) (int, error) {
+	s := r.URL.Query().Get("round")
+	if s == "" {
+		return 0, nil
+	}
+	round, err := strconv.Atoi(s)
+	if err != nil || round < 0 {
+		return 0, newError(CodeInvalidRound)
+	}
+	return round, nil
+}
+
+func (h *Handler) apiOpenAPI(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(openAPIDocument)
+}
+
+func (h *Handler) apiCreateParty(w http.ResponseWriter, r *http.Request) {
+	var req APICreateParty
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.writeError(w, r, newError(CodeInvalidRequest, err))
+		return
+	}
+	if req.SongsPerPlayer == 0 {
+		req.SongsPerPlayer = DefaultSongsPerPlayer
+	}
+
+	id, adminToken, err := h.service.CreateParty(r.Context(), req.Name, req.SongsPerPlayer)
+	if err != nil {
+		h.writeError(w, r, err)
+		return
+	}
+	p, err := h.apiParty(r, id)
+	if err != nil {
+		h.writeError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, APICreatedParty{APIParty: p, AdminToken: adminToken})
+}
+
+func (h *Handler) apiGetParty(w http.ResponseWriter, r *http.Request) {
+	p, err := h.apiParty(r, h.getPartyID(r))
+	if err != nil {
+		h.writeError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, p)
+}
+
+func (h *Handler) apiStart(w http.ResponseWriter, r *http.Request) {
+	partyID := h.getPartyID(r)
+	if err := h.service.StartCompetition(r.Context(), partyID); err != nil {
+		h.writeError(w, r, err)
+		return
+	}
+	h.apiGetParty(w, r)
+}
+
+func (h *Handler) apiNext(w http.ResponseWriter, r *http.Request) {
+	partyID := h.getPartyID(r)
+	started, _, _, err := h.service.GetPartyState(r.Context(), partyID)
+	if err != nil {
+		h.writeError(w, r, err)
+		return
+	}
+	if !started {
+		h.writeError(w, r, newError(CodeNotStarted))
+		return
+	}
+	if err := h.service.NextRound(r.Context(), partyID); err != nil {
+		h.writeError(w, r, err)
+		return
+	}
+	h.apiGetParty(w, r)
+}
+
+func (h *Handler) apiGetUsers(w http.ResponseWriter, r *http.Request) {
+	partyID := h.getPartyID(r)
+	users, err := h.service.GetUsers(r.Context(), partyID)
+	if err != nil {
+		h.writeError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, APIUsers{Users: nonNil(users)})
+}
+
+func (h *Handler) apiJoin(w http.ResponseWriter, r *http.Request) {
+	partyID := h.getPartyID(r)
+	var req APIJoinParty
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.writeError(w, r, newError(CodeInvalidRequest, err))
+		return
+	}
+
+	userID, token, err := h.service.JoinParty(r.Context(), partyID, req.Name, req.Songs)
+	if err != nil {
+		h.writeError(w, r, err)
+		return
+	}
+	h.setSession(w, r, partyID, userID, token)
+	writeJSON(w, http.StatusCreated, User{ID: userID, Name: req.Name})
+}
+
+func (h *Handler) apiGetMySongs(w http.ResponseWriter, r *http.Request) {
+	partyID := h.getPartyID(r)
+	user, ok := h.currentUser(r, partyID)
+	if !ok {
+		h.writeError(w, r, newError(CodeNoSession))
+		return
+	}
+
+	songs, err := h.service.GetUserSongs(r.Context(), partyID, user.ID)
+	if err != nil {
+		h.writeError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, APISongs{Songs: nonNil(songs)})
+}
+
+func (h *Handler) apiUpdateMySongs(w http.ResponseWriter, r *http.Request) {
+	partyID := h.getPartyID(r)
+	user, ok := h.currentUser(r, partyID)
+	if !ok {
+		h.writeError(w, r, newError(CodeNoSession))
+		return
+	}
+
+	var req APISongInputs
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.writeError(w, r, newError(CodeInvalidRequest, err))
+		return
+	}
+	songs, err := h.service.UpdateUserSongs(r.Context(), partyID, user.ID, req.Songs)
+	if err != nil {
+		h.writeError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, APISongs{Songs: nonNil(songs)})
+}
+
+func (h *Handler) apiGetRound(w http.ResponseWriter, r *http.Request) {
+	partyID := h.getPartyID(r)
+	number, err := strconv.Atoi(r.PathValue("round"))
+	if err != nil || number < 1 {
+		h.writeError(w, r, newError(CodeInvalidRound))
+		return
+	}
+
+	started, currentRound, showResults, err := h.service.GetPartyState(r.Context(), partyID)
+	if err != nil {
+		h.writeError(w, r, err)
+		return
+	}
+	if !started {
+		h.writeError(w, r, newError(CodeNotStarted))
+		return
+	}
+	if number > currentRound {
+		h.writeError(w, r, newError(CodeRoundNotRevealed, number))
+		return
+	}
+
+	round := APIRound{Number: number, Revealed: number < currentRound || showResults}
+	if round.Revealed {
+		round.Songs, err = h.service.GetRoundResults(r.Context(), partyID, number)
+		if err != nil {
+			h.writeError(w, r, err)
+			return
+		}
+	} else {
+		songs, err := h.service.GetRoundSongs(r.Context(), partyID, number)
+		if err != nil {
+			h.writeError(w, r, err)
+			return
+		}
+		for _, s := range songs {
+			round.Songs = append(round.Songs, SongResult{ID: s.ID, Title: s.Title, YouTubeID: s.YouTubeID, ThumbnailURL: s.ThumbnailURL, Owners: []User{}})
+		}
+
+		deadline, err := h.service.GetRoundDeadline(r.Context(), partyID)
+		if err != nil {
+			h.writeError(w, r, err)
+			return
+		}
+		if !deadline.IsZero() {
+			round.Deadline = &deadline
+		}
+	}
+	round.Songs = nonNil(round.Songs)
+	writeJSON(w, http.StatusOK, round)
+}
+
+func (h *Handler) apiGetGuesses(w http.ResponseWriter, r *http.Request) {
+	partyID := h.getPartyID(r)
+	user, ok := h.currentUser(r, partyID)
+	if !ok {
+		h.writeError(w, r, newError(CodeNoSession))
+		return
+	}
+
+	guessed, err := h.service.GetUserGuesses(r.Context(), partyID, user.Name)
+	if err != nil {
+		h.writeError(w, r, err)
+		return
+	}
+	wagers, err := h.service.GetUserWagers(r.Context(), partyID, user.Name)
+	if err != nil {
+		h.writeError(w, r, err)
+		return
+	}
+	users, err := h.service.GetUsers(r.Context(), partyID)
+	if err != nil {
+		h.writeError(w, r, err)
+		return
+	}
+	userIDs := make(map[string]int, len(users))
+	for _, u := range users {
+		userIDs[u.Name] = u.ID
+	}
+
+	guesses := []APIGuess{}
+	for songID, name := range guessed {
+		guesses = append(guesses, APIGuess{SongID: songID, GuessedUserID: userIDs[name], Wager: wagers[songID]})
+	}
+	slices.SortFunc(guesses, func(a, b APIGuess) int { return a.SongID - b.SongID })
+	writeJSON(w, http.StatusOK, APIGuesses{Guesses: guesses})
+}
+
+func (h *Handler) apiGuess(w http.ResponseWriter, r *http.Request) {
+	partyID := h.getPartyID(r)
+	guesser, ok := h.currentUser(r, partyID)
+	if !ok {
+		h.writeError(w, r, newError(CodeNoSession))
+		return
+	}
+
+	var req APIGuess
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.writeError(w, r, newError(CodeInvalidRequest, err))
+		return
+	}
+	if req.Wager == 0 {
+		req.Wager = MinWager
+	}
+	if err := h.service.SubmitGuessWithWager(r.Context(), guesser.ID, req.SongID, req.GuessedUserID, req.Wager); err != nil {
+		h.writeError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, req)
+}
+
+func (h *Handler) apiLeaderboard(w http.ResponseWriter, r *http.Request) {
+	partyID := h.getPartyID(r)
+	round, err := apiRound(r)
+	if err != nil {
+		h.writeError(w, r, err)
+		return
+	}
+	entries, err := h.service.GetLeaderboard(r.Context(), partyID, round)
+	if err != nil {
+		h.writeError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, APILeaderboard{Entries: nonNil(entries)})
+}
+
+func (h *Handler) apiTeamLeaderboard(w http.ResponseWriter, r *http.Request) {
+	partyID := h.getPartyID(r)
+	round, err := apiRound(r)
+	if err != nil {
+		h.writeError(w, r, err)
+		return
+	}
+	entries, err := h.service.GetTeamLeaderboard(r.Context(), partyID, round)
+	if err != nil {
+		h.writeError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, APITeamLeaderboard{Entries: nonNil(entries)})
+}
+
+func (h *Handler) apiSearch(w http.ResponseWriter, r *http.Request) {
+	songs := []SongInput{}
+	if query := r.URL.Query().Get("q"); query != "" {
+		var err error
+		songs, err = h.service.SearchMusic(r.Context(), query)
+		if err != nil {
+			h.writeError(w, r, err)
+			return
+		}
+	}
+	writeJSON(w, http.StatusOK, APISongInputs{Songs: nonNil(songs)})
+}
+
+// nonNil returns s, or an empty slice if s is nil, so lists are never
+// encoded as null.
+func nonNil[T any](s []T) []T {
+	if s == nil {
+		return []T{}
+	}
+	return s
+}
@@ -0,0 +1,279 @@
+package party_test
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"flag"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/jehaj/new-year-wrapped/internal/db"
+	"github.com/jehaj/new-year-wrapped/internal/party"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+var update = flag.Bool("update", false, "regenerate openapi.json")
+
+func newAPIServer(t *testing.T) (*party.Service, *party.Handler, *http.ServeMux) {
+	database, _ := sql.Open("sqlite3", ":memory:")
+	t.Cleanup(func() { database.Close() })
+	_, _ = db.Migrate(database)
+
+	service := party.NewService(database, nil)
+	handler := party.NewHandler(service)
+	mux := http.NewServeMux()
+	for _, route := range handler.APIRoutes(nil) {
+		mux.HandleFunc(route.Pattern(), route.Handler)
+	}
+	return service, handler, mux
+}
+
+func TestOpenAPI(t *testing.T) {
+	_, handler, mux := newAPIServer(t)
+
+	generated, err := party.OpenAPI(handler.APIRoutes(nil))
+	if err != nil {
+		t.Fatalf("OpenAPI failed: %v", err)
+	}
+	if *update {
+		if err := os.WriteFile("openapi.json", generated, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	t.Run("Document matches the routes", func(t *testing.T) {
+		// Given: The routes of the API
+		// When: The OpenAPI document is generated from them
+		// Then: It matches the document that is served
+		req := httptest.NewRequest("GET", party.APIPrefix+"/openapi.json", nil)
+		rr := httptest.NewRecorder()
+		mux.ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusOK {
+			t.Fatalf("expected status 200, got %d", rr.Code)
+		}
+		if !bytes.Equal(rr.Body.Bytes(), generated) {
+			t.Error("openapi.json is out of date, run go test ./internal/party -run TestOpenAPI -update")
+		}
+	})
+
+	t.Run("Document describes every route", func(t *testing.T) {
+		var doc struct {
+			OpenAPI string                                `json:"openapi"`
+			Paths   map[string]map[string]json.RawMessage `json:"paths"`
+		}
+		if err := json.Unmarshal(generated, &doc); err != nil {
+			t.Fatalf("invalid document: %v", err)
+		}
+		if !strings.HasPrefix(doc.OpenAPI, "3.") {
+			t.Errorf("expected OpenAPI 3, got %q", doc.OpenAPI)
+		}
+		for _, route := range handler.APIRoutes(nil) {
+			if _, ok := doc.Paths[party.APIPrefix+route.Path][strings.ToLower(route.Method)]; !ok {
+				t.Errorf("%s is not documented", route.Pattern())
+			}
+		}
+	})
+}
+
+func TestAPI(t *testing.T) {
+	service, _, mux := newAPIServer(t)
+	ctx := context.Background()
+
+	// do makes a request to the API and decodes the JSON object it answers
+	// with into out.
+	do := func(method, path, body string, header http.Header, out any) *httptest.ResponseRecorder {
+		t.Helper()
+		req := httptest.NewRequest(method, party.APIPrefix+path, strings.NewReader(body))
+		for k, v := range header {
+			req.Header[k] = v
+		}
+		rr := httptest.NewRecorder()
+		mux.ServeHTTP(rr, req)
+
+		data, _ := io.ReadAll(rr.Body)
+		if !bytes.HasPrefix(data, []byte("{")) {
+			t.Errorf("%s %s: expected a JSON object, got %s", method, path, data)
+		}
+		if out != nil {
+			json.Unmarshal(data, out)
+		}
+		rr.Body = bytes.NewBuffer(data)
+		return rr
+	}
+
+	var created struct {
+		ID         string `json:"id"`
+		Name       string `json:"name"`
+		AdminToken string `json:"admin_token"`
+	}
+	t.Run("Create a party", func(t *testing.T) {
+		rr := do("POST", "/parties", `{"name": "API Party", "songs_per_player": 1}`, nil, &created)
+		if rr.Code != http.StatusCreated || created.ID == "" || created.AdminToken == "" || created.Name != "API Party" {
+			t.Fatalf("unexpected response %d: %s", rr.Code, rr.Body)
+		}
+	})
+	admin := http.Header{"Authorization": {"Bearer " + created.AdminToken}}
+	partyPath := "/parties/" + created.ID
+
+	sessions := make(map[string]http.Header)
+	userIDs := make(map[string]int)
+	t.Run("Join the party", func(t *testing.T) {
+		for _, name := range []string{"Alice", "Bob"} {
+			var user party.User
+			rr := do("POST", partyPath+"/users", `{"name": "`+name+`", "songs": [{"title": "`+name+`'s Song"}]}`, nil, &user)
+			if rr.Code != http.StatusCreated || user.Name != name {
+				t.Fatalf("unexpected response %d: %s", rr.Code, rr.Body)
+			}
+			cookie := rr.Result().Cookies()[0]
+			sessions[name] = http.Header{"Cookie": {cookie.Name + "=" + cookie.Value}}
+			userIDs[name] = user.ID
+		}
+
+		var users party.APIUsers
+		do("GET", partyPath+"/users", "", nil, &users)
+		if len(users.Users) != 2 {
+			t.Errorf("expected 2 users, got %+v", users)
+		}
+	})
+
+	t.Run("Start needs the admin token", func(t *testing.T) {
+		// Given: A party with two players
+		// When: The competition is started with and without the admin token
+		// Then: Only the admin can start it, and gets the started party back
+		if rr := do("POST", partyPath+"/start", "", nil, nil); rr.Code != http.StatusUnauthorized {
+			t.Errorf("expected status 401, got %d", rr.Code)
+		}
+		var p party.APIParty
+		rr := do("POST", partyPath+"/start", "", admin, &p)
+		if rr.Code != http.StatusOK || !p.Started || p.CurrentRound != 1 || p.TotalSongs != 2 {
+			t.Errorf("unexpected response %d: %s", rr.Code, rr.Body)
+		}
+	})
+
+	var round party.APIRound
+	t.Run("Guess in the open round", func(t *testing.T) {
+		// Given: A started party
+		// When: Alice guesses Bob's song in round 1
+		// Then: The guess is listed as hers, and the songs' owners and the
+		// round's leaderboard stay hidden
+		do("GET", partyPath+"/rounds/1", "", nil, &round)
+		if round.Number != 1 || round.Revealed || len(round.Songs) != 2 {
+			t.Fatalf("unexpected round %+v", round)
+		}
+		bobSongs, _ := service.GetUserSongs(ctx, created.ID, userIDs["Bob"])
+		for _, s := range round.Songs {
+			if len(s.Owners) != 0 {
+				t.Errorf("expected no owners before the reveal, got %+v", s)
+			}
+		}
+
+		body := `{"song_id": ` + strconv.Itoa(bobSongs[0].ID) + `, "guessed_user_id": ` + strconv.Itoa(userIDs["Bob"]) + `}`
+		if rr := do("POST", partyPath+"/me/guesses", body, nil, nil); rr.Code != http.StatusUnauthorized {
+			t.Errorf("expected status 401 without a session, got %d", rr.Code)
+		}
+		if rr := do("POST", partyPath+"/me/guesses", body, sessions["Alice"], nil); rr.Code != http.StatusCreated {
+			t.Fatalf("expected status 201, got %d: %s", rr.Code, rr.Body)
+		}
+
+		var guesses party.APIGuesses
+		do("GET", partyPath+"/me/guesses", "", sessions["Alice"], &guesses)
+		want := party.APIGuess{SongID: bobSongs[0].ID, GuessedUserID: userIDs["Bob"], Wager: party.MinWager}
+		if len(guesses.Guesses) != 1 || guesses.Guesses[0] != want {
+			t.Errorf("expected %+v, got %+v", want, guesses.Guesses)
+		}
+
+		for _, path := range []string{"/leaderboard?round=1", "/leaderboard/teams?round=1"} {
+			var resp struct{ Code string }
+			rr := do("GET", partyPath+path, "", nil, &resp)
+			if rr.Code != http.StatusForbidden || resp.Code != string(party.CodeRoundNotRevealed) {
+				t.Errorf("%s: expected status 403 before the reveal, got %d: %s", path, rr.Code, rr.Body)
+			}
+		}
+	})
+
+	t.Run("Reveal the round", func(t *testing.T) {
+		// Given: A round with a correct guess by Alice
+		// When: The admin reveals the round
+		// Then: The round lists the owners and Alice leads the leaderboard
+		var p party.APIParty
+		do("POST", partyPath+"/next", "", http.Header{"X-Admin-Token": {created.AdminToken}}, &p)
+		if !p.ShowResults {
+			t.Errorf("expected the round to be revealed, got %+v", p)
+		}
+
+		do("GET", partyPath+"/rounds/1", "", nil, &round)
+		if !round.Revealed || len(round.Songs) != 2 || len(round.Songs[0].Owners) != 1 {
+			t.Errorf("expected a revealed round with owners, got %+v", round)
+		}
+
+		var leaderboard party.APILeaderboard
+		do("GET", partyPath+"/leaderboard", "", nil, &leaderboard)
+		if len(leaderboard.Entries) != 2 || leaderboard.Entries[0].UserName != "Alice" || leaderboard.Entries[0].Score != 1 {
+			t.Errorf("unexpected leaderboard %+v", leaderboard)
+		}
+	})
+
+	t.Run("Errors are JSON with a status", func(t *testing.T) {
+		tests := []struct {
+			path string
+			code int
+		}{
+			{"/parties/missing", http.StatusNotFound},
+			{"/parties/missing/leaderboard", http.StatusNotFound},
+			{partyPath + "/rounds/2", http.StatusForbidden},
+			{partyPath + "/rounds/zero", http.StatusBadRequest},
+			{partyPath + "/me/songs", http.StatusUnauthorized},
+		}
+		for _, tt := range tests {
+			var resp struct{ Error, Code string }
+			rr := do("GET", tt.path, "", nil, &resp)
+			if rr.Code != tt.code || resp.Error == "" {
+				t.Errorf("%s: expected status %d with an error, got %d: %s", tt.path, tt.code, rr.Code, rr.Body)
+			}
+		}
+	})
+
+	t.Run("Empty lists are not null", func(t *testing.T) {
+		rr := do("GET", "/search", "", nil, nil)
+		if strings.TrimSpace(rr.Body.String()) != `{"songs":[]}` {
+			t.Errorf("expected an empty list, got %s", rr.Body)
+		}
+	})
+}
+
+func TestAPI_SearchRateLimit(t *testing.T) {
+	service, handler, _ := newAPIServer(t)
+	service.SetMusicProvider(party.DefaultFakeCatalog())
+	mux := http.NewServeMux()
+	for _, route := range handler.APIRoutes(party.NewRateLimiter(1, 1)) {
+		mux.HandleFunc(route.Pattern(), route.Handler)
+	}
+	search := func() *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		mux.ServeHTTP(rr, httptest.NewRequest("GET", party.APIPrefix+"/search?q=a", nil))
+		return rr
+	}
+
+	// Given: A search limit of 1 request in a burst
+	// When: A client searches twice at once
+	// Then: The second search is rejected with 429 and a JSON error
+	if rr := search(); rr.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", rr.Code, rr.Body)
+	}
+	rr := search()
+	if rr.Code != http.StatusTooManyRequests {
+		t.Fatalf("expected status 429, got %d", rr.Code)
+	}
+	var resp struct{ Error, Code string }
+	if err := json.NewDecoder(rr.Body).Decode(&resp); err != nil || resp.Error == "" || resp.Code != string(party.CodeTooManyRequests) {
+		t.Errorf("expected a JSON error with code %q, got %v: %+v", party.CodeTooManyRequests, err, resp)
+	}
+}
@@ -0,0 +1,314 @@
+package party
+
+import (
+	"container/list"
+	"context"
+	"fmt"
+	"image"
+	"image/color"
+	_ "image/jpeg"
+	"image/png"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fogleman/gg"
+	"github.com/golang/freetype/truetype"
+	"github.com/jehaj/new-year-wrapped/internal/i18n"
+	"golang.org/x/image/draw"
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/gofont/gobold"
+	"golang.org/x/image/font/gofont/goregular"
+	_ "golang.org/x/image/webp"
+)
+
+// Dimensions of a Wrapped card, sized for phone stories.
+const (
+	CardWidth  = 1080
+	CardHeight = 1920
+)
+
+// maxCardSongs is how many songs fit on a card.
+const maxCardSongs = 5
+
+// DefaultThumbnailHosts are the hosts song thumbnails are fetched from.
+// Thumbnail URLs are supplied by players, so other hosts are never contacted.
+var DefaultThumbnailHosts = []string{"i.ytimg.com", "lh3.googleusercontent.com", "yt3.ggpht.com"}
+
+const (
+	maxThumbnailBytes   = 5 << 20
+	maxThumbnailEntries = 512
+)
+
+// ThumbnailCache fetches song thumbnails and keeps them in memory, evicting
+// the least recently used once full. Images that are missing or can't be
+// decoded are cached as nil, so they are only requested once, while
+// cancelled requests and server or network errors are tried again next time.
+type ThumbnailCache struct {
+	client  *http.Client
+	hosts   []string
+	mu      sync.Mutex
+	entries map[string]*list.Element
+	order   *list.List // Most recently used at the front.
+}
+
+type thumbnailEntry struct {
+	url string
+	img image.Image
+}
+
+// NewThumbnailCache creates a cache that only fetches from the given hosts.
+func NewThumbnailCache(client *http.Client, hosts ...string) *ThumbnailCache {
+	return &ThumbnailCache{
+		client:  client,
+		hosts:   hosts,
+		entries: make(map[string]*list.Element),
+		order:   list.New(),
+	}
+}
+
+// Get returns the thumbnail at rawURL, or nil if it can't be fetched.
+func (c *ThumbnailCache) Get(ctx context.Context, rawURL string) image.Image {
+	if rawURL == "" {
+		return nil
+	}
+
+	c.mu.Lock()
+	if el, ok := c.entries[rawURL]; ok {
+		c.order.MoveToFront(el)
+		c.mu.Unlock()
+		return el.Value.(*thumbnailEntry).img
+	}
+	c.mu.Unlock()
+
+	img, definite := c.fetch(ctx, rawURL)
+	if !definite {
+		return nil
+	}
+
+	c.mu.Lock()
+	c.add(rawURL, img)
+	c.mu.Unlock()
+	return img
+}
+
+// add stores a thumbnail, evicting the least recently used one if the cache
+// is full. c.mu must be held.
+func (c *ThumbnailCache) add(rawURL string, img image.Image) {
+	if el, ok := c.entries[rawURL]; ok {
+		c.order.Remove(el)
+	}
+	c.entries[rawURL] = c.order.PushFront(&thumbnailEntry{url: rawURL, img: img})
+	for c.order.Len() > maxThumbnailEntries {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*thumbnailEntry).url)
+	}
+}
+
+// Len returns the number of cached thumbnails.
+func (c *ThumbnailCache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.order.Len()
+}
+
+// fetch downloads the thumbnail at rawURL. definite is false if the fetch
+// failed for a reason that may pass, so the result must not be cached.
+func (c *ThumbnailCache) fetch(ctx context.Context, rawURL string) (img image.Image, definite bool) {
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "https" && u.Scheme != "http") || !slices.Contains(c.hosts, u.Host) {
+		return nil, true
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, true
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, false
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound, http.StatusGone:
+		return nil, true
+	default:
+		return nil, false
+	}
+
+	img, _, err = image.Decode(io.LimitReader(resp.Body, maxThumbnailBytes))
+	if err != nil {
+		// A body cut short by a cancelled context is not a broken image
+		return nil, ctx.Err() == nil
+	}
+	return img, true
+}
+
+var (
+	fontsOnce             sync.Once
+	regularFont, boldFont *truetype.Font
+)
+
+func cardFace(bolded bool, size float64) font.Face {
+	fontsOnce.Do(func() {
+		regularFont, _ = truetype.Parse(goregular.TTF)
+		boldFont, _ = truetype.Parse(gobold.TTF)
+	})
+	f := regularFont
+	if bolded {
+		f = boldFont
+	}
+	return truetype.NewFace(f, &truetype.Options{Size: size})
+}
+
+// RenderWrappedCard draws a player's Wrapped as a story-sized image with its
+// text in lang. Songs whose thumbnail is missing get a placeholder instead.
+func RenderWrappedCard(w Wrapped, lang string, thumbnail func(url string) image.Image) image.Image {
+	const margin = 90
+	dc := gg.NewContext(CardWidth, CardHeight)
+
+	bg := gg.NewLinearGradient(0, 0, CardWidth, CardHeight)
+	bg.AddColorStop(0, parseHex("#1db954"))
+	bg.AddColorStop(0.45, parseHex("#191414"))
+	bg.AddColorStop(1, parseHex("#121212"))
+	dc.SetFillStyle(bg)
+	dc.DrawRectangle(0, 0, CardWidth, CardHeight)
+	dc.Fill()
+
+	dc.SetHexColor("#ffffff")
+	dc.SetFontFace(cardFace(true, 44))
+	dc.DrawString(i18n.T(lang, "card.title"), margin, 150)
+	dc.SetFontFace(cardFace(false, 40))
+	dc.DrawString(truncate(dc, w.PartyName, CardWidth-2*margin), margin, 210)
+
+	dc.SetFontFace(cardFace(true, 96))
+	dc.DrawString(truncate(dc, w.UserName, CardWidth-2*margin), margin, 400)
+
+	dc.SetHexColor("#1ed760")
+	dc.SetFontFace(cardFace(true, 220))
+	dc.DrawString(fmt.Sprintf("#%d", w.Rank), margin, 640)
+	dc.SetHexColor("#ffffff")
+	dc.SetFontFace(cardFace(false, 48))
+	dc.DrawString(i18n.Plural(lang, "card.out_of", w.Players, w.Score), margin, 720)
+
+	dc.SetFontFace(cardFace(true, 52))
+	dc.DrawString(i18n.T(lang, "card.your_songs"), margin, 860)
+
+	const thumbSize, rowHeight = 140, 170
+	y := 900.0
+	for i, song := range w.Songs {
+		if i == maxCardSongs {
+			break
+		}
+		drawThumbnail(dc, thumbnail(song.ThumbnailURL), song.Title, margin, y, thumbSize)
+
+		textX := float64(margin + thumbSize + 40)
+		textWidth := CardWidth - textX - margin
+		dc.SetHexColor("#ffffff")
+		dc.SetFontFace(cardFace(true, 40))
+		dc.DrawString(truncate(dc, song.Title, textWidth), textX, y+60)
+		dc.SetHexColor("#b3b3b3")
+		dc.SetFontFace(cardFace(false, 34))
+		guessed := i18n.T(lang, "card.nobody_guessed")
+		if n := len(song.GuessedBy); n > 0 {
+			guessed = i18n.T(lang, "card.guessed_by", n)
+		}
+		dc.DrawString(guessed, textX, y+110)
+		y += rowHeight
+	}
+
+	y = max(y+40, 1640)
+	dc.SetHexColor("#ffffff")
+	dc.SetFontFace(cardFace(false, 40))
+	dc.DrawString(i18n.T(lang, "card.knew_you_best"), margin, y)
+	dc.SetFontFace(cardFace(true, 60))
+	friend := i18n.T(lang, "card.mystery")
+	if w.KnewYouBest != nil {
+		friend = i18n.T(lang, "card.friend", w.KnewYouBest.UserName, w.KnewYouBest.Correct, w.KnewYouBest.Songs)
+	}
+	dc.DrawString(truncate(dc, friend, CardWidth-2*margin), margin, y+80)
+
+	return dc.Image()
+}
+
+// drawThumbnail draws a square, center-cropped thumbnail, or a placeholder
+// with the song's first letter when img is nil.
+func drawThumbnail(dc *gg.Context, img image.Image, title string, x, y, size float64) {
+	dc.DrawRoundedRectangle(x, y, size, size, 16)
+	if img == nil {
+		dc.SetHexColor("#282828")
+		dc.Fill()
+		initial := "♪"
+		if r := []rune(strings.TrimSpace(title)); len(r) > 0 {
+			initial = strings.ToUpper(string(r[0]))
+		}
+		dc.SetHexColor("#1db954")
+		dc.SetFontFace(cardFace(true, size/2))
+		dc.DrawStringAnchored(initial, x+size/2, y+size/2, 0.5, 0.35)
+		return
+	}
+
+	b := img.Bounds()
+	side := min(b.Dx(), b.Dy())
+	crop := image.Rect(0, 0, side, side).Add(image.Pt(b.Min.X+(b.Dx()-side)/2, b.Min.Y+(b.Dy()-side)/2))
+	scaled := image.NewRGBA(image.Rect(0, 0, int(size), int(size)))
+	draw.ApproxBiLinear.Scale(scaled, scaled.Bounds(), img, crop, draw.Src, nil)
+
+	dc.Clip()
+	dc.DrawImage(scaled, int(x), int(y))
+	dc.ResetClip()
+}
+
+// truncate shortens s with an ellipsis until it fits within width with the
+// current font.
+func truncate(dc *gg.Context, s string, width float64) string {
+	if w, _ := dc.MeasureString(s); w <= width {
+		return s
+	}
+	r := []rune(s)
+	for len(r) > 0 {
+		r = r[:len(r)-1]
+		if w, _ := dc.MeasureString(string(r) + "…"); w <= width {
+			break
+		}
+	}
+	return strings.TrimSpace(string(r)) + "…"
+}
+
+func parseHex(hex string) color.Color {
+	v, _ := strconv.ParseUint(strings.TrimPrefix(hex, "#"), 16, 32)
+	return color.RGBA{R: uint8(v >> 16), G: uint8(v >> 8), B: uint8(v), A: 255}
+}
+
+// WrappedCard serves a player's Wrapped as a PNG image for sharing.
+func (h *Handler) WrappedCard(w http.ResponseWriter, r *http.Request) {
+	partyID := h.getPartyID(r)
+	userID, err := strconv.Atoi(r.PathValue("user"))
+	if err != nil {
+		h.writeError(w, r, newError(CodeInvalidPlayer))
+		return
+	}
+
+	wrapped, err := h.service.GetWrapped(r.Context(), partyID, userID)
+	if err != nil {
+		h.writeError(w, r, err)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+	img := RenderWrappedCard(wrapped, h.lang(r), func(url string) image.Image {
+		return h.thumbnails.Get(ctx, url)
+	})
+
+	w.Header().Set("Content-Type", "image/png")
+	w.Header().Set("Cache-Control", "private, max-age=300")
+	png.Encode(w, img)
+}
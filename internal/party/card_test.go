@@ -0,0 +1,151 @@
+package party_test
+
+import (
+	"context"
+	"image"
+	"image/color"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/jehaj/new-year-wrapped/internal/i18n"
+	"github.com/jehaj/new-year-wrapped/internal/party"
+)
+
+func TestRenderWrappedCard(t *testing.T) {
+	// Given: A Wrapped whose songs have no thumbnails
+	// When: The card is rendered
+	// Then: A story-sized image is produced with placeholders
+	w := party.Wrapped{
+		PartyName: "Nytår",
+		UserName:  "Alice",
+		Rank:      1,
+		Players:   3,
+		Score:     7,
+		Songs: []party.WrappedSong{
+			{Title: "Song 1", GuessedBy: []string{"Bob"}},
+			{Title: strings.Repeat("A very long song title ", 10), ThumbnailURL: "https://example.com/missing.jpg"},
+		},
+		KnewYouBest: &party.FriendStat{UserName: "Bob", Correct: 1, Songs: 2},
+	}
+
+	img := party.RenderWrappedCard(w, i18n.Danish, func(string) image.Image { return nil })
+
+	if b := img.Bounds(); b.Dx() != party.CardWidth || b.Dy() != party.CardHeight {
+		t.Errorf("expected %dx%d card, got %dx%d", party.CardWidth, party.CardHeight, b.Dx(), b.Dy())
+	}
+}
+
+func TestThumbnailCache(t *testing.T) {
+	var requests, flakyRequests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		if r.URL.Path == "/flaky.png" && flakyRequests.Add(1) == 1 {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		if r.URL.Path != "/thumb.png" && r.URL.Path != "/flaky.png" {
+			http.NotFound(w, r)
+			return
+		}
+		img := image.NewRGBA(image.Rect(0, 0, 4, 2))
+		img.Set(0, 0, color.White)
+		png.Encode(w, img)
+	}))
+	defer server.Close()
+
+	host := strings.TrimPrefix(server.URL, "http://")
+	cache := party.NewThumbnailCache(server.Client(), host)
+	ctx := context.Background()
+
+	t.Run("Fetches once and caches", func(t *testing.T) {
+		for range 2 {
+			if img := cache.Get(ctx, server.URL+"/thumb.png"); img == nil || img.Bounds().Dx() != 4 {
+				t.Fatalf("expected 4px wide thumbnail, got %v", img)
+			}
+		}
+		if n := requests.Load(); n != 1 {
+			t.Errorf("expected 1 request, got %d", n)
+		}
+	})
+
+	t.Run("Missing images are cached as nil", func(t *testing.T) {
+		requests.Store(0)
+		for range 2 {
+			if img := cache.Get(ctx, server.URL+"/missing.png"); img != nil {
+				t.Error("expected nil for missing thumbnail")
+			}
+		}
+		if n := requests.Load(); n != 1 {
+			t.Errorf("expected 1 request, got %d", n)
+		}
+	})
+
+	t.Run("Server errors are not cached", func(t *testing.T) {
+		// Given: A thumbnail whose server fails the first request
+		// When: It is fetched twice
+		// Then: The second fetch tries again and gets the image
+		if img := cache.Get(ctx, server.URL+"/flaky.png"); img != nil {
+			t.Error("expected nil while the server fails")
+		}
+		if img := cache.Get(ctx, server.URL+"/flaky.png"); img == nil {
+			t.Error("expected the thumbnail once the server recovers")
+		}
+	})
+
+	t.Run("Cancelled fetches are not cached", func(t *testing.T) {
+		// Given: A fetch whose context is cancelled
+		// When: The thumbnail is fetched again with a live context
+		// Then: It is fetched from the server
+		fresh := party.NewThumbnailCache(server.Client(), host)
+		cancelled, cancel := context.WithCancel(ctx)
+		cancel()
+		if img := fresh.Get(cancelled, server.URL+"/thumb.png"); img != nil {
+			t.Error("expected nil for a cancelled fetch")
+		}
+		if img := fresh.Get(ctx, server.URL+"/thumb.png"); img == nil {
+			t.Error("expected the thumbnail after a cancelled fetch")
+		}
+	})
+
+	t.Run("Least recently used thumbnails are evicted", func(t *testing.T) {
+		// Given: A cache holding a thumbnail that keeps being used
+		// When: Many other thumbnails are fetched
+		// Then: The cache stays bounded, keeps the used thumbnail and evicts
+		// the oldest
+		fresh := party.NewThumbnailCache(server.Client(), host)
+		fresh.Get(ctx, server.URL+"/thumb.png")
+		for i := range 1000 {
+			fresh.Get(ctx, server.URL+"/missing-"+strconv.Itoa(i)+".png")
+			fresh.Get(ctx, server.URL+"/thumb.png")
+		}
+		if n := fresh.Len(); n >= 1000 {
+			t.Errorf("expected the cache to be bounded, got %d entries", n)
+		}
+
+		requests.Store(0)
+		fresh.Get(ctx, server.URL+"/thumb.png")
+		if n := requests.Load(); n != 0 {
+			t.Errorf("expected the used thumbnail to be cached, got %d requests", n)
+		}
+		fresh.Get(ctx, server.URL+"/missing-0.png")
+		if n := requests.Load(); n != 1 {
+			t.Errorf("expected the oldest thumbnail to be evicted, got %d requests", n)
+		}
+	})
+
+	t.Run("Other hosts are never contacted", func(t *testing.T) {
+		requests.Store(0)
+		other := party.NewThumbnailCache(server.Client(), "i.ytimg.com")
+		if img := other.Get(ctx, server.URL+"/thumb.png"); img != nil {
+			t.Error("expected nil for disallowed host")
+		}
+		if n := requests.Load(); n != 0 {
+			t.Errorf("expected no requests, got %d", n)
+		}
+	})
+}
@@ -0,0 +1,267 @@
+package party
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+
+	"github.com/jehaj/new-year-wrapped/internal/i18n"
+)
+
+// Kinds of errors. Every error from the Service with a code matches one of
+// them with errors.Is, which decides the HTTP status it is answered with.
+var (
+	ErrNotFound       = errors.New("not found")
+	ErrConflict       = errors.New("conflict")
+	ErrNotRevealed    = errors.New("not revealed")
+	ErrAlreadyStarted = errors.New("already started")
+	ErrUnauthorized   = errors.New("unauthorized")
+	ErrValidation     = errors.New("validation")
+	ErrRateLimited    = errors.New("rate limited")
+)
+
+// ErrorCode identifies an error a player or admin can act on. Handlers look
+// up its message in the language of the request.
+type ErrorCode string
+
+// Error codes returned by the Service.
+const (
+	CodePartyNotFound        ErrorCode = "party_not_found"
+	CodePartyStarted         ErrorCode = "party_started"
+	CodeNotStarted           ErrorCode = "not_started"
+	CodeNoFreePartyID        ErrorCode = "no_free_party_id"
+	CodeNoSongs              ErrorCode = "no_songs"
+	CodeSongCount            ErrorCode = "song_count"
+	CodeNameTaken            ErrorCode = "name_taken"
+	CodeUserNameMissing      ErrorCode = "user_name_missing"
+	CodeUserNotFound         ErrorCode = "user_not_found"
+	CodeSessionClaimFailed   ErrorCode = "session_claim_failed"
+	CodeInvalidSession       ErrorCode = "invalid_session"
+	CodeRoundClosed          ErrorCode = "round_closed"
+	CodeRoundNotRevealed     ErrorCode = "round_not_revealed"
+	CodeGameNotOver          ErrorCode = "game_not_over"
+	CodeSongNotFound         ErrorCode = "song_not_found"
+	CodeSongTitleMissing     ErrorCode = "song_title_missing"
+	CodeSongLookupFailed     ErrorCode = "song_lookup_failed"
+	CodeSongsPerRoundRange   ErrorCode = "songs_per_round_range"
+	CodeSongsPerPlayerRange  ErrorCode = "songs_per_player_range"
+	CodeSongsPerPlayerLocked ErrorCode = "songs_per_player_locked"
+	CodeUnknownScoringMode   ErrorCode = "unknown_scoring_mode"
+	CodeRoundTimeLimitRange  ErrorCode = "round_time_limit_range"
+	CodeUnknownTeamPolicy    ErrorCode = "unknown_team_policy"
+	CodeWagerBudgetRange     ErrorCode = "wager_budget_range"
+	CodeUnknownLanguage      ErrorCode = "unknown_language"
+	CodeTeamNameMissing      ErrorCode = "team_name_missing"
+	CodeTeamNameTaken        ErrorCode = "team_name_taken"
+	CodeTeamNotFound         ErrorCode = "team_not_found"
+	CodeNoTeams              ErrorCode = "no_teams"
+	CodeTeamAlreadyGuessed   ErrorCode = "team_already_guessed"
+	CodeGuessLocked          ErrorCode = "guess_locked"
+	CodeSongNotInRound       ErrorCode = "song_not_in_round"
+	CodeOwnSong              ErrorCode = "own_song"
+	CodeSelfGuess            ErrorCode = "self_guess"
+	CodeWagerRange           ErrorCode = "wager_range"
+	CodeWagerBudgetExceeded  ErrorCode = "wager_budget_exceeded"
+
+	// Problems with an uploaded party export.
+	CodeImportVersion        ErrorCode = "import_version"
+	CodeImportPartyName      ErrorCode = "import_party_name"
+	CodeImportRound          ErrorCode = "import_round"
+	CodeImportTeam           ErrorCode = "import_team"
+	CodeImportTeamName       ErrorCode = "import_team_name"
+	CodeImportUserDuplicate  ErrorCode = "import_user_duplicate"
+	CodeImportUserName       ErrorCode = "import_user_name"
+	CodeImportNameDuplicate  ErrorCode = "import_name_duplicate"
+	CodeImportUserTeam       ErrorCode = "import_user_team"
+	CodeImportSongDuplicate  ErrorCode = "import_song_duplicate"
+	CodeImportSongUser       ErrorCode = "import_song_user"
+	CodeImportSongTitle      ErrorCode = "import_song_title"
+	CodeImportSongShuffled   ErrorCode = "import_song_shuffled"
+	CodeImportShuffleIndex   ErrorCode = "import_shuffle_index"
+	CodeImportGuessUser      ErrorCode = "import_guess_user"
+	CodeImportGuessSong      ErrorCode = "import_guess_song"
+	CodeImportWager          ErrorCode = "import_wager"
+	CodeImportGuessDuplicate ErrorCode = "import_guess_duplicate"
+
+	// Problems with a request, found by the handlers.
+	CodeNotAdmin         ErrorCode = "unauthorized"
+	CodeNoSession        ErrorCode = "no_session"
+	CodeInvalidRequest   ErrorCode = "invalid_request"
+	CodeMissingPartyID   ErrorCode = "missing_party_id"
+	CodeMissingRound     ErrorCode = "missing_round"
+	CodeInvalidRound     ErrorCode = "invalid_round"
+	CodeInvalidPlayer    ErrorCode = "invalid_player"
+	CodeInvalidTeam      ErrorCode = "invalid_team"
+	CodeInvalidSong      ErrorCode = "invalid_song"
+	CodeInvalidSongCount ErrorCode = "invalid_song_count"
+	CodeInvalidSettings  ErrorCode = "invalid_settings"
+	CodeTooManyRequests  ErrorCode = "too_many_requests"
+)
+
+// errorKinds maps each error code to its kind. Codes without a kind are
+// failures of the server, such as running out of party IDs.
+var errorKinds = map[ErrorCode]error{
+	CodePartyNotFound:        ErrNotFound,
+	CodePartyStarted:         ErrAlreadyStarted,
+	CodeNotStarted:           ErrConflict,
+	CodeNoSongs:              ErrConflict,
+	CodeSongCount:            ErrValidation,
+	CodeNameTaken:            ErrConflict,
+	CodeUserNameMissing:      ErrValidation,
+	CodeUserNotFound:         ErrNotFound,
+	CodeSessionClaimFailed:   ErrConflict,
+	CodeInvalidSession:       ErrUnauthorized,
+	CodeRoundClosed:          ErrConflict,
+	CodeRoundNotRevealed:     ErrNotRevealed,
+	CodeGameNotOver:          ErrNotRevealed,
+	CodeSongNotFound:         ErrNotFound,
+	CodeSongTitleMissing:     ErrValidation,
+	CodeSongLookupFailed:     ErrValidation,
+	CodeSongsPerRoundRange:   ErrValidation,
+	CodeSongsPerPlayerRange:  ErrValidation,
+	CodeSongsPerPlayerLocked: ErrConflict,
+	CodeUnknownScoringMode:   ErrValidation,
+	CodeRoundTimeLimitRange:  ErrValidation,
+	CodeUnknownTeamPolicy:    ErrValidation,
+	CodeWagerBudgetRange:     ErrValidation,
+	CodeUnknownLanguage:      ErrValidation,
+	CodeTeamNameMissing:      ErrValidation,
+	CodeTeamNameTaken:        ErrConflict,
+	CodeTeamNotFound:         ErrNotFound,
+	CodeNoTeams:              ErrConflict,
+	CodeTeamAlreadyGuessed:   ErrConflict,
+	CodeGuessLocked:          ErrConflict,
+	CodeSongNotInRound:       ErrConflict,
+	CodeOwnSong:              ErrValidation,
+	CodeSelfGuess:            ErrValidation,
+	CodeWagerRange:           ErrValidation,
+	CodeWagerBudgetExceeded:  ErrValidation,
+
+	CodeImportVersion:        ErrValidation,
+	CodeImportPartyName:      ErrValidation,
+	CodeImportRound:          ErrValidation,
+	CodeImportTeam:           ErrValidation,
+	CodeImportTeamName:       ErrValidation,
+	CodeImportUserDuplicate:  ErrValidation,
+	CodeImportUserName:       ErrValidation,
+	CodeImportNameDuplicate:  ErrValidation,
+	CodeImportUserTeam:       ErrValidation,
+	CodeImportSongDuplicate:  ErrValidation,
+	CodeImportSongUser:       ErrValidation,
+	CodeImportSongTitle:      ErrValidation,
+	CodeImportSongShuffled:   ErrValidation,
+	CodeImportShuffleIndex:   ErrValidation,
+	CodeImportGuessUser:      ErrValidation,
+	CodeImportGuessSong:      ErrValidation,
+	CodeImportWager:          ErrValidation,
+	CodeImportGuessDuplicate: ErrValidation,
+
+	CodeNotAdmin:         ErrUnauthorized,
+	CodeNoSession:        ErrUnauthorized,
+	CodeInvalidRequest:   ErrValidation,
+	CodeMissingPartyID:   ErrValidation,
+	CodeMissingRound:     ErrValidation,
+	CodeInvalidRound:     ErrValidation,
+	CodeInvalidPlayer:    ErrValidation,
+	CodeInvalidTeam:      ErrValidation,
+	CodeInvalidSong:      ErrValidation,
+	CodeInvalidSongCount: ErrValidation,
+	CodeInvalidSettings:  ErrValidation,
+	CodeTooManyRequests:  ErrRateLimited,
+}
+
+// Error is an error with a code and the arguments of its message. Error
+// returns the message in the default language, as used in logs.
+type Error struct {
+	Code ErrorCode
+	Args []any
+}
+
+func newError(code ErrorCode, args ...any) error {
+	return &Error{Code: code, Args: args}
+}
+
+func (e *Error) Error() string {
+	return e.Message(i18n.Default)
+}
+
+// Is reports whether target is the kind of the error.
+func (e *Error) Is(target error) bool {
+	kind, ok := errorKinds[e.Code]
+	return ok && kind == target
+}
+
+// Message returns the message of the error in lang.
+func (e *Error) Message(lang string) string {
+	return i18n.T(lang, "error."+string(e.Code), e.Args...)
+}
+
+// errorStatus returns the HTTP status to answer err with.
+func errorStatus(err error) int {
+	switch {
+	case errors.Is(err, ErrNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, ErrConflict), errors.Is(err, ErrAlreadyStarted):
+		return http.StatusConflict
+	case errors.Is(err, ErrNotRevealed):
+		return http.StatusForbidden
+	case errors.Is(err, ErrUnauthorized):
+		return http.StatusUnauthorized
+	case errors.Is(err, ErrValidation):
+		return http.StatusBadRequest
+	case errors.Is(err, ErrRateLimited):
+		return http.StatusTooManyRequests
+	}
+	return http.StatusInternalServerError
+}
+
+// errorResponse is the body of an API error response.
+type errorResponse struct {
+	Error string    `json:"error"`
+	Code  ErrorCode `json:"code,omitempty"`
+}
+
+// errorMessage returns the message of err in the language of the request
+// and its code, if it has one.
+func (h *Handler) errorMessage(r *http.Request, err error) (string, ErrorCode) {
+	var e *Error
+	if errors.As(err, &e) {
+		return e.Message(h.lang(r)), e.Code
+	}
+	return err.Error(), ""
+}
+
+// writeError answers an API request with err as JSON, with the status that
+// fits its kind.
+func (h *Handler) writeError(w http.ResponseWriter, r *http.Request, err error) {
+	msg, code := h.errorMessage(r, err)
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(errorStatus(err))
+	json.NewEncoder(w).Encode(errorResponse{Error: msg, Code: code})
+}
+
+// uiError answers a page or form request with an error page that links back
+// to the party, or the front page if there is none.
+func (h *Handler) uiError(w http.ResponseWriter, r *http.Request, err error) {
+	status := errorStatus(err)
+	msg, _ := h.errorMessage(r, err)
+	if h.templates == nil {
+		http.Error(w, msg, status)
+		return
+	}
+
+	back := "/"
+	if partyID := r.PathValue("id"); partyID != "" {
+		back = "/parties/" + url.PathEscape(partyID)
+		if token := r.FormValue("admin_token"); token != "" {
+			back += "?admin_token=" + url.QueryEscape(token)
+		}
+	}
+	w.WriteHeader(status)
+	h.render(w, r, map[string]interface{}{
+		"Error":   msg,
+		"BackURL": back,
+	})
+}
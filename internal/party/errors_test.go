@@ -0,0 +1,190 @@
+package party_test
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/jehaj/new-year-wrapped/internal/db"
+	"github.com/jehaj/new-year-wrapped/internal/party"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func TestErrorKinds(t *testing.T) {
+	database, _ := sql.Open("sqlite3", ":memory:")
+	defer database.Close()
+	_, _ = db.Migrate(database)
+
+	service := party.NewService(database, nil)
+	ctx := context.Background()
+	partyID, _, _ := service.CreateParty(ctx, "Error Party", 1)
+	service.JoinParty(ctx, partyID, "Alice", []party.SongInput{{Title: "S1"}})
+
+	// Given: A party with one player
+	// When: The Service is asked to do something it can't
+	// Then: The error matches the kind that fits the failure
+	tests := []struct {
+		name string
+		err  error
+		kind error
+	}{
+		{"Missing party", func() error { _, err := service.GetSettings(ctx, "missing"); return err }(), party.ErrNotFound},
+		{"Name taken", func() error {
+			_, _, err := service.JoinParty(ctx, partyID, "Alice", []party.SongInput{{Title: "S2"}})
+			return err
+		}(), party.ErrConflict},
+		{"Invalid setting", func() error {
+			mode := "bogus"
+			_, err := service.UpdateSettings(ctx, partyID, party.SettingsUpdate{ScoringMode: &mode})
+			return err
+		}(), party.ErrValidation},
+		{"Round not revealed", func() error {
+			service.StartCompetition(ctx, partyID)
+			_, err := service.GetRoundResults(ctx, partyID, 1)
+			return err
+		}(), party.ErrNotRevealed},
+		{"Already started", func() error { _, err := service.CreateTeam(ctx, partyID, "Team"); return err }(), party.ErrAlreadyStarted},
+		{"Invalid session", func() error { _, err := service.UserBySession(ctx, partyID, 1, "bogus"); return err }(), party.ErrUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if !errors.Is(tt.err, tt.kind) {
+				t.Errorf("expected %v to be %v", tt.err, tt.kind)
+			}
+		})
+	}
+
+	t.Run("Other errors have no kind", func(t *testing.T) {
+		if errors.Is(errors.New("boom"), party.ErrNotFound) {
+			t.Error("expected a plain error not to match a kind")
+		}
+	})
+}
+
+func TestHandler_ErrorStatus(t *testing.T) {
+	database, _ := sql.Open("sqlite3", ":memory:")
+	defer database.Close()
+	_, _ = db.Migrate(database)
+
+	service := party.NewService(database, nil)
+	handler := party.NewHandler(service)
+	ctx := context.Background()
+	partyID, _, _ := service.CreateParty(ctx, "Status Party", 1)
+	service.JoinParty(ctx, partyID, "Alice", []party.SongInput{{Title: "S1"}})
+
+	t.Run("Name taken is a conflict", func(t *testing.T) {
+		// Given: A party where Alice has joined
+		// When: Someone else joins as Alice
+		// Then: A 409 status is returned with the error code
+		body := `{"name": "Alice", "songs": [{"title": "S2"}]}`
+		req := httptest.NewRequest("POST", "/parties/"+partyID+"/join", strings.NewReader(body))
+		req.SetPathValue("id", partyID)
+		rr := httptest.NewRecorder()
+
+		handler.JoinParty(rr, req)
+
+		if rr.Code != http.StatusConflict {
+			t.Errorf("expected status 409, got %d", rr.Code)
+		}
+		var resp struct{ Code string }
+		json.NewDecoder(rr.Body).Decode(&resp)
+		if resp.Code != string(party.CodeNameTaken) {
+			t.Errorf("expected code %q, got %q", party.CodeNameTaken, resp.Code)
+		}
+	})
+
+	t.Run("Malformed JSON is a bad request", func(t *testing.T) {
+		// Given: A party
+		// When: A join request with a malformed body is made
+		// Then: A 400 status is returned
+		req := httptest.NewRequest("POST", "/parties/"+partyID+"/join", strings.NewReader("{"))
+		req.SetPathValue("id", partyID)
+		rr := httptest.NewRecorder()
+
+		handler.JoinParty(rr, req)
+
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("expected status 400, got %d", rr.Code)
+		}
+	})
+
+	t.Run("Unrevealed round is forbidden", func(t *testing.T) {
+		// Given: A started party whose first round is not revealed
+		// When: The results of round 1 are requested
+		// Then: A 403 status is returned
+		service.StartCompetition(ctx, partyID)
+		req := httptest.NewRequest("GET", "/parties/"+partyID+"/results?round=1", nil)
+		req.SetPathValue("id", partyID)
+		rr := httptest.NewRecorder()
+
+		handler.GetRoundResults(rr, req)
+
+		if rr.Code != http.StatusForbidden {
+			t.Errorf("expected status 403, got %d", rr.Code)
+		}
+	})
+
+	t.Run("Starting twice is a conflict", func(t *testing.T) {
+		// Given: A started party
+		// When: The competition is started again
+		// Then: A 409 status is returned
+		req := httptest.NewRequest("POST", "/parties/"+partyID+"/start", nil)
+		req.SetPathValue("id", partyID)
+		rr := httptest.NewRecorder()
+
+		handler.StartCompetition(rr, req)
+
+		if rr.Code != http.StatusConflict {
+			t.Errorf("expected status 409, got %d: %s", rr.Code, rr.Body.String())
+		}
+	})
+
+	t.Run("UI forms answer with the status of the error", func(t *testing.T) {
+		// Given: A party that does not exist
+		// When: The join form is posted to it
+		// Then: A 404 status is returned instead of a redirect
+		req := httptest.NewRequest("POST", "/ui/parties/missing/join", strings.NewReader("user_name=Bob"))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req.SetPathValue("id", "missing")
+		rr := httptest.NewRecorder()
+
+		handler.UIJoinParty(rr, req)
+
+		if rr.Code != http.StatusNotFound {
+			t.Errorf("expected status 404, got %d", rr.Code)
+		}
+	})
+
+	t.Run("Unknown parties are not found", func(t *testing.T) {
+		// Given: A party that does not exist
+		// When: Its round, players or teams are requested, or it is advanced
+		// Then: Each answers 404 with the party_not_found code
+		tests := []struct {
+			method  string
+			path    string
+			handler http.HandlerFunc
+		}{
+			{"POST", "/parties/NOPE/next", handler.NextRound},
+			{"GET", "/parties/NOPE/round", handler.GetCurrentRound},
+			{"GET", "/parties/NOPE/users", handler.GetUsers},
+			{"GET", "/parties/NOPE/teams", handler.GetTeams},
+		}
+		for _, tt := range tests {
+			req := httptest.NewRequest(tt.method, tt.path, nil)
+			req.SetPathValue("id", "NOPE")
+			rr := httptest.NewRecorder()
+			tt.handler(rr, req)
+
+			var resp struct{ Code string }
+			json.NewDecoder(rr.Body).Decode(&resp)
+			if rr.Code != http.StatusNotFound || resp.Code != string(party.CodePartyNotFound) {
+				t.Errorf("%s %s: expected status 404 with code %q, got %d %q", tt.method, tt.path, party.CodePartyNotFound, rr.Code, resp.Code)
+			}
+		}
+	})
+}
@@ -0,0 +1,130 @@
+package party
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Event types published by the Service.
+const (
+	EventJoin      = "join"
+	EventStart     = "start"
+	EventReveal    = "reveal"
+	EventNextRound = "next_round"
+	EventGuess     = "guess"
+	EventTeams     = "teams"
+	EventPlayers   = "players"
+)
+
+// Event is a change to a party that connected browsers may want to react to.
+type Event struct {
+	Type string      `json:"type"`
+	Data interface{} `json:"data,omitempty"`
+}
+
+// Hub fans out party events to every subscriber of that party within this
+// process.
+type Hub struct {
+	mu   sync.Mutex
+	subs map[string]map[chan Event]struct{}
+}
+
+func NewHub() *Hub {
+	return &Hub{subs: make(map[string]map[chan Event]struct{})}
+}
+
+// Subscribe returns a channel receiving the party's events and a function that
+// must be called to stop receiving them.
+func (h *Hub) Subscribe(partyID string) (<-chan Event, func()) {
+	ch := make(chan Event, 16)
+
+	h.mu.Lock()
+	if h.subs[partyID] == nil {
+		h.subs[partyID] = make(map[chan Event]struct{})
+	}
+	h.subs[partyID][ch] = struct{}{}
+	h.mu.Unlock()
+
+	var once sync.Once
+	return ch, func() {
+		once.Do(func() {
+			h.mu.Lock()
+			delete(h.subs[partyID], ch)
+			if len(h.subs[partyID]) == 0 {
+				delete(h.subs, partyID)
+			}
+			h.mu.Unlock()
+			close(ch)
+		})
+	}
+}
+
+// Publish sends an event to all subscribers of a party. Subscribers that are
+// not keeping up miss the event rather than blocking the publisher.
+func (h *Hub) Publish(partyID string, e Event) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for ch := range h.subs[partyID] {
+		select {
+		case ch <- e:
+		default:
+		}
+	}
+}
+
+// Subscribers returns the number of active subscribers of a party.
+func (h *Hub) Subscribers(partyID string) int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return len(h.subs[partyID])
+}
+
+// Events streams a party's events to the client as Server-Sent Events until
+// the client disconnects.
+func (h *Handler) Events(w http.ResponseWriter, r *http.Request) {
+	partyID := h.getPartyID(r)
+	if partyID == "" {
+		h.writeError(w, r, newError(CodeMissingPartyID))
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, h.t(r, "error.streaming"), http.StatusInternalServerError)
+		return
+	}
+
+	if _, _, _, err := h.service.GetPartyState(r.Context(), partyID); err != nil {
+		h.writeError(w, r, err)
+		return
+	}
+
+	events, unsubscribe := h.service.Events().Subscribe(partyID)
+	defer unsubscribe()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	fmt.Fprint(w, ": connected\n\n")
+	flusher.Flush()
+
+	keepAlive := time.NewTicker(25 * time.Second)
+	defer keepAlive.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case e := <-events:
+			data, _ := json.Marshal(e.Data)
+			fmt.Fprintf(w, "event: %s\ndata: %s\n\n", e.Type, data)
+			flusher.Flush()
+		case <-keepAlive.C:
+			fmt.Fprint(w, ": ping\n\n")
+			flusher.Flush()
+		}
+	}
+}
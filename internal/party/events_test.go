@@ -0,0 +1,47 @@
+package party_test
+
+import (
+	"testing"
+
+	"github.com/jehaj/new-year-wrapped/internal/party"
+)
+
+func TestHub(t *testing.T) {
+	hub := party.NewHub()
+
+	// Given: Two subscribers to one party and one to another
+	// When: An event is published to the first party
+	// Then: Only its subscribers receive it
+	a, unsubscribeA := hub.Subscribe("p1")
+	b, unsubscribeB := hub.Subscribe("p1")
+	other, unsubscribeOther := hub.Subscribe("p2")
+	defer unsubscribeOther()
+
+	hub.Publish("p1", party.Event{Type: party.EventStart})
+
+	for _, ch := range []<-chan party.Event{a, b} {
+		select {
+		case e := <-ch:
+			if e.Type != party.EventStart {
+				t.Errorf("expected %s event, got %s", party.EventStart, e.Type)
+			}
+		default:
+			t.Error("expected subscriber to receive event")
+		}
+	}
+	select {
+	case e := <-other:
+		t.Errorf("expected no event for other party, got %v", e)
+	default:
+	}
+
+	// When: The subscribers unsubscribe
+	// Then: The party has no subscribers left and publishing does not block
+	unsubscribeA()
+	unsubscribeB()
+	unsubscribeB()
+	if n := hub.Subscribers("p1"); n != 0 {
+		t.Errorf("expected 0 subscribers, got %d", n)
+	}
+	hub.Publish("p1", party.Event{Type: party.EventReveal})
+}
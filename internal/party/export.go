@@ -0,0 +1,433 @@
+package party
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// ExportVersion is the version of the export format written by ExportParty.
+// ImportParty only reads exports of this version. Teams and wagers were added
+// to version 1 as optional fields: exports without them are imported as a
+// party without teams, where every guess has the smallest wager.
+const ExportVersion = 1
+
+// maxImportSize bounds the size of an uploaded export.
+const maxImportSize = 10 << 20
+
+// PartyExport is a complete copy of a party that can be imported again. IDs
+// only tie the users, songs and guesses of the export together; the imported
+// rows get new ones.
+type PartyExport struct {
+	Version    int             `json:"version"`
+	ExportedAt time.Time       `json:"exported_at"`
+	Party      ExportedParty   `json:"party"`
+	Teams      []ExportedTeam  `json:"teams"` // Optional.
+	Users      []ExportedUser  `json:"users"`
+	Songs      []ExportedSong  `json:"songs"`
+	Guesses    []ExportedGuess `json:"guesses"`
+	Rounds     []ExportedRound `json:"rounds"`
+}
+
+type ExportedParty struct {
+	Name         string   `json:"name"`
+	Settings     Settings `json:"settings"`
+	Started      bool     `json:"started"`
+	CurrentRound int      `json:"current_round"`
+	ShowResults  bool     `json:"show_results"`
+}
+
+type ExportedTeam struct {
+	ID   int    `json:"id"`
+	Name string `json:"name"`
+}
+
+type ExportedUser struct {
+	ID     int    `json:"id"`
+	Name   string `json:"name"`
+	TeamID int    `json:"team_id,omitempty"` // Optional, 0 for no team.
+}
+
+type ExportedSong struct {
+	ID           int    `json:"id"`
+	UserID       int    `json:"user_id"`
+	Title        string `json:"title"`
+	YouTubeID    string `json:"youtube_id"`
+	ThumbnailURL string `json:"thumbnail_url"`
+	SongKey      string `json:"song_key"`
+	ShuffleIndex int    `json:"shuffle_index"` // -1 until the competition starts.
+}
+
+type ExportedGuess struct {
+	GuesserID     int   `json:"guesser_id"`
+	SongID        int   `json:"song_id"`
+	GuessedUserID int   `json:"guessed_user_id"`
+	CreatedAt     int64 `json:"created_at"` // Unix milliseconds.
+	Wager         int   `json:"wager"`      // Optional, MinWager if 0.
+}
+
+type ExportedRound struct {
+	Number   int   `json:"number"`
+	OpenedAt int64 `json:"opened_at"` // Unix milliseconds.
+}
+
+// ExportParty returns everything needed to recreate a party, except for the
+// admin token and player sessions.
+func (s *Service) ExportParty(ctx context.Context, partyID string) (*PartyExport, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	settings, err := getSettings(ctx, tx, partyID)
+	if err != nil {
+		return nil, err
+	}
+	export := &PartyExport{
+		Version:    ExportVersion,
+		ExportedAt: s.now().UTC(),
+		Party:      ExportedParty{Settings: settings},
+		Teams:      []ExportedTeam{},
+		Users:      []ExportedUser{},
+		Songs:      []ExportedSong{},
+		Guesses:    []ExportedGuess{},
+		Rounds:     []ExportedRound{},
+	}
+	err = tx.QueryRowContext(ctx, "SELECT name, started, current_round, show_results FROM parties WHERE id = ?", partyID).
+		Scan(&export.Party.Name, &export.Party.Started, &export.Party.CurrentRound, &export.Party.ShowResults)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := tx.QueryContext(ctx, "SELECT id, name FROM teams WHERE party_id = ? ORDER BY id ASC", partyID)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var team ExportedTeam
+		if err := rows.Scan(&team.ID, &team.Name); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		export.Teams = append(export.Teams, team)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	rows, err = tx.QueryContext(ctx, "SELECT id, name, team_id FROM users WHERE party_id = ? ORDER BY id ASC", partyID)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var u ExportedUser
+		if err := rows.Scan(&u.ID, &u.Name, &u.TeamID); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		export.Users = append(export.Users, u)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	rows, err = tx.QueryContext(ctx, `
+		SELECT s.id, s.user_id, s.title, s.youtube_id, s.thumbnail_url, s.song_key, s.shuffle_index
+		FROM songs s
+		JOIN users u ON s.user_id = u.id
+		WHERE u.party_id = ?
+		ORDER BY s.id ASC`, partyID)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var song ExportedSong
+		if err := rows.Scan(&song.ID, &song.UserID, &song.Title, &song.YouTubeID, &song.ThumbnailURL, &song.SongKey, &song.ShuffleIndex); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		export.Songs = append(export.Songs, song)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	rows, err = tx.QueryContext(ctx, `
+		SELECT g.guesser_id, g.song_id, g.guessed_user_id, g.created_at, g.wager
+		FROM guesses g
+		JOIN users u ON g.guesser_id = u.id
+		WHERE u.party_id = ?
+		ORDER BY g.id ASC`, partyID)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var g ExportedGuess
+		if err := rows.Scan(&g.GuesserID, &g.SongID, &g.GuessedUserID, &g.CreatedAt, &g.Wager); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		export.Guesses = append(export.Guesses, g)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	rows, err = tx.QueryContext(ctx, "SELECT number, opened_at FROM rounds WHERE party_id = ? ORDER BY number ASC", partyID)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var round ExportedRound
+		if err := rows.Scan(&round.Number, &round.OpenedAt); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		export.Rounds = append(export.Rounds, round)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	s.log(partyID, "Exported party")
+	return export, nil
+}
+
+// Validate reports the first problem that would stop the export from being
+// imported, such as references to users or songs that are not in it.
+func (e *PartyExport) Validate() error {
+	if e.Version != ExportVersion {
+		return newError(CodeImportVersion, e.Version, ExportVersion)
+	}
+	if e.Party.Name == "" {
+		return newError(CodeImportPartyName)
+	}
+	if err := e.Party.Settings.Validate(); err != nil {
+		return err
+	}
+	if e.Party.CurrentRound < 0 || (!e.Party.Started && e.Party.CurrentRound != 0) {
+		return newError(CodeImportRound, e.Party.CurrentRound)
+	}
+
+	teams := make(map[int]bool)
+	teamNames := make(map[string]bool)
+	for _, team := range e.Teams {
+		if team.ID == 0 || teams[team.ID] {
+			return newError(CodeImportTeam, team.ID)
+		}
+		if team.Name == "" || teamNames[team.Name] {
+			return newError(CodeImportTeamName, team.Name)
+		}
+		teams[team.ID] = true
+		teamNames[team.Name] = true
+	}
+
+	users := make(map[int]bool)
+	names := make(map[string]bool)
+	for _, u := range e.Users {
+		if users[u.ID] {
+			return newError(CodeImportUserDuplicate, u.ID)
+		}
+		if u.Name == "" {
+			return newError(CodeImportUserName, u.ID)
+		}
+		if names[u.Name] {
+			return newError(CodeImportNameDuplicate, u.Name)
+		}
+		if u.TeamID != 0 && !teams[u.TeamID] {
+			return newError(CodeImportUserTeam, u.ID, u.TeamID)
+		}
+		users[u.ID] = true
+		names[u.Name] = true
+	}
+
+	songs := make(map[int]bool)
+	shuffled := make(map[int]bool)
+	for _, song := range e.Songs {
+		if songs[song.ID] {
+			return newError(CodeImportSongDuplicate, song.ID)
+		}
+		if !users[song.UserID] {
+			return newError(CodeImportSongUser, song.ID, song.UserID)
+		}
+		if song.Title == "" {
+			return newError(CodeImportSongTitle, song.ID)
+		}
+		songs[song.ID] = true
+
+		// Once started every song has its own place in the shuffled order
+		if !e.Party.Started {
+			if song.ShuffleIndex != -1 {
+				return newError(CodeImportSongShuffled, song.ID)
+			}
+			continue
+		}
+		if song.ShuffleIndex < 0 || song.ShuffleIndex >= len(e.Songs) || shuffled[song.ShuffleIndex] {
+			return newError(CodeImportShuffleIndex, song.ID, song.ShuffleIndex)
+		}
+		shuffled[song.ShuffleIndex] = true
+	}
+
+	guessed := make(map[[2]int]bool)
+	for _, g := range e.Guesses {
+		if !users[g.GuesserID] || !users[g.GuessedUserID] {
+			return newError(CodeImportGuessUser, g.SongID)
+		}
+		if !songs[g.SongID] {
+			return newError(CodeImportGuessSong, g.SongID)
+		}
+		if g.Wager != 0 && (g.Wager < MinWager || g.Wager > MaxWager) {
+			return newError(CodeImportWager, g.Wager, g.SongID)
+		}
+		if guessed[[2]int{g.GuesserID, g.SongID}] {
+			return newError(CodeImportGuessDuplicate, g.GuesserID, g.SongID)
+		}
+		guessed[[2]int{g.GuesserID, g.SongID}] = true
+	}
+
+	opened := make(map[int]bool)
+	for _, round := range e.Rounds {
+		if round.Number < 1 || round.Number > e.Party.CurrentRound || opened[round.Number] {
+			return newError(CodeImportRound, round.Number)
+		}
+		opened[round.Number] = true
+	}
+	return nil
+}
+
+// ImportParty recreates an exported party under a new ID and admin token.
+// Players have no sessions in the new party, so they must claim their names
+// again. A running round gets no deadline.
+func (s *Service) ImportParty(ctx context.Context, export *PartyExport) (id string, adminToken string, err error) {
+	if err := export.Validate(); err != nil {
+		return "", "", err
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return "", "", err
+	}
+	defer tx.Rollback()
+
+	p := export.Party
+	id, adminToken, err = s.insertParty(ctx, tx, p.Name, p.Settings.SongsPerPlayer)
+	if err != nil {
+		return "", "", err
+	}
+	_, err = tx.ExecContext(ctx, `
+		UPDATE parties
+		SET started = ?, current_round = ?, show_results = ?,
+			songs_per_round = ?, scoring_mode = ?, round_time_limit = ?, allow_late_join = ?,
+			allow_guess_changes = ?, team_mode = ?, team_guess_policy = ?, wager_budget = ?, language = ?
+		WHERE id = ?`,
+		p.Started, p.CurrentRound, p.ShowResults,
+		p.Settings.SongsPerRound, p.Settings.ScoringMode, p.Settings.RoundTimeLimit, p.Settings.AllowLateJoin,
+		p.Settings.AllowGuessChanges, p.Settings.TeamMode, p.Settings.TeamGuessPolicy, p.Settings.WagerBudget, p.Settings.Language, id)
+	if err != nil {
+		return "", "", err
+	}
+
+	teamIDs := map[int]int64{0: 0}
+	for _, team := range export.Teams {
+		res, err := tx.ExecContext(ctx, "INSERT INTO teams (party_id, name) VALUES (?, ?)", id, team.Name)
+		if err != nil {
+			return "", "", err
+		}
+		if teamIDs[team.ID], err = res.LastInsertId(); err != nil {
+			return "", "", err
+		}
+	}
+
+	userIDs := make(map[int]int64)
+	for _, u := range export.Users {
+		res, err := tx.ExecContext(ctx, "INSERT INTO users (party_id, name, team_id) VALUES (?, ?, ?)", id, u.Name, teamIDs[u.TeamID])
+		if err != nil {
+			return "", "", err
+		}
+		if userIDs[u.ID], err = res.LastInsertId(); err != nil {
+			return "", "", err
+		}
+	}
+
+	songIDs := make(map[int]int64)
+	for _, song := range export.Songs {
+		res, err := tx.ExecContext(ctx, `
+			INSERT INTO songs (user_id, title, youtube_id, thumbnail_url, song_key, shuffle_index)
+			VALUES (?, ?, ?, ?, ?, ?)`,
+			userIDs[song.UserID], song.Title, song.YouTubeID, song.ThumbnailURL, song.SongKey, song.ShuffleIndex)
+		if err != nil {
+			return "", "", err
+		}
+		if songIDs[song.ID], err = res.LastInsertId(); err != nil {
+			return "", "", err
+		}
+	}
+
+	for _, g := range export.Guesses {
+		// Exports from before wagers have none
+		wager := max(MinWager, g.Wager)
+		_, err := tx.ExecContext(ctx, `
+			INSERT INTO guesses (guesser_id, song_id, guessed_user_id, created_at, wager)
+			VALUES (?, ?, ?, ?, ?)`,
+			userIDs[g.GuesserID], songIDs[g.SongID], userIDs[g.GuessedUserID], g.CreatedAt, wager)
+		if err != nil {
+			return "", "", err
+		}
+	}
+
+	for _, round := range export.Rounds {
+		_, err := tx.ExecContext(ctx, "INSERT INTO rounds (party_id, number, opened_at) VALUES (?, ?, ?)", id, round.Number, round.OpenedAt)
+		if err != nil {
+			return "", "", err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return "", "", err
+	}
+
+	s.log(id, "Imported party: %s (%d players, %d songs, %d guesses)", p.Name, len(export.Users), len(export.Songs), len(export.Guesses))
+	return id, adminToken, nil
+}
+
+func (h *Handler) ExportParty(w http.ResponseWriter, r *http.Request) {
+	partyID := h.getPartyID(r)
+	export, err := h.service.ExportParty(r.Context(), partyID)
+	if err != nil {
+		h.writeError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="party-%s.json"`, partyID))
+	json.NewEncoder(w).Encode(export)
+}
+
+func (h *Handler) ImportParty(w http.ResponseWriter, r *http.Request) {
+	// Exports from before teams and wagers lack their settings
+	export := PartyExport{Party: ExportedParty{Settings: Settings{TeamGuessPolicy: TeamGuessFirst, WagerBudget: DefaultWagerBudget}}}
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxImportSize)).Decode(&export); err != nil {
+		h.writeError(w, r, newError(CodeInvalidRequest, err))
+		return
+	}
+
+	id, adminToken, err := h.service.ImportParty(r.Context(), &export)
+	if err != nil {
+		h.writeError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]string{
+		"id":          id,
+		"admin_token": adminToken,
+	})
+}
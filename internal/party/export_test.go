@@ -0,0 +1,36 @@
+package party
+
+import "time"
+
+// SetRandomString replaces the generator used for party IDs and admin tokens.
+func (s *Service) SetRandomString(f func(n int) (string, error)) {
+	s.randomString = f
+}
+
+// SetClock replaces the clock used for round deadlines.
+func (s *Service) SetClock(now func() time.Time) {
+	s.now = now
+}
+
+// SetClock replaces the clock used to expire cached searches.
+func (c *CachedMusicProvider) SetClock(now func() time.Time) {
+	c.now = now
+}
+
+// SetTimeout replaces how long a shared search may take.
+func (c *CachedMusicProvider) SetTimeout(timeout time.Duration) {
+	c.timeout = timeout
+}
+
+// SetClock replaces the clock used to refill rate limit buckets.
+func (l *RateLimiter) SetClock(now func() time.Time) {
+	l.now = now
+}
+
+// SongKey returns the normalized key of a song title.
+var SongKey = songKey
+
+// SimilarTitles reports whether two titles are taken to be the same song.
+func SimilarTitles(a, b string) bool {
+	return similarSongs(parseSongTitle(a), parseSongTitle(b))
+}
@@ -0,0 +1,117 @@
+package party
+
+import (
+	"context"
+	"database/sql"
+)
+
+// checkGuess reports whether a player may guess who owns a song. The song
+// must be in the open round of the guesser's party and not count as the
+// guesser's own, see ownSongIDs, and the guessed player must be someone else
+// in the same party. It returns the song's round.
+func checkGuess(ctx context.Context, tx *sql.Tx, partyID string, guesserID, songID, guessedUserID, songsPerRound int) (int, error) {
+	var started, showResults bool
+	var currentRound int
+	err := tx.QueryRowContext(ctx, "SELECT started, current_round, show_results FROM parties WHERE id = ?", partyID).Scan(&started, &currentRound, &showResults)
+	if err != nil {
+		return 0, err
+	}
+	if !started {
+		return 0, newError(CodeNotStarted)
+	}
+
+	var shuffleIndex int
+	err = tx.QueryRowContext(ctx, `
+		SELECT s.shuffle_index
+		FROM songs s
+		JOIN users u ON s.user_id = u.id
+		WHERE s.id = ? AND u.party_id = ?`, songID, partyID).Scan(&shuffleIndex)
+	if err == sql.ErrNoRows {
+		return 0, newError(CodeSongNotFound, songID)
+	}
+	if err != nil {
+		return 0, err
+	}
+	round := shuffleIndex/songsPerRound + 1
+	if shuffleIndex < 0 || round != currentRound || showResults {
+		return 0, newError(CodeSongNotInRound, songID)
+	}
+	if guessedUserID == guesserID {
+		return 0, newError(CodeSelfGuess)
+	}
+	own, err := ownSongIDs(ctx, tx, partyID, guesserID)
+	if err != nil {
+		return 0, err
+	}
+	if own[songID] {
+		return 0, newError(CodeOwnSong)
+	}
+
+	var guessedInParty bool
+	err = tx.QueryRowContext(ctx, "SELECT EXISTS (SELECT 1 FROM users WHERE id = ? AND party_id = ?)", guessedUserID, partyID).Scan(&guessedInParty)
+	if err != nil {
+		return 0, err
+	}
+	if !guessedInParty {
+		return 0, newError(CodeUserNotFound, guessedUserID)
+	}
+	return round, nil
+}
+
+// hasGuessed reports whether a player has already guessed on a song.
+func hasGuessed(ctx context.Context, q queryRower, guesserID, songID int) (bool, error) {
+	var guessed bool
+	err := q.QueryRowContext(ctx, "SELECT EXISTS (SELECT 1 FROM guesses WHERE guesser_id = ? AND song_id = ?)", guesserID, songID).Scan(&guessed)
+	return guessed, err
+}
+
+// querier runs queries on the database or in a transaction.
+type querier interface {
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+}
+
+// ownSongIDs returns the IDs of the songs in a party that count as a
+// player's own: their songs and every copy of them submitted by others, as
+// the player is scored as an owner of those too.
+func ownSongIDs(ctx context.Context, q querier, partyID string, userID int) (map[int]bool, error) {
+	rows, err := q.QueryContext(ctx, `
+		SELECT s.id, s.user_id, s.song_key, s.youtube_id
+		FROM songs s
+		JOIN users u ON s.user_id = u.id
+		WHERE u.party_id = ?`, partyID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	identities := make(map[int]string) // Song ID → identity.
+	owned := make(map[string]bool)
+	for rows.Next() {
+		var id, ownerID int
+		var key, youtubeID string
+		if err := rows.Scan(&id, &ownerID, &key, &youtubeID); err != nil {
+			return nil, err
+		}
+		identities[id] = songIdentity(key, youtubeID, id)
+		if ownerID == userID {
+			owned[identities[id]] = true
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	own := make(map[int]bool)
+	for id, identity := range identities {
+		if owned[identity] {
+			own[id] = true
+		}
+	}
+	return own, nil
+}
+
+// OwnSongIDs returns the IDs of the songs in a party a player may not guess
+// on, because they count as the player's own.
+func (s *Service) OwnSongIDs(ctx context.Context, partyID string, userID int) (map[int]bool, error) {
+	return ownSongIDs(ctx, s.db, partyID, userID)
+}
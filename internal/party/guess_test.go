@@ -0,0 +1,177 @@
+package party_test
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+
+	"github.com/jehaj/new-year-wrapped/internal/db"
+	"github.com/jehaj/new-year-wrapped/internal/party"
+)
+
+func TestGuessValidation(t *testing.T) {
+	database, _ := sql.Open("sqlite3", ":memory:")
+	defer database.Close()
+	_, _ = db.Migrate(database)
+
+	service := party.NewService(database, nil)
+	ctx := context.Background()
+
+	// startParty starts a party where each player has one song and the first
+	// round has two songs. It returns the players and the owner of each song.
+	startParty := func(name string, players []string, update party.SettingsUpdate) (string, map[string]int, map[int]int) {
+		partyID, _, _ := service.CreateParty(ctx, name, 1)
+		songsPerRound := 2
+		update.SongsPerRound = &songsPerRound
+		if _, err := service.UpdateSettings(ctx, partyID, update); err != nil {
+			t.Fatalf("UpdateSettings failed: %v", err)
+		}
+		userIDs := make(map[string]int)
+		owners := make(map[int]int)
+		for _, player := range players {
+			id, _, err := service.JoinParty(ctx, partyID, player, []party.SongInput{{Title: player + "'s Song"}})
+			if err != nil {
+				t.Fatalf("JoinParty failed: %v", err)
+			}
+			userIDs[player] = id
+			songs, _ := service.GetUserSongs(ctx, partyID, id)
+			owners[songs[0].ID] = id
+		}
+		if err := service.StartCompetition(ctx, partyID); err != nil {
+			t.Fatalf("StartCompetition failed: %v", err)
+		}
+		return partyID, userIDs, owners
+	}
+
+	allowChanges := true
+	otherID, otherUsers, otherOwners := startParty("Other Party", []string{"Dave", "Erin", "Frank"}, party.SettingsUpdate{AllowGuessChanges: &allowChanges})
+	partyID, userIDs, owners := startParty("Guess Party", []string{"Alice", "Bob", "Charlie"}, party.SettingsUpdate{})
+
+	round1, _ := service.GetRoundSongs(ctx, partyID, 1)
+	round2, _ := service.GetRoundSongs(ctx, partyID, 2)
+	song := round1[0].ID
+	owner := owners[song]
+	var guesser, bystander int
+	for _, id := range userIDs {
+		if id != owner {
+			bystander, guesser = guesser, id
+		}
+	}
+
+	t.Run("Invalid guesses are rejected", func(t *testing.T) {
+		// Given: A party in its first round and another party
+		// When: A player guesses outside what the round offers
+		// Then: The guess is rejected with an error code telling why
+		otherSongs, _ := service.GetRoundSongs(ctx, otherID, 1)
+		tests := []struct {
+			name          string
+			guesserID     int
+			songID        int
+			guessedUserID int
+			code          party.ErrorCode
+		}{
+			{"Own song", owner, song, guesser, party.CodeOwnSong},
+			{"Guessing yourself", guesser, song, guesser, party.CodeSelfGuess},
+			{"Song of a later round", guesser, round2[0].ID, owner, party.CodeSongNotInRound},
+			{"Song of another party", guesser, otherSongs[0].ID, owner, party.CodeSongNotFound},
+			{"Player of another party", guesser, song, otherUsers["Dave"], party.CodeUserNotFound},
+		}
+		for _, tt := range tests {
+			err := service.SubmitGuess(ctx, tt.guesserID, tt.songID, tt.guessedUserID)
+			if code := errorCode(err); code != tt.code {
+				t.Errorf("%s: expected %q, got %v", tt.name, tt.code, err)
+			}
+		}
+	})
+
+	t.Run("Guesses are final", func(t *testing.T) {
+		// Given: A party that does not allow guess changes
+		// When: A player guesses on a song twice
+		// Then: The second guess is rejected and the first one stands
+		if err := service.SubmitGuess(ctx, guesser, song, owner); err != nil {
+			t.Fatalf("SubmitGuess failed: %v", err)
+		}
+		err := service.SubmitGuess(ctx, guesser, song, bystander)
+		if code := errorCode(err); code != party.CodeGuessLocked {
+			t.Errorf("expected %q, got %v", party.CodeGuessLocked, err)
+		}
+		if !errors.Is(err, party.ErrConflict) {
+			t.Errorf("expected a conflict, got %v", err)
+		}
+	})
+
+	t.Run("Guesses can be changed if the party allows it", func(t *testing.T) {
+		// Given: A party that allows guess changes
+		// When: A player guesses on a song twice
+		// Then: The second guess replaces the first
+		otherSongs, _ := service.GetRoundSongs(ctx, otherID, 1)
+		song := otherSongs[0].ID
+		var guesser, bystander int
+		for _, id := range otherUsers {
+			if id != otherOwners[song] {
+				bystander, guesser = guesser, id
+			}
+		}
+		for _, guessed := range []int{bystander, otherOwners[song]} {
+			if err := service.SubmitGuess(ctx, guesser, song, guessed); err != nil {
+				t.Fatalf("SubmitGuess failed: %v", err)
+			}
+		}
+	})
+
+	t.Run("Revealed rounds are closed", func(t *testing.T) {
+		// Given: A round whose results are shown
+		// When: A player guesses on one of its songs
+		// Then: The guess is rejected
+		service.NextRound(ctx, partyID)
+		var latecomer int
+		for _, id := range userIDs {
+			if id != owner && id != guesser {
+				latecomer = id
+			}
+		}
+		err := service.SubmitGuess(ctx, latecomer, song, owner)
+		if code := errorCode(err); code != party.CodeSongNotInRound {
+			t.Errorf("expected %q, got %v", party.CodeSongNotInRound, err)
+		}
+	})
+
+	t.Run("Copies of your song are your own", func(t *testing.T) {
+		// Given: A party where Alice and Bob both submitted Song X
+		// When: Alice guesses Bob on Bob's copy of it
+		// Then: The guess is rejected as on her own song, since she is
+		// scored as an owner of both copies
+		sharedID, _, _ := service.CreateParty(ctx, "Shared Party", 1)
+		alice, _, _ := service.JoinParty(ctx, sharedID, "Alice", []party.SongInput{{Title: "Song X"}})
+		bob, _, _ := service.JoinParty(ctx, sharedID, "Bob", []party.SongInput{{Title: "Song X"}})
+		service.JoinParty(ctx, sharedID, "Charlie", []party.SongInput{{Title: "Song Y"}})
+		if err := service.StartCompetition(ctx, sharedID); err != nil {
+			t.Fatalf("StartCompetition failed: %v", err)
+		}
+		aliceSongs, _ := service.GetUserSongs(ctx, sharedID, alice)
+		bobSongs, _ := service.GetUserSongs(ctx, sharedID, bob)
+
+		err := service.SubmitGuess(ctx, alice, bobSongs[0].ID, bob)
+		if code := errorCode(err); code != party.CodeOwnSong {
+			t.Errorf("expected %q, got %v", party.CodeOwnSong, err)
+		}
+
+		own, err := service.OwnSongIDs(ctx, sharedID, alice)
+		if err != nil {
+			t.Fatalf("OwnSongIDs failed: %v", err)
+		}
+		if len(own) != 2 || !own[aliceSongs[0].ID] || !own[bobSongs[0].ID] {
+			t.Errorf("expected both copies of Song X to be Alice's, got %v", own)
+		}
+	})
+}
+
+// errorCode returns the code of an error from the Service, if it has one.
+func errorCode(err error) party.ErrorCode {
+	var e *party.Error
+	if errors.As(err, &e) {
+		return e.Code
+	}
+	return ""
+}
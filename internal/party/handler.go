@@ -1,44 +1,83 @@
 package party
 
 import (
+	"crypto/rand"
 	"encoding/json"
 	"fmt"
 	"html/template"
 	"io"
+	"math"
 	"net/http"
 	"strconv"
 	"strings"
+	"time"
 
+	"github.com/jehaj/new-year-wrapped/internal/i18n"
 	"github.com/yeqown/go-qrcode/v2"
 	"github.com/yeqown/go-qrcode/writer/standard"
 )
 
 type Handler struct {
-	service   *Service
-	templates *template.Template
+	service    *Service
+	templates  *template.Template
+	sessionKey []byte
+	thumbnails *ThumbnailCache
 }
 
+// NewHandler creates a handler with a random session key. Use SetSessionKey to
+// keep player sessions valid across restarts.
 func NewHandler(service *Service) *Handler {
-	tmpl, _ := template.ParseGlob("templates/*.html")
+	tmpl, _ := template.New("").Funcs(template.FuncMap{
+		"songURL": func(id string) string { return service.MusicProvider().URL(id) },
+	}).Funcs(translationFuncs(i18n.Default, "/")).ParseGlob("templates/*.html")
+	key := make([]byte, 32)
+	rand.Read(key)
 	return &Handler{
-		service:   service,
-		templates: tmpl,
+		service:    service,
+		templates:  tmpl,
+		sessionKey: key,
+		thumbnails: NewThumbnailCache(&http.Client{Timeout: 5 * time.Second}, DefaultThumbnailHosts...),
 	}
 }
 
+// translationFuncs returns the template functions for text in lang. The
+// templates are parsed with placeholders and get the real ones per request.
+func translationFuncs(lang, requestURI string) template.FuncMap {
+	return template.FuncMap{
+		"t": func(key string, args ...any) string { return i18n.T(lang, key, args...) },
+		"plural": func(key string, n int, args ...any) string {
+			return i18n.Plural(lang, key, n, args...)
+		},
+		"lang":       func() string { return lang },
+		"languages":  func() []i18n.Language { return i18n.Languages },
+		"requestURI": func() string { return requestURI },
+	}
+}
+
+// render executes the layout with the text in the language of the request.
+func (h *Handler) render(w http.ResponseWriter, r *http.Request, data any) {
+	tmpl, err := h.templates.Clone()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	tmpl.Funcs(translationFuncs(h.lang(r), r.URL.RequestURI()))
+	tmpl.ExecuteTemplate(w, "layout", data)
+}
+
 // UI Handlers
 
 func (h *Handler) IndexPage(w http.ResponseWriter, r *http.Request) {
 	if h.templates == nil {
-		http.Error(w, "skabeloner ikke indlæst", http.StatusInternalServerError)
+		http.Error(w, h.t(r, "error.templates_missing"), http.StatusInternalServerError)
 		return
 	}
-	h.templates.ExecuteTemplate(w, "layout", nil)
+	h.render(w, r, nil)
 }
 
 func (h *Handler) PartyPage(w http.ResponseWriter, r *http.Request) {
 	if h.templates == nil {
-		http.Error(w, "skabeloner ikke indlæst", http.StatusInternalServerError)
+		http.Error(w, h.t(r, "error.templates_missing"), http.StatusInternalServerError)
 		return
 	}
 	partyID := h.getPartyID(r)
@@ -49,8 +88,10 @@ func (h *Handler) PartyPage(w http.ResponseWriter, r *http.Request) {
 		http.Redirect(w, r, "/", http.StatusSeeOther)
 		return
 	}
+	if h.claimLegacySession(w, r, partyID) {
+		return
+	}
 
-	userName := r.URL.Query().Get("user")
 	adminToken := r.URL.Query().Get("admin_token")
 
 	started, _, _, err := h.service.GetPartyState(r.Context(), partyID)
@@ -59,36 +100,79 @@ func (h *Handler) PartyPage(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	if started {
-		http.Redirect(w, r, fmt.Sprintf("/parties/%s/game?user=%s&admin_token=%s", partyID, userName, adminToken), http.StatusSeeOther)
+		http.Redirect(w, r, fmt.Sprintf("/parties/%s/game?admin_token=%s", partyID, adminToken), http.StatusSeeOther)
 		return
 	}
 
+	user, userJoined := h.currentUser(r, partyID)
+
 	partyName, _ := h.service.GetPartyName(r.Context(), partyID)
 	users, _ := h.service.GetUsers(r.Context(), partyID)
 	isAdmin, _ := h.service.VerifyAdmin(r.Context(), partyID, adminToken)
+	settings, _ := h.service.GetSettings(r.Context(), partyID)
+	songsPerPlayer := settings.SongsPerPlayer
+	teams, _ := h.service.GetTeams(r.Context(), partyID)
+	var players []Player
+	if isAdmin {
+		players, _ = h.service.GetPlayers(r.Context(), partyID)
+	}
+	userTeamID := 0
+	var userSongs []Song
+	if userJoined {
+		userTeamID, _ = h.service.GetUserTeam(r.Context(), user.ID)
+		userSongs, _ = h.service.GetUserSongs(r.Context(), partyID, user.ID)
+		songsPerPlayer = len(userSongs)
+	}
+
+	// Joined players see their own songs in the slots so they can change them
+	songSlots := make([]songSlot, songsPerPlayer)
+	for i := range songSlots {
+		songSlots[i].Number = i + 1
+		if i < len(userSongs) {
+			songSlots[i].Song = userSongs[i]
+		}
+	}
 
 	data := map[string]interface{}{
 		"Party": map[string]string{
 			"ID":   partyID,
 			"Name": partyName,
 		},
-		"Users":      users,
-		"UserJoined": userName != "",
-		"UserName":   userName,
-		"AdminToken": adminToken,
-		"IsAdmin":    isAdmin,
-	}
+		"Users":             users,
+		"UserJoined":        userJoined,
+		"UserName":          user.Name,
+		"AdminToken":        adminToken,
+		"IsAdmin":           isAdmin,
+		"SongsPerPlayer":    songsPerPlayer,
+		"SongSlots":         songSlots,
+		"Settings":          settings,
+		"ScoringModes":      ScoringModes,
+		"TeamGuessPolicies": TeamGuessPolicies,
+		"MaxWagerBudget":    MaxWagerBudget,
+		"Teams":             teams,
+		"UserTeamID":        userTeamID,
+		"Players":           players,
+	}
+
+	h.render(w, r, data)
+}
 
-	h.templates.ExecuteTemplate(w, "layout", data)
+// songSlot is a song search field of the join form or the form for changing
+// your songs.
+type songSlot struct {
+	Number int
+	Song   Song
 }
 
 func (h *Handler) GamePage(w http.ResponseWriter, r *http.Request) {
 	if h.templates == nil {
-		http.Error(w, "skabeloner ikke indlæst", http.StatusInternalServerError)
+		http.Error(w, h.t(r, "error.templates_missing"), http.StatusInternalServerError)
 		return
 	}
 	partyID := h.getPartyID(r)
-	userName := r.URL.Query().Get("user")
+	if h.claimLegacySession(w, r, partyID) {
+		return
+	}
 	adminToken := r.URL.Query().Get("admin_token")
 
 	started, currentRound, showResults, err := h.service.GetPartyState(r.Context(), partyID)
@@ -120,8 +204,25 @@ func (h *Handler) GamePage(w http.ResponseWriter, r *http.Request) {
 	}
 
 	globalLeaderboard, _ := h.service.GetLeaderboard(r.Context(), partyID, 0)
+	settings, _ := h.service.GetSettings(r.Context(), partyID)
+	var teamLeaderboard []TeamLeaderboardEntry
+	if settings.TeamMode {
+		teamLeaderboard, _ = h.service.GetTeamLeaderboard(r.Context(), partyID, 0)
+	}
+	wagerMode := settings.ScoringMode == ScoringWager
+	var wagerOptions []int
+	if wagerMode {
+		for i := MinWager; i <= MaxWager; i++ {
+			wagerOptions = append(wagerOptions, i)
+		}
+	}
 	isAdmin, _ := h.service.VerifyAdmin(r.Context(), partyID, adminToken)
-	userGuesses, _ := h.service.GetUserGuesses(r.Context(), partyID, userName)
+	deadline, _ := h.service.GetRoundDeadline(r.Context(), partyID)
+	user, _ := h.currentUser(r, partyID)
+	userGuesses, _ := h.service.GetUserGuesses(r.Context(), partyID, user.Name)
+	userWagers, _ := h.service.GetUserWagers(r.Context(), partyID, user.Name)
+	wagerBudgetLeft, _ := h.service.RemainingWagerBudget(r.Context(), partyID, user.ID, currentRound)
+	ownSongs, _ := h.service.OwnSongIDs(r.Context(), partyID, user.ID)
 
 	// Check if game is over
 	gameOver := false
@@ -143,30 +244,51 @@ func (h *Handler) GamePage(w http.ResponseWriter, r *http.Request) {
 		"Songs":             songs,
 		"TotalSongs":        totalSongs,
 		"Users":             users,
-		"UserName":          userName,
+		"UserID":            user.ID,
+		"UserName":          user.Name,
 		"AdminToken":        adminToken,
 		"Leaderboard":       leaderboard,
 		"GlobalLeaderboard": globalLeaderboard,
 		"PreviousResults":   previousResults,
 		"IsAdmin":           isAdmin,
 		"UserGuesses":       userGuesses,
-	}
-
-	h.templates.ExecuteTemplate(w, "layout", data)
+		"TeamMode":          settings.TeamMode,
+		"TeamLeaderboard":   teamLeaderboard,
+		"CanChangeGuess":    settings.AllowGuessChanges || (settings.TeamMode && settings.TeamGuessPolicy == TeamGuessLast),
+		"OwnSongs":          ownSongs,
+		"WagerMode":         wagerMode,
+		"WagerOptions":      wagerOptions,
+		"WagerBudgetLeft":   wagerBudgetLeft,
+		"UserWagers":        userWagers,
+		"HasDeadline":       !deadline.IsZero() && !showResults,
+		"RemainingSeconds":  remainingSeconds(deadline),
+	}
+
+	h.render(w, r, data)
 }
 
 // UI Action Handlers (Form Submissions)
 
 func (h *Handler) UICreateParty(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
-		http.Error(w, "Metode ikke tilladt", http.StatusMethodNotAllowed)
+		http.Error(w, h.t(r, "error.method_not_allowed"), http.StatusMethodNotAllowed)
 		return
 	}
 
 	name := r.FormValue("name")
-	id, adminToken, err := h.service.CreateParty(r.Context(), name)
+	songsPerPlayer := DefaultSongsPerPlayer
+	if v := r.FormValue("songs_per_player"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			h.uiError(w, r, newError(CodeInvalidSongCount))
+			return
+		}
+		songsPerPlayer = n
+	}
+
+	id, adminToken, err := h.service.CreateParty(r.Context(), name, songsPerPlayer)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		h.uiError(w, r, err)
 		return
 	}
 
@@ -182,97 +304,144 @@ func (h *Handler) UIPartyRedirect(w http.ResponseWriter, r *http.Request) {
 	http.Redirect(w, r, "/parties/"+id, http.StatusSeeOther)
 }
 
+// UISetLanguage remembers the language a visitor picked in a cookie and sends
+// them back to the page they came from. An empty language clears the choice.
+func (h *Handler) UISetLanguage(w http.ResponseWriter, r *http.Request) {
+	lang := r.FormValue("lang")
+	cookie := &http.Cookie{
+		Name:     i18n.CookieName,
+		Value:    lang,
+		Path:     "/",
+		MaxAge:   365 * 24 * 60 * 60,
+		SameSite: http.SameSiteLaxMode,
+	}
+	if !i18n.Supported(lang) {
+		cookie.Value, cookie.MaxAge = "", -1
+	}
+	http.SetCookie(w, cookie)
+
+	// Only redirect within the site.
+	target := r.FormValue("return")
+	if !strings.HasPrefix(target, "/") || strings.HasPrefix(target, "//") || strings.HasPrefix(target, "/\\") {
+		target = "/"
+	}
+	http.Redirect(w, r, target, http.StatusSeeOther)
+}
+
+// songsFromForm reads n songs from the song search fields of a form.
+func songsFromForm(r *http.Request, n int) []SongInput {
+	songs := make([]SongInput, n)
+	for i := range songs {
+		field := fmt.Sprintf("song%d", i+1)
+		songs[i] = SongInput{Title: r.FormValue(field), YouTubeID: r.FormValue(field + "_id"), ThumbnailURL: r.FormValue(field + "_thumb")}
+	}
+	return songs
+}
+
 func (h *Handler) UIJoinParty(w http.ResponseWriter, r *http.Request) {
 	partyID := h.getPartyID(r)
 	userName := r.FormValue("user_name")
 	adminToken := r.FormValue("admin_token")
-	songs := []SongInput{
-		{Title: r.FormValue("song1"), YouTubeID: r.FormValue("song1_id"), ThumbnailURL: r.FormValue("song1_thumb")},
-		{Title: r.FormValue("song2"), YouTubeID: r.FormValue("song2_id"), ThumbnailURL: r.FormValue("song2_thumb")},
-		{Title: r.FormValue("song3"), YouTubeID: r.FormValue("song3_id"), ThumbnailURL: r.FormValue("song3_thumb")},
-	}
 
-	if err := h.service.JoinParty(r.Context(), partyID, userName, songs); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+	songsPerPlayer, err := h.service.GetSongsPerPlayer(r.Context(), partyID)
+	if err != nil {
+		h.uiError(w, r, err)
+		return
+	}
+	userID, token, err := h.service.JoinParty(r.Context(), partyID, userName, songsFromForm(r, songsPerPlayer))
+	if err != nil {
+		h.uiError(w, r, err)
 		return
 	}
+	h.setSession(w, r, partyID, userID, token)
 
-	http.Redirect(w, r, fmt.Sprintf("/parties/%s?user=%s&admin_token=%s", partyID, userName, adminToken), http.StatusSeeOther)
+	http.Redirect(w, r, fmt.Sprintf("/parties/%s?admin_token=%s", partyID, adminToken), http.StatusSeeOther)
 }
 
 func (h *Handler) UIStartCompetition(w http.ResponseWriter, r *http.Request) {
 	partyID := h.getPartyID(r)
 	adminToken := r.FormValue("admin_token")
-	userName := r.FormValue("user_name")
 
 	isAdmin, _ := h.service.VerifyAdmin(r.Context(), partyID, adminToken)
 	if !isAdmin {
-		http.Error(w, "Uautoriseret", http.StatusUnauthorized)
+		h.uiError(w, r, newError(CodeNotAdmin))
 		return
 	}
 
 	if err := h.service.StartCompetition(r.Context(), partyID); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		h.uiError(w, r, err)
 		return
 	}
-	http.Redirect(w, r, fmt.Sprintf("/parties/%s/game?user=%s&admin_token=%s", partyID, userName, adminToken), http.StatusSeeOther)
+	http.Redirect(w, r, fmt.Sprintf("/parties/%s/game?admin_token=%s", partyID, adminToken), http.StatusSeeOther)
 }
 
 func (h *Handler) UINextRound(w http.ResponseWriter, r *http.Request) {
 	partyID := h.getPartyID(r)
 	adminToken := r.FormValue("admin_token")
-	userName := r.FormValue("user_name")
 
 	isAdmin, _ := h.service.VerifyAdmin(r.Context(), partyID, adminToken)
 	if !isAdmin {
-		http.Error(w, "Uautoriseret", http.StatusUnauthorized)
+		h.uiError(w, r, newError(CodeNotAdmin))
 		return
 	}
 
 	if err := h.service.NextRound(r.Context(), partyID); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		h.uiError(w, r, err)
 		return
 	}
-	http.Redirect(w, r, fmt.Sprintf("/parties/%s/game?user=%s&admin_token=%s", partyID, userName, adminToken), http.StatusSeeOther)
+	http.Redirect(w, r, fmt.Sprintf("/parties/%s/game?admin_token=%s", partyID, adminToken), http.StatusSeeOther)
 }
 
 func (h *Handler) UIGuess(w http.ResponseWriter, r *http.Request) {
 	partyID := h.getPartyID(r)
-	userName := r.FormValue("user_name")
 	adminToken := r.FormValue("admin_token")
 	songID, _ := strconv.Atoi(r.FormValue("song_id"))
 	ownerName := r.FormValue("owner_name")
+	wager := MinWager
+	if v := r.FormValue("wager"); v != "" {
+		wager, _ = strconv.Atoi(v)
+	}
+
+	guesser, ok := h.currentUser(r, partyID)
+	if !ok {
+		http.Redirect(w, r, fmt.Sprintf("/parties/%s?admin_token=%s", partyID, adminToken), http.StatusSeeOther)
+		return
+	}
 
 	users, _ := h.service.GetUsers(r.Context(), partyID)
-	var guesserID, ownerID int
+	var ownerID int
 	for _, u := range users {
-		if u.Name == userName {
-			guesserID = u.ID
-		}
 		if u.Name == ownerName {
 			ownerID = u.ID
 		}
 	}
 
-	if guesserID != 0 && ownerID != 0 {
-		h.service.SubmitGuess(r.Context(), guesserID, songID, ownerID)
+	if ownerID != 0 {
+		if err := h.service.SubmitGuessWithWager(r.Context(), guesser.ID, songID, ownerID, wager); err != nil {
+			h.uiError(w, r, err)
+			return
+		}
 	}
 
-	http.Redirect(w, r, fmt.Sprintf("/parties/%s/game?user=%s&admin_token=%s", partyID, userName, adminToken), http.StatusSeeOther)
+	http.Redirect(w, r, fmt.Sprintf("/parties/%s/game?admin_token=%s", partyID, adminToken), http.StatusSeeOther)
 }
 
 func (h *Handler) CreateParty(w http.ResponseWriter, r *http.Request) {
 	var req struct {
-		Name string `json:"name"`
+		Name           string `json:"name"`
+		SongsPerPlayer int    `json:"songs_per_player"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		h.writeError(w, r, newError(CodeInvalidRequest, err))
 		return
 	}
+	if req.SongsPerPlayer == 0 {
+		req.SongsPerPlayer = DefaultSongsPerPlayer
+	}
 
-	id, adminToken, err := h.service.CreateParty(r.Context(), req.Name)
+	id, adminToken, err := h.service.CreateParty(r.Context(), req.Name, req.SongsPerPlayer)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		h.writeError(w, r, err)
 		return
 	}
 
@@ -286,7 +455,7 @@ func (h *Handler) CreateParty(w http.ResponseWriter, r *http.Request) {
 func (h *Handler) JoinParty(w http.ResponseWriter, r *http.Request) {
 	partyID := h.getPartyID(r)
 	if partyID == "" {
-		http.Error(w, "mangler fest-ID", http.StatusBadRequest)
+		h.writeError(w, r, newError(CodeMissingPartyID))
 		return
 	}
 
@@ -295,16 +464,20 @@ func (h *Handler) JoinParty(w http.ResponseWriter, r *http.Request) {
 		Songs []SongInput `json:"songs"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		h.writeError(w, r, newError(CodeInvalidRequest, err))
 		return
 	}
 
-	if err := h.service.JoinParty(r.Context(), partyID, req.Name, req.Songs); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+	userID, token, err := h.service.JoinParty(r.Context(), partyID, req.Name, req.Songs)
+	if err != nil {
+		h.writeError(w, r, err)
 		return
 	}
+	h.setSession(w, r, partyID, userID, token)
 
-	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]int{
+		"user_id": userID,
+	})
 }
 
 func (h *Handler) SearchSongs(w http.ResponseWriter, r *http.Request) {
@@ -314,9 +487,9 @@ func (h *Handler) SearchSongs(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	songs, err := h.service.SearchYouTubeMusic(r.Context(), query)
+	songs, err := h.service.SearchMusic(r.Context(), query)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		h.writeError(w, r, err)
 		return
 	}
 
@@ -326,7 +499,7 @@ func (h *Handler) SearchSongs(w http.ResponseWriter, r *http.Request) {
 func (h *Handler) QRCode(w http.ResponseWriter, r *http.Request) {
 	partyID := h.getPartyID(r)
 	if partyID == "" {
-		http.Error(w, "mangler fest-ID", http.StatusBadRequest)
+		h.writeError(w, r, newError(CodeMissingPartyID))
 		return
 	}
 
@@ -338,7 +511,7 @@ func (h *Handler) QRCode(w http.ResponseWriter, r *http.Request) {
 
 	qrc, err := qrcode.NewWith(joinURL, qrcode.WithErrorCorrectionLevel(qrcode.ErrorCorrectionQuart))
 	if err != nil {
-		http.Error(w, "Kunne ikke generere QR-kode", http.StatusInternalServerError)
+		http.Error(w, h.t(r, "error.qr_failed"), http.StatusInternalServerError)
 		return
 	}
 
@@ -358,45 +531,45 @@ func (nopCloser) Close() error { return nil }
 
 func (h *Handler) SongListPage(w http.ResponseWriter, r *http.Request) {
 	if h.templates == nil {
-		http.Error(w, "skabeloner ikke indlæst", http.StatusInternalServerError)
+		http.Error(w, h.t(r, "error.templates_missing"), http.StatusInternalServerError)
 		return
 	}
 	partyID := h.getPartyID(r)
 	adminToken := r.URL.Query().Get("admin_token")
-	userName := r.URL.Query().Get("user")
 
 	isAdmin, _ := h.service.VerifyAdmin(r.Context(), partyID, adminToken)
 	if !isAdmin {
-		http.Error(w, "Uautoriseret", http.StatusUnauthorized)
+		h.uiError(w, r, newError(CodeNotAdmin))
 		return
 	}
 
 	partyName, _ := h.service.GetPartyName(r.Context(), partyID)
 	songs, _ := h.service.GetPartySongs(r.Context(), partyID)
+	tracks, _ := h.service.GetPlaylist(r.Context(), partyID)
 
 	data := map[string]interface{}{
 		"Party": map[string]string{
 			"ID":   partyID,
 			"Name": partyName,
 		},
-		"Songs":      songs,
-		"AdminToken": adminToken,
-		"UserName":   userName,
-		"IsSongList": true,
+		"Songs":          songs,
+		"RoundPlaylists": RoundPlaylists(tracks),
+		"AdminToken":     adminToken,
+		"IsSongList":     true,
 	}
 
-	h.templates.ExecuteTemplate(w, "layout", data)
+	h.render(w, r, data)
 }
 
 func (h *Handler) StartCompetition(w http.ResponseWriter, r *http.Request) {
 	partyID := h.getPartyID(r)
 	if partyID == "" {
-		http.Error(w, "mangler fest-ID", http.StatusBadRequest)
+		h.writeError(w, r, newError(CodeMissingPartyID))
 		return
 	}
 
 	if err := h.service.StartCompetition(r.Context(), partyID); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		h.writeError(w, r, err)
 		return
 	}
 
@@ -406,46 +579,73 @@ func (h *Handler) StartCompetition(w http.ResponseWriter, r *http.Request) {
 func (h *Handler) GetCurrentRound(w http.ResponseWriter, r *http.Request) {
 	partyID := h.getPartyID(r)
 	if partyID == "" {
-		http.Error(w, "mangler fest-ID", http.StatusBadRequest)
+		h.writeError(w, r, newError(CodeMissingPartyID))
 		return
 	}
 
 	started, currentRound, _, err := h.service.GetPartyState(r.Context(), partyID)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		h.writeError(w, r, err)
 		return
 	}
 
 	if !started {
-		http.Error(w, "konkurrencen er ikke startet", http.StatusBadRequest)
+		h.writeError(w, r, newError(CodeNotStarted))
 		return
 	}
 
 	songs, err := h.service.GetRoundSongs(r.Context(), partyID, currentRound)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		h.writeError(w, r, err)
 		return
 	}
 
-	json.NewEncoder(w).Encode(map[string]interface{}{
+	deadline, err := h.service.GetRoundDeadline(r.Context(), partyID)
+	if err != nil {
+		h.writeError(w, r, err)
+		return
+	}
+
+	resp := map[string]interface{}{
 		"round": currentRound,
 		"songs": songs,
-	})
+	}
+	if !deadline.IsZero() {
+		resp["deadline"] = deadline
+		resp["remaining_seconds"] = remainingSeconds(deadline)
+	}
+	json.NewEncoder(w).Encode(resp)
+}
+
+// remainingSeconds returns the whole seconds left until deadline, never
+// negative.
+func remainingSeconds(deadline time.Time) int {
+	return max(0, int(math.Ceil(time.Until(deadline).Seconds())))
 }
 
 func (h *Handler) SubmitGuess(w http.ResponseWriter, r *http.Request) {
+	partyID := h.getPartyID(r)
+	guesser, ok := h.currentUser(r, partyID)
+	if !ok {
+		h.writeError(w, r, newError(CodeNoSession))
+		return
+	}
+
 	var req struct {
-		GuesserID     int `json:"guesser_id"`
 		SongID        int `json:"song_id"`
 		GuessedUserID int `json:"guessed_user_id"`
+		Wager         int `json:"wager"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		h.writeError(w, r, newError(CodeInvalidRequest, err))
 		return
 	}
+	if req.Wager == 0 {
+		req.Wager = MinWager
+	}
 
-	if err := h.service.SubmitGuess(r.Context(), req.GuesserID, req.SongID, req.GuessedUserID); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+	if err := h.service.SubmitGuessWithWager(r.Context(), guesser.ID, req.SongID, req.GuessedUserID, req.Wager); err != nil {
+		h.writeError(w, r, err)
 		return
 	}
 
@@ -455,7 +655,7 @@ func (h *Handler) SubmitGuess(w http.ResponseWriter, r *http.Request) {
 func (h *Handler) GetLeaderboard(w http.ResponseWriter, r *http.Request) {
 	partyID := h.getPartyID(r)
 	if partyID == "" {
-		http.Error(w, "mangler fest-ID", http.StatusBadRequest)
+		h.writeError(w, r, newError(CodeMissingPartyID))
 		return
 	}
 
@@ -465,14 +665,14 @@ func (h *Handler) GetLeaderboard(w http.ResponseWriter, r *http.Request) {
 		var err error
 		round, err = strconv.Atoi(roundStr)
 		if err != nil {
-			http.Error(w, "ugyldig runde", http.StatusBadRequest)
+			h.writeError(w, r, newError(CodeInvalidRound))
 			return
 		}
 	}
 
 	leaderboard, err := h.service.GetLeaderboard(r.Context(), partyID, round)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		h.writeError(w, r, err)
 		return
 	}
 
@@ -482,12 +682,12 @@ func (h *Handler) GetLeaderboard(w http.ResponseWriter, r *http.Request) {
 func (h *Handler) NextRound(w http.ResponseWriter, r *http.Request) {
 	partyID := h.getPartyID(r)
 	if partyID == "" {
-		http.Error(w, "mangler fest-ID", http.StatusBadRequest)
+		h.writeError(w, r, newError(CodeMissingPartyID))
 		return
 	}
 
 	if err := h.service.NextRound(r.Context(), partyID); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		h.writeError(w, r, err)
 		return
 	}
 
@@ -497,13 +697,13 @@ func (h *Handler) NextRound(w http.ResponseWriter, r *http.Request) {
 func (h *Handler) GetUsers(w http.ResponseWriter, r *http.Request) {
 	partyID := h.getPartyID(r)
 	if partyID == "" {
-		http.Error(w, "mangler fest-ID", http.StatusBadRequest)
+		h.writeError(w, r, newError(CodeMissingPartyID))
 		return
 	}
 
 	users, err := h.service.GetUsers(r.Context(), partyID)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		h.writeError(w, r, err)
 		return
 	}
 
@@ -513,31 +713,42 @@ func (h *Handler) GetUsers(w http.ResponseWriter, r *http.Request) {
 func (h *Handler) GetRoundResults(w http.ResponseWriter, r *http.Request) {
 	partyID := h.getPartyID(r)
 	if partyID == "" {
-		http.Error(w, "mangler fest-ID", http.StatusBadRequest)
+		h.writeError(w, r, newError(CodeMissingPartyID))
 		return
 	}
 
 	roundStr := r.URL.Query().Get("round")
 	if roundStr == "" {
-		http.Error(w, "mangler runde", http.StatusBadRequest)
+		h.writeError(w, r, newError(CodeMissingRound))
 		return
 	}
 
 	round, err := strconv.Atoi(roundStr)
 	if err != nil {
-		http.Error(w, "ugyldig runde", http.StatusBadRequest)
+		h.writeError(w, r, newError(CodeInvalidRound))
 		return
 	}
 
 	results, err := h.service.GetRoundResults(r.Context(), partyID, round)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		h.writeError(w, r, err)
 		return
 	}
 
 	json.NewEncoder(w).Encode(results)
 }
 
+// lang returns the language to answer a request in.
+func (h *Handler) lang(r *http.Request) string {
+	partyLanguage, _ := h.service.GetPartyLanguage(r.Context(), h.getPartyID(r))
+	return i18n.FromRequest(r, partyLanguage)
+}
+
+// t translates a message into the language of a request.
+func (h *Handler) t(r *http.Request, key string, args ...any) string {
+	return i18n.T(h.lang(r), key, args...)
+}
+
 func (h *Handler) getPartyID(r *http.Request) string {
 	id := r.PathValue("id")
 	if id != "" {
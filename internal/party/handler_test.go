@@ -6,9 +6,13 @@ import (
 	"database/sql"
 	"encoding/json"
 	"fmt"
+	"image/png"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/jehaj/new-year-wrapped/internal/db"
 	"github.com/jehaj/new-year-wrapped/internal/party"
@@ -18,7 +22,7 @@ import (
 func TestHandler_CreateParty(t *testing.T) {
 	database, _ := sql.Open("sqlite3", ":memory:")
 	defer database.Close()
-	_, _ = database.Exec(db.Schema)
+	_, _ = db.Migrate(database)
 
 	service := party.NewService(database, nil)
 	handler := party.NewHandler(service)
@@ -50,7 +54,7 @@ func TestHandler_CreateParty(t *testing.T) {
 func TestHandler_JoinParty(t *testing.T) {
 	database, _ := sql.Open("sqlite3", ":memory:")
 	defer database.Close()
-	_, _ = database.Exec(db.Schema)
+	_, _ = db.Migrate(database)
 	_, _ = database.Exec("INSERT INTO parties (id, name, admin_token) VALUES (?, ?, ?)", "p1", "Test Party", "token")
 
 	service := party.NewService(database, nil)
@@ -79,12 +83,15 @@ func TestHandler_JoinParty(t *testing.T) {
 		if rr.Code != http.StatusOK {
 			t.Errorf("expected status 200, got %d: %s", rr.Code, rr.Body.String())
 		}
+		if len(rr.Result().Cookies()) != 1 {
+			t.Errorf("expected a session cookie, got %v", rr.Result().Cookies())
+		}
 	})
 
 	t.Run("Join non-existent party", func(t *testing.T) {
 		// Given: A non-existent party ID
 		// When: A POST request is made to /parties/{id}/join
-		// Then: A 500 status is returned
+		// Then: A 404 status is returned with the error code as JSON
 		body, _ := json.Marshal(map[string]interface{}{
 			"name": "Nikolaj",
 			"songs": []party.SongInput{
@@ -96,15 +103,43 @@ func TestHandler_JoinParty(t *testing.T) {
 
 		handler.JoinParty(rr, req)
 
-		if rr.Code != http.StatusInternalServerError {
-			t.Errorf("expected status 500, got %d", rr.Code)
+		if rr.Code != http.StatusNotFound {
+			t.Errorf("expected status 404, got %d", rr.Code)
+		}
+		var resp struct{ Error, Code string }
+		if err := json.NewDecoder(rr.Body).Decode(&resp); err != nil {
+			t.Fatalf("expected a JSON error body: %v", err)
+		}
+		if resp.Code != string(party.CodePartyNotFound) || resp.Error == "" {
+			t.Errorf("unexpected error body %+v", resp)
+		}
+	})
+
+	t.Run("Errors follow the request language", func(t *testing.T) {
+		// Given: A non-existent party ID and a browser preferring English
+		// When: A POST request is made to /parties/{id}/join
+		// Then: The error is written in English
+		body, _ := json.Marshal(map[string]interface{}{
+			"name":  "Nikolaj",
+			"songs": []party.SongInput{{Title: "Song A"}, {Title: "Song B"}, {Title: "Song C"}},
+		})
+		req := httptest.NewRequest("POST", "/parties/non-existent/join", bytes.NewBuffer(body))
+		req.Header.Set("Accept-Language", "en-US,en;q=0.9,da;q=0.8")
+		rr := httptest.NewRecorder()
+
+		handler.JoinParty(rr, req)
+
+		var resp struct{ Error string }
+		json.NewDecoder(rr.Body).Decode(&resp)
+		if resp.Error != "party non-existent does not exist" {
+			t.Errorf("expected an English error, got %q", resp.Error)
 		}
 	})
 
 	t.Run("Join with wrong number of songs", func(t *testing.T) {
 		// Given: An existing party
 		// When: A POST request is made to /parties/{id}/join with only 1 song
-		// Then: A 500 status is returned
+		// Then: A 400 status is returned
 		body, _ := json.Marshal(map[string]interface{}{
 			"name":  "Nikolaj",
 			"songs": []party.SongInput{{Title: "Song A"}},
@@ -114,8 +149,8 @@ func TestHandler_JoinParty(t *testing.T) {
 
 		handler.JoinParty(rr, req)
 
-		if rr.Code != http.StatusInternalServerError {
-			t.Errorf("expected status 500, got %d", rr.Code)
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("expected status 400, got %d", rr.Code)
 		}
 	})
 }
@@ -123,7 +158,7 @@ func TestHandler_JoinParty(t *testing.T) {
 func TestHandler_Competition(t *testing.T) {
 	database, _ := sql.Open("sqlite3", ":memory:")
 	defer database.Close()
-	_, _ = database.Exec(db.Schema)
+	_, _ = db.Migrate(database)
 	partyID := "comp-h"
 	_, _ = database.Exec("INSERT INTO parties (id, name, admin_token) VALUES (?, ?, ?)", partyID, "Comp Handler Party", "token")
 
@@ -183,7 +218,7 @@ func TestHandler_Competition(t *testing.T) {
 func TestHandler_Guessing(t *testing.T) {
 	database, _ := sql.Open("sqlite3", ":memory:")
 	defer database.Close()
-	_, _ = database.Exec(db.Schema)
+	_, _ = db.Migrate(database)
 	partyID := "guess-h"
 	_, _ = database.Exec("INSERT INTO parties (id, name, admin_token, started, current_round) VALUES (?, ?, ?, TRUE, 1)", partyID, "Guess Handler Party", "token")
 
@@ -200,25 +235,71 @@ func TestHandler_Guessing(t *testing.T) {
 	service := party.NewService(database, nil)
 	handler := party.NewHandler(service)
 
+	_, bobToken, err := service.ClaimSession(context.Background(), partyID, "Bob")
+	if err != nil {
+		t.Fatalf("ClaimSession failed: %v", err)
+	}
+
+	t.Run("Submit guess without session", func(t *testing.T) {
+		// Given: A started competition
+		// When: A guess is posted without a session cookie
+		// Then: It is rejected with a 401 status
+		body, _ := json.Marshal(map[string]int{
+			"song_id":         int(song1ID),
+			"guessed_user_id": int(aliceID),
+		})
+		req := httptest.NewRequest("POST", "/parties/"+partyID+"/guess", bytes.NewBuffer(body))
+		rr := httptest.NewRecorder()
+		handler.SubmitGuess(rr, req)
+
+		if rr.Code != http.StatusUnauthorized {
+			t.Errorf("expected status 401, got %d", rr.Code)
+		}
+	})
+
 	t.Run("Submit guess", func(t *testing.T) {
 		// Given: A started competition
-		// When: A POST request is made to /parties/{id}/guess with a valid guess
+		// When: A POST request is made to /parties/{id}/guess with a valid guess and Bob's session
 		// Then: The guess is recorded and a 200 status is returned
 		body, _ := json.Marshal(map[string]int{
-			"guesser_id":      int(bobID),
 			"song_id":         int(song1ID),
 			"guessed_user_id": int(aliceID),
 		})
 		req := httptest.NewRequest("POST", "/parties/"+partyID+"/guess", bytes.NewBuffer(body))
+		req.AddCookie(handler.SessionCookie(partyID, int(bobID), bobToken))
 		rr := httptest.NewRecorder()
 		handler.SubmitGuess(rr, req)
 
 		if rr.Code != http.StatusOK {
 			t.Errorf("expected status 200, got %d", rr.Code)
 		}
+	})
+
+	t.Run("Round leaderboard of the open round", func(t *testing.T) {
+		// Given: An open round with Bob's correct guess
+		// When: The leaderboard of that round is requested
+		// Then: It is refused as not revealed, and served once revealed
+		get := func() *httptest.ResponseRecorder {
+			req := httptest.NewRequest("GET", "/parties/"+partyID+"/leaderboard?round=1", nil)
+			req.SetPathValue("id", partyID)
+			rr := httptest.NewRecorder()
+			handler.GetLeaderboard(rr, req)
+			return rr
+		}
+
+		rr := get()
+		var resp struct{ Code string }
+		json.NewDecoder(rr.Body).Decode(&resp)
+		if rr.Code != http.StatusForbidden || resp.Code != string(party.CodeRoundNotRevealed) {
+			t.Errorf("expected status 403 with code %q, got %d %q", party.CodeRoundNotRevealed, rr.Code, resp.Code)
+		}
 
 		// Reveal the round
 		handler.NextRound(httptest.NewRecorder(), httptest.NewRequest("POST", "/parties/"+partyID+"/next", nil))
+
+		if rr := get(); rr.Code != http.StatusOK {
+			t.Errorf("expected status 200 once revealed, got %d: %s", rr.Code, rr.Body.String())
+		}
 	})
 
 	t.Run("Get leaderboard", func(t *testing.T) {
@@ -252,12 +333,12 @@ func TestHandler_Guessing(t *testing.T) {
 func TestGetUsersHandler(t *testing.T) {
 	dbConn, _ := sql.Open("sqlite3", ":memory:")
 	defer dbConn.Close()
-	dbConn.Exec(db.Schema)
+	db.Migrate(dbConn)
 
 	svc := party.NewService(dbConn, nil)
 	h := party.NewHandler(svc)
 
-	partyID, _, _ := svc.CreateParty(context.Background(), "Test Party")
+	partyID, _, _ := svc.CreateParty(context.Background(), "Test Party", 3)
 	svc.JoinParty(context.Background(), partyID, "Alice", []party.SongInput{{Title: "S1"}, {Title: "S2"}, {Title: "S3"}})
 
 	req := httptest.NewRequest("GET", "/parties/"+partyID+"/users", nil)
@@ -284,7 +365,7 @@ func TestGetUsersHandler(t *testing.T) {
 func TestHandler_GetLeaderboard(t *testing.T) {
 	database, _ := sql.Open("sqlite3", ":memory:")
 	defer database.Close()
-	_, _ = database.Exec(db.Schema)
+	_, _ = db.Migrate(database)
 	partyID := "leaderboard-h"
 	_, _ = database.Exec("INSERT INTO parties (id, name, admin_token, started, current_round) VALUES (?, ?, ?, TRUE, 1)", partyID, "Leaderboard Handler Party", "token")
 
@@ -330,17 +411,30 @@ func TestHandler_GetLeaderboard(t *testing.T) {
 			t.Error("Bob with score 1 not found in leaderboard")
 		}
 	})
+
+	t.Run("Get leaderboard of unknown party", func(t *testing.T) {
+		// Given: A party ID that does not exist
+		// When: A GET request is made to /parties/{id}/leaderboard
+		// Then: The party is not found
+		req := httptest.NewRequest("GET", "/parties/missing/leaderboard", nil)
+		rr := httptest.NewRecorder()
+		handler.GetLeaderboard(rr, req)
+
+		if rr.Code != http.StatusNotFound {
+			t.Errorf("expected status 404, got %d", rr.Code)
+		}
+	})
 }
 
 func TestHandler_GetRoundResults(t *testing.T) {
 	dbConn, _ := sql.Open("sqlite3", ":memory:")
 	defer dbConn.Close()
-	dbConn.Exec(db.Schema)
+	db.Migrate(dbConn)
 
 	svc := party.NewService(dbConn, nil)
 	h := party.NewHandler(svc)
 
-	partyID, _, _ := svc.CreateParty(context.Background(), "Test Party")
+	partyID, _, _ := svc.CreateParty(context.Background(), "Test Party", 3)
 	svc.JoinParty(context.Background(), partyID, "Alice", []party.SongInput{{Title: "S1"}, {Title: "S2"}, {Title: "S3"}})
 	svc.StartCompetition(context.Background(), partyID)
 	svc.NextRound(context.Background(), partyID)
@@ -363,4 +457,613 @@ func TestHandler_GetRoundResults(t *testing.T) {
 	if len(results) != 3 { // Alice has 3 songs, default songs_per_round is 5, so all 3 should be in round 1
 		t.Errorf("expected 3 results, got %d", len(results))
 	}
+
+	// Given: A party ID that does not exist
+	// When: A GET request is made to /parties/{id}/results
+	// Then: The party is not found
+	req = httptest.NewRequest("GET", "/parties/NOPE/results?round=1", nil)
+	req.SetPathValue("id", "NOPE")
+	w = httptest.NewRecorder()
+	h.GetRoundResults(w, req)
+
+	var resp struct{ Code string }
+	json.NewDecoder(w.Body).Decode(&resp)
+	if w.Code != http.StatusNotFound || resp.Code != string(party.CodePartyNotFound) {
+		t.Errorf("expected status 404 with code %q, got %d %q", party.CodePartyNotFound, w.Code, resp.Code)
+	}
+}
+
+func TestHandler_Events(t *testing.T) {
+	database, _ := sql.Open("sqlite3", ":memory:")
+	defer database.Close()
+	database.SetMaxOpenConns(1)
+	_, _ = db.Migrate(database)
+
+	service := party.NewService(database, nil)
+	handler := party.NewHandler(service)
+	partyID, _, _ := service.CreateParty(context.Background(), "Event Party", 3)
+
+	// Given: A client connected to the event stream
+	// When: A player joins the party and the client disconnects
+	// Then: The client receives a join event and its subscription is removed
+	ctx, cancel := context.WithCancel(context.Background())
+	req := httptest.NewRequest("GET", "/parties/"+partyID+"/events", nil).WithContext(ctx)
+	req.SetPathValue("id", partyID)
+	rr := httptest.NewRecorder()
+
+	done := make(chan struct{})
+	go func() {
+		handler.Events(rr, req)
+		close(done)
+	}()
+
+	for service.Events().Subscribers(partyID) == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	if _, _, err := service.JoinParty(context.Background(), partyID, "Alice", []party.SongInput{{Title: "S1"}, {Title: "S2"}, {Title: "S3"}}); err != nil {
+		t.Fatalf("JoinParty failed: %v", err)
+	}
+	time.Sleep(10 * time.Millisecond)
+	cancel()
+	<-done
+
+	if !strings.Contains(rr.Body.String(), "event: join\ndata: {\"user_name\":\"Alice\"}") {
+		t.Errorf("expected join event in stream, got %q", rr.Body.String())
+	}
+	if n := service.Events().Subscribers(partyID); n != 0 {
+		t.Errorf("expected no subscribers after disconnect, got %d", n)
+	}
+}
+
+func TestHandler_Settings(t *testing.T) {
+	database, _ := sql.Open("sqlite3", ":memory:")
+	defer database.Close()
+	_, _ = db.Migrate(database)
+
+	service := party.NewService(database, nil)
+	handler := party.NewHandler(service)
+	partyID, adminToken, _ := service.CreateParty(context.Background(), "Settings Party", 3)
+
+	t.Run("Requires admin token", func(t *testing.T) {
+		// Given: A party
+		// When: Its settings are requested without an admin token
+		// Then: A 401 status is returned
+		req := httptest.NewRequest("GET", "/parties/"+partyID+"/settings", nil)
+		req.SetPathValue("id", partyID)
+		rr := httptest.NewRecorder()
+		handler.RequireAdmin(handler.GetSettings)(rr, req)
+
+		if rr.Code != http.StatusUnauthorized {
+			t.Errorf("expected status 401, got %d", rr.Code)
+		}
+	})
+
+	t.Run("Patch settings", func(t *testing.T) {
+		// Given: A party that has not started
+		// When: The admin patches songs per round
+		// Then: The updated settings are returned
+		req := httptest.NewRequest("PATCH", "/parties/"+partyID+"/settings", strings.NewReader(`{"songs_per_round": 3}`))
+		req.SetPathValue("id", partyID)
+		req.Header.Set("X-Admin-Token", adminToken)
+		rr := httptest.NewRecorder()
+		handler.RequireAdmin(handler.UpdateSettings)(rr, req)
+
+		if rr.Code != http.StatusOK {
+			t.Fatalf("expected status 200, got %d: %s", rr.Code, rr.Body.String())
+		}
+		var settings party.Settings
+		json.NewDecoder(rr.Body).Decode(&settings)
+		if settings.SongsPerRound != 3 {
+			t.Errorf("expected 3 songs per round, got %d", settings.SongsPerRound)
+		}
+	})
+}
+
+func TestHandler_Wrapped(t *testing.T) {
+	database, _ := sql.Open("sqlite3", ":memory:")
+	defer database.Close()
+	_, _ = db.Migrate(database)
+
+	partyID := "wrapped-handler"
+	_, _ = database.Exec("INSERT INTO parties (id, name, admin_token, started, current_round, songs_per_round) VALUES (?, ?, ?, TRUE, 2, 5)", partyID, "Wrapped Party", "token")
+	res, _ := database.Exec("INSERT INTO users (party_id, name) VALUES (?, ?)", partyID, "Alice")
+	aliceID, _ := res.LastInsertId()
+	_, _ = database.Exec("INSERT INTO songs (user_id, title, shuffle_index) VALUES (?, ?, 0)", aliceID, "Song 1")
+
+	service := party.NewService(database, nil)
+	handler := party.NewHandler(service)
+
+	t.Run("Wrapped as JSON", func(t *testing.T) {
+		// Given: A finished game
+		// When: A player's Wrapped is requested with Accept: application/json
+		// Then: The summary is returned as JSON
+		req := httptest.NewRequest("GET", fmt.Sprintf("/parties/%s/wrapped/%d", partyID, aliceID), nil)
+		req.SetPathValue("id", partyID)
+		req.SetPathValue("user", fmt.Sprint(aliceID))
+		req.Header.Set("Accept", "application/json")
+		rr := httptest.NewRecorder()
+
+		handler.WrappedPage(rr, req)
+
+		if rr.Code != http.StatusOK {
+			t.Fatalf("expected status 200, got %d: %s", rr.Code, rr.Body.String())
+		}
+		var w party.Wrapped
+		if err := json.Unmarshal(rr.Body.Bytes(), &w); err != nil {
+			t.Fatalf("invalid JSON: %v", err)
+		}
+		if w.UserName != "Alice" || w.Rank != 1 || len(w.Songs) != 1 {
+			t.Errorf("unexpected wrapped %+v", w)
+		}
+	})
+
+	t.Run("Invalid player", func(t *testing.T) {
+		req := httptest.NewRequest("GET", "/parties/"+partyID+"/wrapped/abc?format=json", nil)
+		req.SetPathValue("id", partyID)
+		req.SetPathValue("user", "abc")
+		rr := httptest.NewRecorder()
+
+		handler.WrappedPage(rr, req)
+
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("expected status 400, got %d", rr.Code)
+		}
+	})
+}
+
+func TestHandler_WrappedCard(t *testing.T) {
+	database, _ := sql.Open("sqlite3", ":memory:")
+	defer database.Close()
+	_, _ = db.Migrate(database)
+
+	partyID := "card-party"
+	_, _ = database.Exec("INSERT INTO parties (id, name, admin_token, started, current_round, songs_per_round) VALUES (?, ?, ?, TRUE, 2, 5)", partyID, "Card Party", "token")
+	res, _ := database.Exec("INSERT INTO users (party_id, name) VALUES (?, ?)", partyID, "Alice")
+	aliceID, _ := res.LastInsertId()
+	_, _ = database.Exec("INSERT INTO songs (user_id, title, thumbnail_url, shuffle_index) VALUES (?, ?, ?, 0)", aliceID, "Song 1", "http://127.0.0.1:1/unreachable.jpg")
+
+	service := party.NewService(database, nil)
+	handler := party.NewHandler(service)
+
+	// Given: A finished game with an unreachable thumbnail
+	// When: The player's card is requested
+	// Then: A PNG of story size is returned anyway
+	req := httptest.NewRequest("GET", fmt.Sprintf("/parties/%s/wrapped/%d/card.png", partyID, aliceID), nil)
+	req.SetPathValue("id", partyID)
+	req.SetPathValue("user", fmt.Sprint(aliceID))
+	rr := httptest.NewRecorder()
+
+	handler.WrappedCard(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if ct := rr.Header().Get("Content-Type"); ct != "image/png" {
+		t.Errorf("expected image/png, got %s", ct)
+	}
+	cfg, err := png.DecodeConfig(rr.Body)
+	if err != nil {
+		t.Fatalf("invalid PNG: %v", err)
+	}
+	if cfg.Width != party.CardWidth || cfg.Height != party.CardHeight {
+		t.Errorf("expected %dx%d, got %dx%d", party.CardWidth, party.CardHeight, cfg.Width, cfg.Height)
+	}
+}
+
+func TestHandler_SearchSongs(t *testing.T) {
+	database, _ := sql.Open("sqlite3", ":memory:")
+	defer database.Close()
+	_, _ = db.Migrate(database)
+
+	service := party.NewService(database, nil)
+	service.SetMusicProvider(party.DefaultFakeCatalog())
+	handler := party.NewHandler(service)
+
+	// Given: A service backed by the fake catalog
+	// When: A search is made
+	// Then: Matching songs are returned as JSON
+	req := httptest.NewRequest("GET", "/api/search?q=bruno", nil)
+	rr := httptest.NewRecorder()
+
+	handler.SearchSongs(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", rr.Code)
+	}
+	var songs []party.SongInput
+	json.Unmarshal(rr.Body.Bytes(), &songs)
+	if len(songs) != 2 {
+		t.Errorf("expected 2 songs, got %v", songs)
+	}
+}
+
+func TestHandler_ExportImport(t *testing.T) {
+	database, _ := sql.Open("sqlite3", ":memory:")
+	defer database.Close()
+	_, _ = db.Migrate(database)
+
+	service := party.NewService(database, nil)
+	handler := party.NewHandler(service)
+	ctx := context.Background()
+	partyID, adminToken, _ := service.CreateParty(ctx, "Export Party", 1)
+	service.JoinParty(ctx, partyID, "Alice", []party.SongInput{{Title: "Alice's Song"}})
+
+	t.Run("Export requires admin token", func(t *testing.T) {
+		req := httptest.NewRequest("GET", "/parties/"+partyID+"/export", nil)
+		req.SetPathValue("id", partyID)
+		rr := httptest.NewRecorder()
+		handler.RequireAdmin(handler.ExportParty)(rr, req)
+
+		if rr.Code != http.StatusUnauthorized {
+			t.Errorf("expected status 401, got %d", rr.Code)
+		}
+	})
+
+	var exported []byte
+	t.Run("Export", func(t *testing.T) {
+		// Given: A party with a player
+		// When: The admin exports it
+		// Then: A JSON document with the player is returned
+		req := httptest.NewRequest("GET", "/parties/"+partyID+"/export", nil)
+		req.SetPathValue("id", partyID)
+		req.Header.Set("X-Admin-Token", adminToken)
+		rr := httptest.NewRecorder()
+		handler.RequireAdmin(handler.ExportParty)(rr, req)
+
+		if rr.Code != http.StatusOK {
+			t.Fatalf("expected status 200, got %d: %s", rr.Code, rr.Body.String())
+		}
+		exported = rr.Body.Bytes()
+		var export party.PartyExport
+		json.Unmarshal(exported, &export)
+		if len(export.Users) != 1 || export.Users[0].Name != "Alice" {
+			t.Errorf("expected Alice in export, got %+v", export.Users)
+		}
+	})
+
+	t.Run("Import", func(t *testing.T) {
+		// Given: An exported party
+		// When: It is posted to /parties/import
+		// Then: A new party is created and a 201 status is returned with id and admin_token
+		req := httptest.NewRequest("POST", "/parties/import", bytes.NewReader(exported))
+		rr := httptest.NewRecorder()
+		handler.ImportParty(rr, req)
+
+		if rr.Code != http.StatusCreated {
+			t.Fatalf("expected status 201, got %d: %s", rr.Code, rr.Body.String())
+		}
+		var resp map[string]string
+		json.Unmarshal(rr.Body.Bytes(), &resp)
+		users, _ := service.GetUsers(ctx, resp["id"])
+		if len(users) != 1 || users[0].Name != "Alice" || resp["admin_token"] == "" {
+			t.Errorf("expected the imported party to have Alice, got %v and %+v", resp, users)
+		}
+	})
+
+	t.Run("Import an export without teams and wagers", func(t *testing.T) {
+		// Given: A version 1 export from before teams and wagers
+		// When: It is posted to /parties/import
+		// Then: The party is imported without teams, its guess with the
+		// smallest wager
+		old := `{
+			"version": 1,
+			"party": {
+				"name": "Old Party",
+				"settings": {"songs_per_round": 5, "songs_per_player": 1, "scoring_mode": "standard"},
+				"started": true, "current_round": 1, "show_results": true
+			},
+			"users": [{"id": 1, "name": "Alice"}, {"id": 2, "name": "Bob"}],
+			"songs": [
+				{"id": 1, "user_id": 1, "title": "Alice's Song", "shuffle_index": 0},
+				{"id": 2, "user_id": 2, "title": "Bob's Song", "shuffle_index": 1}
+			],
+			"guesses": [{"guesser_id": 2, "song_id": 1, "guessed_user_id": 1}]
+		}`
+		req := httptest.NewRequest("POST", "/parties/import", strings.NewReader(old))
+		rr := httptest.NewRecorder()
+		handler.ImportParty(rr, req)
+
+		if rr.Code != http.StatusCreated {
+			t.Fatalf("expected status 201, got %d: %s", rr.Code, rr.Body.String())
+		}
+		var resp map[string]string
+		json.Unmarshal(rr.Body.Bytes(), &resp)
+		teams, _ := service.GetTeams(ctx, resp["id"])
+		wagers, _ := service.GetUserWagers(ctx, resp["id"], "Bob")
+		if len(teams) != 0 || len(wagers) != 1 {
+			t.Errorf("expected no teams and one wager, got %+v and %v", teams, wagers)
+		}
+		for _, wager := range wagers {
+			if wager != party.MinWager {
+				t.Errorf("expected wager %d, got %d", party.MinWager, wager)
+			}
+		}
+	})
+
+	t.Run("Import rejects invalid export", func(t *testing.T) {
+		req := httptest.NewRequest("POST", "/parties/import", strings.NewReader(`{"version": 1, "party": {"name": "Broken"}}`))
+		rr := httptest.NewRecorder()
+		handler.ImportParty(rr, req)
+
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("expected status 400, got %d", rr.Code)
+		}
+	})
+}
+
+func TestHandler_Playlist(t *testing.T) {
+	database, _ := sql.Open("sqlite3", ":memory:")
+	defer database.Close()
+	_, _ = db.Migrate(database)
+
+	service := party.NewService(database, nil)
+	service.SetMusicProvider(party.DefaultFakeCatalog())
+	handler := party.NewHandler(service)
+	ctx := context.Background()
+	partyID, adminToken, _ := service.CreateParty(ctx, "Playlist Party", 1)
+	service.JoinParty(ctx, partyID, "Alice", []party.SongInput{{YouTubeID: "fake-espresso"}})
+	service.StartCompetition(ctx, partyID)
+
+	t.Run("Requires admin token", func(t *testing.T) {
+		req := httptest.NewRequest("GET", "/parties/"+partyID+"/playlist.m3u", nil)
+		req.SetPathValue("id", partyID)
+		rr := httptest.NewRecorder()
+		handler.RequireAdmin(handler.PlaylistM3U)(rr, req)
+
+		if rr.Code != http.StatusUnauthorized {
+			t.Errorf("expected status 401, got %d", rr.Code)
+		}
+	})
+
+	t.Run("M3U download", func(t *testing.T) {
+		// Given: A started party with a song from the catalog
+		// When: The admin downloads the M3U playlist
+		// Then: The song's URL is in it
+		req := httptest.NewRequest("GET", "/parties/"+partyID+"/playlist.m3u?admin_token="+adminToken, nil)
+		req.SetPathValue("id", partyID)
+		rr := httptest.NewRecorder()
+		handler.RequireAdminDownload(handler.PlaylistM3U)(rr, req)
+
+		if rr.Code != http.StatusOK {
+			t.Fatalf("expected status 200, got %d: %s", rr.Code, rr.Body.String())
+		}
+		if !strings.Contains(rr.Body.String(), "https://music.example/track/fake-espresso") {
+			t.Errorf("expected the song in the playlist, got:\n%s", rr.Body.String())
+		}
+	})
+
+	t.Run("Round links", func(t *testing.T) {
+		req := httptest.NewRequest("GET", "/parties/"+partyID+"/playlist/rounds", nil)
+		req.SetPathValue("id", partyID)
+		req.Header.Set("X-Admin-Token", adminToken)
+		rr := httptest.NewRecorder()
+		handler.RequireAdmin(handler.RoundPlaylists)(rr, req)
+
+		var playlists []party.RoundPlaylist
+		json.NewDecoder(rr.Body).Decode(&playlists)
+		if len(playlists) != 1 || !strings.HasSuffix(playlists[0].URL, "video_ids=fake-espresso") {
+			t.Errorf("expected one round with the song, got %+v", playlists)
+		}
+	})
+}
+
+func TestHandler_Teams(t *testing.T) {
+	database, _ := sql.Open("sqlite3", ":memory:")
+	defer database.Close()
+	_, _ = db.Migrate(database)
+
+	service := party.NewService(database, nil)
+	handler := party.NewHandler(service)
+	ctx := context.Background()
+	partyID, adminToken, _ := service.CreateParty(ctx, "Team Party", 1)
+
+	t.Run("Creating a team requires admin token", func(t *testing.T) {
+		req := httptest.NewRequest("POST", "/parties/"+partyID+"/teams", strings.NewReader(`{"name": "Red"}`))
+		req.SetPathValue("id", partyID)
+		rr := httptest.NewRecorder()
+		handler.RequireAdmin(handler.CreateTeam)(rr, req)
+
+		if rr.Code != http.StatusUnauthorized {
+			t.Errorf("expected status 401, got %d", rr.Code)
+		}
+	})
+
+	t.Run("Create team and pick it", func(t *testing.T) {
+		// Given: A party and a joined player
+		// When: The admin creates a team and the player picks it
+		// Then: The team lists the player as a member
+		req := httptest.NewRequest("POST", "/parties/"+partyID+"/teams", strings.NewReader(`{"name": "Red"}`))
+		req.SetPathValue("id", partyID)
+		req.Header.Set("X-Admin-Token", adminToken)
+		rr := httptest.NewRecorder()
+		handler.RequireAdmin(handler.CreateTeam)(rr, req)
+		if rr.Code != http.StatusCreated {
+			t.Fatalf("expected status 201, got %d: %s", rr.Code, rr.Body.String())
+		}
+		var team party.Team
+		json.NewDecoder(rr.Body).Decode(&team)
+
+		userID, token, _ := service.JoinParty(ctx, partyID, "Alice", []party.SongInput{{Title: "Song"}})
+		req = httptest.NewRequest("PUT", "/parties/"+partyID+"/team", strings.NewReader(fmt.Sprintf(`{"team_id": %d}`, team.ID)))
+		req.SetPathValue("id", partyID)
+		req.AddCookie(handler.SessionCookie(partyID, userID, token))
+		rr = httptest.NewRecorder()
+		handler.JoinTeam(rr, req)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("expected status 200, got %d: %s", rr.Code, rr.Body.String())
+		}
+
+		req = httptest.NewRequest("GET", "/parties/"+partyID+"/teams", nil)
+		req.SetPathValue("id", partyID)
+		rr = httptest.NewRecorder()
+		handler.GetTeams(rr, req)
+		var teams []party.Team
+		json.NewDecoder(rr.Body).Decode(&teams)
+		if len(teams) != 1 || len(teams[0].Members) != 1 || teams[0].Members[0].Name != "Alice" {
+			t.Errorf("expected Alice on Red, got %+v", teams)
+		}
+	})
+
+	t.Run("Team leaderboard", func(t *testing.T) {
+		req := httptest.NewRequest("GET", "/parties/"+partyID+"/leaderboard/teams", nil)
+		req.SetPathValue("id", partyID)
+		rr := httptest.NewRecorder()
+		handler.GetTeamLeaderboard(rr, req)
+
+		var leaderboard []party.TeamLeaderboardEntry
+		json.NewDecoder(rr.Body).Decode(&leaderboard)
+		if rr.Code != http.StatusOK || len(leaderboard) != 1 || leaderboard[0].TeamName != "Red" {
+			t.Errorf("expected Red on the team leaderboard, got %d %+v", rr.Code, leaderboard)
+		}
+	})
+
+	t.Run("Forms with an invalid team are rejected", func(t *testing.T) {
+		// Given: A joined player and the admin
+		// When: They delete or pick a team whose ID is not a number
+		// Then: Both forms are rejected as bad requests
+		form := url.Values{"admin_token": {adminToken}}
+		req := httptest.NewRequest("POST", "/ui/parties/"+partyID+"/teams/red/delete", strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req.SetPathValue("id", partyID)
+		req.SetPathValue("team", "red")
+		rr := httptest.NewRecorder()
+		handler.UIDeleteTeam(rr, req)
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("expected status 400 deleting, got %d", rr.Code)
+		}
+
+		userID, token, _ := service.JoinParty(ctx, partyID, "Bob", []party.SongInput{{Title: "Song"}})
+		form = url.Values{"team_id": {"red"}}
+		req = httptest.NewRequest("POST", "/ui/parties/"+partyID+"/team", strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req.SetPathValue("id", partyID)
+		req.AddCookie(handler.SessionCookie(partyID, userID, token))
+		rr = httptest.NewRecorder()
+		handler.UIJoinTeam(rr, req)
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("expected status 400 picking, got %d", rr.Code)
+		}
+	})
+}
+
+func TestHandler_Moderation(t *testing.T) {
+	database, _ := sql.Open("sqlite3", ":memory:")
+	defer database.Close()
+	_, _ = db.Migrate(database)
+
+	service := party.NewService(database, nil)
+	handler := party.NewHandler(service)
+	ctx := context.Background()
+	partyID, adminToken, _ := service.CreateParty(ctx, "Lobby Party", 1)
+	userID, _, _ := service.JoinParty(ctx, partyID, "Alcie", []party.SongInput{{Title: "Espresso"}})
+
+	t.Run("Moderation requires admin token", func(t *testing.T) {
+		req := httptest.NewRequest("DELETE", fmt.Sprintf("/parties/%s/users/%d", partyID, userID), nil)
+		req.SetPathValue("id", partyID)
+		req.SetPathValue("user", fmt.Sprint(userID))
+		rr := httptest.NewRecorder()
+		handler.RequireAdmin(handler.RemoveUser)(rr, req)
+
+		if rr.Code != http.StatusUnauthorized {
+			t.Errorf("expected status 401, got %d", rr.Code)
+		}
+	})
+
+	t.Run("Rename a player and replace their song", func(t *testing.T) {
+		// Given: A player with a typo in their name
+		// When: The admin renames them and replaces their song
+		// Then: The players list shows the fixes
+		req := httptest.NewRequest("PATCH", fmt.Sprintf("/parties/%s/users/%d", partyID, userID), strings.NewReader(`{"name": "Alice"}`))
+		req.SetPathValue("id", partyID)
+		req.SetPathValue("user", fmt.Sprint(userID))
+		req.Header.Set("X-Admin-Token", adminToken)
+		rr := httptest.NewRecorder()
+		handler.RequireAdmin(handler.RenameUser)(rr, req)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("expected status 200, got %d: %s", rr.Code, rr.Body.String())
+		}
+
+		players, _ := service.GetPlayers(ctx, partyID)
+		songID := players[0].Songs[0].ID
+		req = httptest.NewRequest("PUT", fmt.Sprintf("/parties/%s/songs/%d", partyID, songID), strings.NewReader(`{"title": "Taste"}`))
+		req.SetPathValue("id", partyID)
+		req.SetPathValue("song", fmt.Sprint(songID))
+		req.Header.Set("X-Admin-Token", adminToken)
+		rr = httptest.NewRecorder()
+		handler.RequireAdmin(handler.UpdateSong)(rr, req)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("expected status 200, got %d: %s", rr.Code, rr.Body.String())
+		}
+
+		req = httptest.NewRequest("GET", "/parties/"+partyID+"/players", nil)
+		req.SetPathValue("id", partyID)
+		req.Header.Set("X-Admin-Token", adminToken)
+		rr = httptest.NewRecorder()
+		handler.RequireAdmin(handler.GetPlayers)(rr, req)
+		json.NewDecoder(rr.Body).Decode(&players)
+		if len(players) != 1 || players[0].Name != "Alice" || players[0].Songs[0].Title != "Taste" {
+			t.Errorf("unexpected players %+v", players)
+		}
+	})
+
+	t.Run("Invalid user ID", func(t *testing.T) {
+		req := httptest.NewRequest("DELETE", "/parties/"+partyID+"/users/abc", nil)
+		req.SetPathValue("id", partyID)
+		req.SetPathValue("user", "abc")
+		req.Header.Set("X-Admin-Token", adminToken)
+		rr := httptest.NewRecorder()
+		handler.RequireAdmin(handler.RemoveUser)(rr, req)
+
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("expected status 400, got %d", rr.Code)
+		}
+	})
+}
+
+func TestHandler_MySongs(t *testing.T) {
+	database, _ := sql.Open("sqlite3", ":memory:")
+	defer database.Close()
+	_, _ = db.Migrate(database)
+
+	service := party.NewService(database, nil)
+	handler := party.NewHandler(service)
+	ctx := context.Background()
+	partyID, _, _ := service.CreateParty(ctx, "Lobby Party", 1)
+	userID, token, _ := service.JoinParty(ctx, partyID, "Alice", []party.SongInput{{Title: "Espresso"}})
+
+	t.Run("Changing songs requires a session", func(t *testing.T) {
+		req := httptest.NewRequest("PUT", "/parties/"+partyID+"/me/songs", strings.NewReader(`{"songs": [{"title": "Taste"}]}`))
+		req.SetPathValue("id", partyID)
+		rr := httptest.NewRecorder()
+		handler.UpdateMySongs(rr, req)
+
+		if rr.Code != http.StatusUnauthorized {
+			t.Errorf("expected status 401, got %d", rr.Code)
+		}
+	})
+
+	t.Run("Change my songs", func(t *testing.T) {
+		// Given: A player in the lobby
+		// When: They replace their song
+		// Then: Their songs list the new song
+		req := httptest.NewRequest("PUT", "/parties/"+partyID+"/me/songs", strings.NewReader(`{"songs": [{"title": "Taste"}]}`))
+		req.SetPathValue("id", partyID)
+		req.AddCookie(handler.SessionCookie(partyID, userID, token))
+		rr := httptest.NewRecorder()
+		handler.UpdateMySongs(rr, req)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("expected status 200, got %d: %s", rr.Code, rr.Body.String())
+		}
+
+		req = httptest.NewRequest("GET", "/parties/"+partyID+"/me/songs", nil)
+		req.SetPathValue("id", partyID)
+		req.AddCookie(handler.SessionCookie(partyID, userID, token))
+		rr = httptest.NewRecorder()
+		handler.GetMySongs(rr, req)
+		var songs []party.Song
+		json.NewDecoder(rr.Body).Decode(&songs)
+		if len(songs) != 1 || songs[0].Title != "Taste" {
+			t.Errorf("unexpected songs %+v", songs)
+		}
+	})
 }
@@ -0,0 +1,340 @@
+package party
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// Until the competition starts the admin can tidy up the lobby: remove a
+// player, fix the spelling of a name or replace a song that was picked by
+// mistake.
+
+// Player is a player of a party together with the songs they submitted.
+type Player struct {
+	ID    int    `json:"id"`
+	Name  string `json:"name"`
+	Songs []Song `json:"songs"`
+}
+
+// GetPlayers returns the players of a party sorted by name, each with their
+// songs in the order they were submitted.
+func (s *Service) GetPlayers(ctx context.Context, partyID string) ([]Player, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT u.id, u.name, s.id, s.title, s.youtube_id, s.thumbnail_url
+		FROM users u
+		LEFT JOIN songs s ON s.user_id = u.id
+		WHERE u.party_id = ?
+		ORDER BY u.name ASC, s.id ASC`, partyID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	players := []Player{}
+	for rows.Next() {
+		var p Player
+		var songID sql.NullInt64
+		var title, youtubeID, thumbnailURL sql.NullString
+		if err := rows.Scan(&p.ID, &p.Name, &songID, &title, &youtubeID, &thumbnailURL); err != nil {
+			return nil, err
+		}
+		if len(players) == 0 || players[len(players)-1].ID != p.ID {
+			p.Songs = []Song{}
+			players = append(players, p)
+		}
+		if songID.Valid {
+			last := &players[len(players)-1]
+			last.Songs = append(last.Songs, Song{ID: int(songID.Int64), Title: title.String, YouTubeID: youtubeID.String, ThumbnailURL: thumbnailURL.String})
+		}
+	}
+	return players, rows.Err()
+}
+
+// RemoveUser removes a player from a party that has not started yet, along
+// with their songs and any guesses by them, on them or on their songs.
+func (s *Service) RemoveUser(ctx context.Context, partyID string, userID int) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := checkNotStarted(ctx, tx, partyID); err != nil {
+		return err
+	}
+	var name string
+	err = tx.QueryRowContext(ctx, "SELECT name FROM users WHERE id = ? AND party_id = ?", userID, partyID).Scan(&name)
+	if err == sql.ErrNoRows {
+		return newError(CodeUserNotFound, userID)
+	}
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		DELETE FROM guesses
+		WHERE guesser_id = ? OR guessed_user_id = ? OR song_id IN (SELECT id FROM songs WHERE user_id = ?)`,
+		userID, userID, userID)
+	if err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, "DELETE FROM songs WHERE user_id = ?", userID); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, "DELETE FROM users WHERE id = ?", userID); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	s.log(partyID, "Removed user %s", name)
+	s.publish(partyID, EventPlayers, nil)
+	return nil
+}
+
+// RenameUser changes the name of a player in a party that has not started
+// yet. Names stay unique within a party.
+func (s *Service) RenameUser(ctx context.Context, partyID string, userID int, name string) error {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return newError(CodeUserNameMissing)
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := checkNotStarted(ctx, tx, partyID); err != nil {
+		return err
+	}
+	var taken bool
+	err = tx.QueryRowContext(ctx, "SELECT EXISTS(SELECT 1 FROM users WHERE party_id = ? AND name = ? AND id != ?)", partyID, name, userID).Scan(&taken)
+	if err != nil {
+		return err
+	}
+	if taken {
+		return newError(CodeNameTaken, name)
+	}
+	res, err := tx.ExecContext(ctx, "UPDATE users SET name = ? WHERE id = ? AND party_id = ?", name, userID, partyID)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return newError(CodeUserNotFound, userID)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	s.log(partyID, "Renamed user %d to %s", userID, name)
+	s.publish(partyID, EventPlayers, nil)
+	return nil
+}
+
+// UpdateSong replaces any song in a party that has not started yet.
+func (s *Service) UpdateSong(ctx context.Context, partyID string, songID int, song SongInput) (Song, error) {
+	songs := []SongInput{song}
+	if err := s.prepareSongs(ctx, songs); err != nil {
+		return Song{}, err
+	}
+	song = songs[0]
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return Song{}, err
+	}
+	defer tx.Rollback()
+
+	if err := checkNotStarted(ctx, tx, partyID); err != nil {
+		return Song{}, err
+	}
+	var exists bool
+	err = tx.QueryRowContext(ctx, `
+		SELECT EXISTS(
+			SELECT 1 FROM songs s
+			JOIN users u ON s.user_id = u.id
+			WHERE s.id = ? AND u.party_id = ?
+		)`, songID, partyID).Scan(&exists)
+	if err != nil {
+		return Song{}, err
+	}
+	if !exists {
+		return Song{}, newError(CodeSongNotFound, songID)
+	}
+
+	if err := replaceSong(ctx, tx, partyID, songID, song); err != nil {
+		return Song{}, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return Song{}, err
+	}
+
+	s.log(partyID, "Updated song %d to %s", songID, song.Title)
+	s.publish(partyID, EventPlayers, nil)
+	return Song{ID: songID, Title: song.Title, YouTubeID: song.YouTubeID, ThumbnailURL: song.ThumbnailURL}, nil
+}
+
+// prepareSongs looks up the titles of songs given only by YouTube ID, like
+// JoinParty, and rejects songs that still have no title.
+func (s *Service) prepareSongs(ctx context.Context, songs []SongInput) error {
+	if err := s.completeSongs(ctx, songs); err != nil {
+		return err
+	}
+	for i := range songs {
+		songs[i].Title = strings.TrimSpace(songs[i].Title)
+		if songs[i].Title == "" {
+			return newError(CodeSongTitleMissing)
+		}
+	}
+	return nil
+}
+
+// replaceSong overwrites a song and matches it against the other songs of
+// the party again.
+func replaceSong(ctx context.Context, tx *sql.Tx, partyID string, songID int, song SongInput) error {
+	// Clear the old title first so the song isn't grouped with itself
+	if _, err := tx.ExecContext(ctx, "UPDATE songs SET title = '', youtube_id = '', song_key = '' WHERE id = ?", songID); err != nil {
+		return err
+	}
+	key, err := assignSongKey(ctx, tx, partyID, song)
+	if err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, "UPDATE songs SET title = ?, youtube_id = ?, thumbnail_url = ?, song_key = ? WHERE id = ?",
+		song.Title, song.YouTubeID, song.ThumbnailURL, key, songID)
+	return err
+}
+
+// pathID parses an integer path value, writing the error code as a bad
+// request response and returning false if it isn't one.
+func (h *Handler) pathID(w http.ResponseWriter, r *http.Request, name string, code ErrorCode) (int, bool) {
+	id, err := strconv.Atoi(r.PathValue(name))
+	if err != nil {
+		h.writeError(w, r, newError(code))
+		return 0, false
+	}
+	return id, true
+}
+
+func (h *Handler) GetPlayers(w http.ResponseWriter, r *http.Request) {
+	partyID := h.getPartyID(r)
+
+	players, err := h.service.GetPlayers(r.Context(), partyID)
+	if err != nil {
+		h.writeError(w, r, err)
+		return
+	}
+	json.NewEncoder(w).Encode(players)
+}
+
+func (h *Handler) RemoveUser(w http.ResponseWriter, r *http.Request) {
+	partyID := h.getPartyID(r)
+	userID, ok := h.pathID(w, r, "user", CodeInvalidPlayer)
+	if !ok {
+		return
+	}
+
+	if err := h.service.RemoveUser(r.Context(), partyID, userID); err != nil {
+		h.writeError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *Handler) RenameUser(w http.ResponseWriter, r *http.Request) {
+	partyID := h.getPartyID(r)
+	userID, ok := h.pathID(w, r, "user", CodeInvalidPlayer)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		Name string `json:"name"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.writeError(w, r, newError(CodeInvalidRequest, err))
+		return
+	}
+
+	if err := h.service.RenameUser(r.Context(), partyID, userID, req.Name); err != nil {
+		h.writeError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+func (h *Handler) UpdateSong(w http.ResponseWriter, r *http.Request) {
+	partyID := h.getPartyID(r)
+	songID, ok := h.pathID(w, r, "song", CodeInvalidSong)
+	if !ok {
+		return
+	}
+
+	var req SongInput
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.writeError(w, r, newError(CodeInvalidRequest, err))
+		return
+	}
+
+	song, err := h.service.UpdateSong(r.Context(), partyID, songID, req)
+	if err != nil {
+		h.writeError(w, r, err)
+		return
+	}
+	json.NewEncoder(w).Encode(song)
+}
+
+// uiModerate runs an admin action from a lobby form and redirects back to
+// the lobby.
+func (h *Handler) uiModerate(w http.ResponseWriter, r *http.Request, action func(partyID string) error) {
+	partyID := h.getPartyID(r)
+	adminToken := r.FormValue("admin_token")
+
+	isAdmin, _ := h.service.VerifyAdmin(r.Context(), partyID, adminToken)
+	if !isAdmin {
+		h.uiError(w, r, newError(CodeNotAdmin))
+		return
+	}
+
+	if err := action(partyID); err != nil {
+		h.uiError(w, r, err)
+		return
+	}
+	http.Redirect(w, r, fmt.Sprintf("/parties/%s?admin_token=%s", partyID, adminToken), http.StatusSeeOther)
+}
+
+func (h *Handler) UIRemoveUser(w http.ResponseWriter, r *http.Request) {
+	h.uiModerate(w, r, func(partyID string) error {
+		userID, _ := strconv.Atoi(r.PathValue("user"))
+		return h.service.RemoveUser(r.Context(), partyID, userID)
+	})
+}
+
+func (h *Handler) UIRenameUser(w http.ResponseWriter, r *http.Request) {
+	h.uiModerate(w, r, func(partyID string) error {
+		userID, _ := strconv.Atoi(r.PathValue("user"))
+		return h.service.RenameUser(r.Context(), partyID, userID, r.FormValue("user_name"))
+	})
+}
+
+func (h *Handler) UIUpdateSong(w http.ResponseWriter, r *http.Request) {
+	h.uiModerate(w, r, func(partyID string) error {
+		songID, _ := strconv.Atoi(r.PathValue("song"))
+		song := SongInput{Title: r.FormValue("title"), YouTubeID: strings.TrimSpace(r.FormValue("youtube_id"))}
+		_, err := h.service.UpdateSong(r.Context(), partyID, songID, song)
+		return err
+	})
+}
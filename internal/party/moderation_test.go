@@ -0,0 +1,111 @@
+package party_test
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+
+	"github.com/jehaj/new-year-wrapped/internal/db"
+	"github.com/jehaj/new-year-wrapped/internal/party"
+)
+
+func TestModeration(t *testing.T) {
+	database, _ := sql.Open("sqlite3", ":memory:")
+	defer database.Close()
+	_, _ = db.Migrate(database)
+
+	service := party.NewService(database, nil)
+	ctx := context.Background()
+	partyID, _, _ := service.CreateParty(ctx, "Lobby Party", 1)
+	aliceID, _, _ := service.JoinParty(ctx, partyID, "Alice", []party.SongInput{{Title: "Espresso"}})
+	bobID, _, _ := service.JoinParty(ctx, partyID, "Bob", []party.SongInput{{Title: "Birds of a Feather"}})
+	trollID, _, _ := service.JoinParty(ctx, partyID, "Troll", []party.SongInput{{Title: "Never Gonna Give You Up"}})
+
+	t.Run("Rename a player", func(t *testing.T) {
+		// Given: Players Alice and Bob
+		// When: The admin renames Bob, first to Alice and then to Bobby
+		// Then: The taken name is rejected and the free one is used
+		if err := service.RenameUser(ctx, partyID, bobID, "Alice"); err == nil {
+			t.Error("expected error when renaming to a taken name")
+		}
+		if err := service.RenameUser(ctx, partyID, bobID, "  "); err == nil {
+			t.Error("expected error when renaming to an empty name")
+		}
+		if err := service.RenameUser(ctx, partyID, bobID, " Bobby "); err != nil {
+			t.Fatalf("RenameUser failed: %v", err)
+		}
+		users, _ := service.GetUsers(ctx, partyID)
+		if len(users) != 3 || users[1].Name != "Bobby" {
+			t.Errorf("expected Bobby among the players, got %+v", users)
+		}
+	})
+
+	t.Run("Remove a player", func(t *testing.T) {
+		// Given: A player who joined with a song
+		// When: The admin removes them
+		// Then: Neither the player nor their song is left in the party
+		if err := service.RemoveUser(ctx, partyID, trollID); err != nil {
+			t.Fatalf("RemoveUser failed: %v", err)
+		}
+		players, err := service.GetPlayers(ctx, partyID)
+		if err != nil {
+			t.Fatalf("GetPlayers failed: %v", err)
+		}
+		if len(players) != 2 {
+			t.Fatalf("expected 2 players, got %+v", players)
+		}
+		var songs int
+		database.QueryRow("SELECT COUNT(*) FROM songs WHERE user_id = ?", trollID).Scan(&songs)
+		if songs != 0 {
+			t.Errorf("expected the removed player's songs to be deleted, found %d", songs)
+		}
+		if err := service.RemoveUser(ctx, partyID, trollID); err == nil {
+			t.Error("expected error when removing a player twice")
+		}
+	})
+
+	t.Run("Replace a song", func(t *testing.T) {
+		// Given: Alice's song Espresso
+		// When: The admin replaces it with a song typed by hand
+		// Then: The new title is stored and empty titles are rejected
+		players, _ := service.GetPlayers(ctx, partyID)
+		songID := players[0].Songs[0].ID
+		if _, err := service.UpdateSong(ctx, partyID, songID, party.SongInput{}); err == nil {
+			t.Error("expected error for a song without a title")
+		}
+		song, err := service.UpdateSong(ctx, partyID, songID, party.SongInput{Title: "Please Please Please"})
+		if err != nil {
+			t.Fatalf("UpdateSong failed: %v", err)
+		}
+		if song.Title != "Please Please Please" {
+			t.Errorf("unexpected song %+v", song)
+		}
+		players, _ = service.GetPlayers(ctx, partyID)
+		if got := players[0].Songs[0].Title; players[0].ID != aliceID || got != "Please Please Please" {
+			t.Errorf("expected Alice's song to be replaced, got %+v", players[0])
+		}
+	})
+
+	t.Run("Songs of other parties cannot be edited", func(t *testing.T) {
+		otherID, _, _ := service.CreateParty(ctx, "Other Party", 1)
+		players, _ := service.GetPlayers(ctx, partyID)
+		if _, err := service.UpdateSong(ctx, otherID, players[0].Songs[0].ID, party.SongInput{Title: "Hijacked"}); err == nil {
+			t.Error("expected error when editing a song through another party")
+		}
+		if err := service.RemoveUser(ctx, otherID, aliceID); err == nil {
+			t.Error("expected error when removing a player through another party")
+		}
+	})
+
+	t.Run("The lobby is locked after the start", func(t *testing.T) {
+		if err := service.StartCompetition(ctx, partyID); err != nil {
+			t.Fatalf("StartCompetition failed: %v", err)
+		}
+		if err := service.RenameUser(ctx, partyID, aliceID, "Alicia"); err == nil {
+			t.Error("expected error when renaming after the start")
+		}
+		if err := service.RemoveUser(ctx, partyID, bobID); err == nil {
+			t.Error("expected error when removing a player after the start")
+		}
+	})
+}
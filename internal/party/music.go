@@ -0,0 +1,223 @@
+package party
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+
+	"github.com/raitonoberu/ytmusic"
+)
+
+// MusicProvider is a music catalog players pick their songs from. The IDs it
+// returns are stored with each song in the youtube_id column.
+type MusicProvider interface {
+	// Search returns the tracks matching a free-text query.
+	Search(ctx context.Context, query string) ([]SongInput, error)
+	// Lookup returns the track with the given ID.
+	Lookup(ctx context.Context, id string) (SongInput, error)
+	// URL returns where a track can be played.
+	URL(id string) string
+	// Thumbnail returns the cover image of a track.
+	Thumbnail(id string) string
+}
+
+// YouTubeMusic searches YouTube Music in the given language and region.
+type YouTubeMusic struct {
+	Language string
+	Region   string
+}
+
+func NewYouTubeMusic(language, region string) *YouTubeMusic {
+	return &YouTubeMusic{Language: language, Region: region}
+}
+
+// ytmusicMu guards the ytmusic package, which reads its language, region and
+// HTTP client from package variables while building a request. It is released
+// once the request is sent, so calls only wait for each other's setup.
+var ytmusicMu sync.Mutex
+
+// call runs fn, which makes one request with the ytmusic package, in the
+// language and region of y. The request is cancelled with ctx.
+func (y *YouTubeMusic) call(ctx context.Context, fn func() error) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	ytmusicMu.Lock()
+	release := sync.OnceFunc(ytmusicMu.Unlock)
+	defer release()
+	ytmusic.Language = y.Language
+	ytmusic.Region = y.Region
+	ytmusic.HTTPClient = &http.Client{Transport: ytmusicTransport{ctx: ctx, release: release}}
+	return fn()
+}
+
+// ytmusicTransport sends a request of the ytmusic package with the context of
+// the call that made it, releasing ytmusicMu as the request is built by then.
+type ytmusicTransport struct {
+	ctx     context.Context
+	release func()
+}
+
+func (t ytmusicTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	t.release()
+	return http.DefaultTransport.RoundTrip(req.WithContext(t.ctx))
+}
+
+func (y *YouTubeMusic) Search(ctx context.Context, query string) ([]SongInput, error) {
+	var result *ytmusic.SearchResult
+	err := y.call(ctx, func() (err error) {
+		result, err = ytmusic.TrackSearch(query).Next()
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var songs []SongInput
+	for _, track := range result.Tracks {
+		songs = append(songs, songFromTrack(*track))
+	}
+	return songs, nil
+}
+
+func (y *YouTubeMusic) Lookup(ctx context.Context, id string) (SongInput, error) {
+	var tracks []*ytmusic.TrackItem
+	err := y.call(ctx, func() (err error) {
+		tracks, err = ytmusic.GetWatchPlaylist(id)
+		return err
+	})
+	if err != nil {
+		return SongInput{}, err
+	}
+	// The watch playlist starts with the track itself
+	if len(tracks) == 0 || tracks[0].VideoID != id {
+		return SongInput{}, newError(CodeSongLookupFailed, id)
+	}
+	return songFromTrack(*tracks[0]), nil
+}
+
+func (y *YouTubeMusic) URL(id string) string {
+	return "https://music.youtube.com/watch?v=" + url.QueryEscape(id)
+}
+
+func (y *YouTubeMusic) Thumbnail(id string) string {
+	return "https://i.ytimg.com/vi/" + url.PathEscape(id) + "/hqdefault.jpg"
+}
+
+func songFromTrack(track ytmusic.TrackItem) SongInput {
+	artist := ""
+	if len(track.Artists) > 0 {
+		artist = track.Artists[0].Name
+	}
+
+	fullTitle := track.Title
+	if artist != "" {
+		fullTitle = fmt.Sprintf("%s - %s", track.Title, artist)
+	}
+
+	thumbnailURL := ""
+	if len(track.Thumbnails) > 0 {
+		thumbnailURL = track.Thumbnails[len(track.Thumbnails)-1].URL
+	}
+
+	return SongInput{
+		Title:        fullTitle,
+		YouTubeID:    track.VideoID,
+		ThumbnailURL: thumbnailURL,
+	}
+}
+
+// FakeCatalog is an in-memory MusicProvider for tests and offline
+// development.
+type FakeCatalog struct {
+	tracks []SongInput
+}
+
+// NewFakeCatalog creates a catalog of the given tracks. Each track needs a
+// unique YouTubeID.
+func NewFakeCatalog(tracks ...SongInput) *FakeCatalog {
+	return &FakeCatalog{tracks: tracks}
+}
+
+// DefaultFakeCatalog returns a small catalog of well-known songs.
+func DefaultFakeCatalog() *FakeCatalog {
+	return NewFakeCatalog(
+		SongInput{Title: "Espresso - Sabrina Carpenter", YouTubeID: "fake-espresso"},
+		SongInput{Title: "Birds of a Feather - Billie Eilish", YouTubeID: "fake-birds"},
+		SongInput{Title: "APT. - ROSÉ & Bruno Mars", YouTubeID: "fake-apt"},
+		SongInput{Title: "Die With A Smile - Lady Gaga & Bruno Mars", YouTubeID: "fake-smile"},
+		SongInput{Title: "Not Like Us - Kendrick Lamar", YouTubeID: "fake-notlikeus"},
+		SongInput{Title: "Good Luck, Babe! - Chappell Roan", YouTubeID: "fake-goodluck"},
+		SongInput{Title: "Texas Hold 'Em - Beyoncé", YouTubeID: "fake-texas"},
+		SongInput{Title: "Million Dollar Baby - Tommy Richman", YouTubeID: "fake-million"},
+	)
+}
+
+func (c *FakeCatalog) Search(ctx context.Context, query string) ([]SongInput, error) {
+	query = strings.ToLower(strings.TrimSpace(query))
+	var songs []SongInput
+	for _, t := range c.tracks {
+		if strings.Contains(strings.ToLower(t.Title), query) {
+			songs = append(songs, t)
+		}
+	}
+	return songs, nil
+}
+
+func (c *FakeCatalog) Lookup(ctx context.Context, id string) (SongInput, error) {
+	for _, t := range c.tracks {
+		if t.YouTubeID == id {
+			return t, nil
+		}
+	}
+	return SongInput{}, newError(CodeSongLookupFailed, id)
+}
+
+func (c *FakeCatalog) URL(id string) string {
+	return "https://music.example/track/" + url.PathEscape(id)
+}
+
+func (c *FakeCatalog) Thumbnail(id string) string {
+	return ""
+}
+
+// SetMusicProvider replaces the catalog songs are searched in.
+func (s *Service) SetMusicProvider(p MusicProvider) {
+	s.music = p
+}
+
+// MusicProvider returns the catalog songs are searched in.
+func (s *Service) MusicProvider() MusicProvider {
+	return s.music
+}
+
+// SearchMusic searches the music provider for songs to join with.
+func (s *Service) SearchMusic(ctx context.Context, query string) ([]SongInput, error) {
+	return s.music.Search(ctx, query)
+}
+
+// completeSongs fills in the title and thumbnail of songs picked by ID only.
+func (s *Service) completeSongs(ctx context.Context, songs []SongInput) error {
+	for i, song := range songs {
+		if song.YouTubeID == "" {
+			continue
+		}
+		if song.Title == "" {
+			found, err := s.music.Lookup(ctx, song.YouTubeID)
+			if err != nil {
+				return err
+			}
+			songs[i].Title = found.Title
+			if song.ThumbnailURL == "" {
+				songs[i].ThumbnailURL = found.ThumbnailURL
+			}
+		}
+		if songs[i].ThumbnailURL == "" {
+			songs[i].ThumbnailURL = s.music.Thumbnail(song.YouTubeID)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,86 @@
+package party_test
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+
+	"github.com/jehaj/new-year-wrapped/internal/db"
+	"github.com/jehaj/new-year-wrapped/internal/party"
+)
+
+func TestFakeCatalog(t *testing.T) {
+	catalog := party.NewFakeCatalog(
+		party.SongInput{Title: "Espresso - Sabrina Carpenter", YouTubeID: "e1"},
+		party.SongInput{Title: "Please Please Please - Sabrina Carpenter", YouTubeID: "p1"},
+		party.SongInput{Title: "Not Like Us - Kendrick Lamar", YouTubeID: "n1"},
+	)
+	ctx := context.Background()
+
+	t.Run("Search matches titles case-insensitively", func(t *testing.T) {
+		songs, err := catalog.Search(ctx, "sabrina")
+		if err != nil {
+			t.Fatalf("Search failed: %v", err)
+		}
+		if len(songs) != 2 {
+			t.Errorf("expected 2 songs, got %d", len(songs))
+		}
+	})
+
+	t.Run("Lookup by ID", func(t *testing.T) {
+		song, err := catalog.Lookup(ctx, "n1")
+		if err != nil || song.Title != "Not Like Us - Kendrick Lamar" {
+			t.Errorf("unexpected lookup result %+v, %v", song, err)
+		}
+		if _, err := catalog.Lookup(ctx, "missing"); err == nil {
+			t.Error("expected error for unknown ID, got nil")
+		}
+	})
+}
+
+func TestYouTubeMusicCancelled(t *testing.T) {
+	// Given: A cancelled context
+	// When: YouTube Music is searched or a track is looked up with it
+	// Then: Both give up with the context's error
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	yt := party.NewYouTubeMusic("da", "DK")
+
+	if _, err := yt.Search(ctx, "espresso"); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected Search to be cancelled, got %v", err)
+	}
+	if _, err := yt.Lookup(ctx, "e1"); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected Lookup to be cancelled, got %v", err)
+	}
+}
+
+func TestJoinWithMusicProvider(t *testing.T) {
+	database, _ := sql.Open("sqlite3", ":memory:")
+	defer database.Close()
+	_, _ = db.Migrate(database)
+
+	service := party.NewService(database, nil)
+	service.SetMusicProvider(party.NewFakeCatalog(party.SongInput{Title: "Espresso - Sabrina Carpenter", YouTubeID: "e1", ThumbnailURL: "https://i.ytimg.com/vi/e1/hqdefault.jpg"}))
+	ctx := context.Background()
+	partyID, _, _ := service.CreateParty(ctx, "Provider Party", 1)
+
+	t.Run("Songs picked by ID only are completed", func(t *testing.T) {
+		// Given: A song given only by its provider ID
+		// When: A player joins with it
+		// Then: The title and thumbnail come from the provider
+		if _, _, err := service.JoinParty(ctx, partyID, "Alice", []party.SongInput{{YouTubeID: "e1"}}); err != nil {
+			t.Fatalf("JoinParty failed: %v", err)
+		}
+		songs, _ := service.GetPartySongs(ctx, partyID)
+		if len(songs) != 1 || songs[0].Title != "Espresso - Sabrina Carpenter" || songs[0].ThumbnailURL == "" {
+			t.Errorf("expected completed song, got %+v", songs)
+		}
+	})
+
+	t.Run("Unknown IDs are rejected", func(t *testing.T) {
+		if _, _, err := service.JoinParty(ctx, partyID, "Bob", []party.SongInput{{YouTubeID: "missing"}}); err == nil {
+			t.Error("expected error for unknown song ID, got nil")
+		}
+	})
+}
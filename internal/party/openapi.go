@@ -0,0 +1,213 @@
+package party
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"regexp"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// pathParams describes the path parameters used by API routes.
+var pathParams = map[string]APIParam{
+	"id":    {Name: "id", Type: "string", Description: "The ID of the party."},
+	"round": {Name: "round", Type: "integer", Description: "The number of the round, starting at 1."},
+}
+
+var pathParamPattern = regexp.MustCompile(`\{(\w+)\}`)
+
+// OpenAPI generates the OpenAPI 3 document that describes routes. The schemas
+// of request and response bodies are derived from the types of their Go
+// values.
+func OpenAPI(routes []APIRoute) ([]byte, error) {
+	g := openAPIGenerator{schemas: make(map[string]any)}
+	errorSchema := g.schema(reflect.TypeOf(errorResponse{}))
+
+	paths := make(map[string]map[string]any)
+	for _, rt := range routes {
+		var params []any
+		for _, m := range pathParamPattern.FindAllStringSubmatch(rt.Path, -1) {
+			p, ok := pathParams[m[1]]
+			if !ok {
+				return nil, fmt.Errorf("undocumented path parameter %q in %s", m[1], rt.Path)
+			}
+			params = append(params, openAPIParam(p, "path", true))
+		}
+		for _, p := range rt.Query {
+			params = append(params, openAPIParam(p, "query", false))
+		}
+
+		op := map[string]any{
+			"summary": rt.Summary,
+			"responses": map[string]any{
+				fmt.Sprint(rt.Status): map[string]any{
+					"description": http.StatusText(rt.Status),
+					"content":     jsonContent(g.schema(reflect.TypeOf(rt.Response))),
+				},
+				"default": map[string]any{
+					"description": "Error",
+					"content":     jsonContent(errorSchema),
+				},
+			},
+		}
+		if params != nil {
+			op["parameters"] = params
+		}
+		if rt.Request != nil {
+			op["requestBody"] = map[string]any{
+				"required": true,
+				"content":  jsonContent(g.schema(reflect.TypeOf(rt.Request))),
+			}
+		}
+		switch {
+		case rt.Admin:
+			op["security"] = []any{map[string]any{"adminBearer": []any{}}, map[string]any{"adminHeader": []any{}}}
+		case rt.Player:
+			op["security"] = []any{map[string]any{"playerSession": []any{}}}
+		}
+
+		path := APIPrefix + rt.Path
+		if paths[path] == nil {
+			paths[path] = make(map[string]any)
+		}
+		paths[path][strings.ToLower(rt.Method)] = op
+	}
+
+	doc := map[string]any{
+		"openapi": "3.0.3",
+		"info": map[string]any{
+			"title":   "New Year Wrapped API",
+			"version": "1",
+		},
+		"paths": paths,
+		"components": map[string]any{
+			"schemas": g.schemas,
+			"securitySchemes": map[string]any{
+				"adminBearer": map[string]any{
+					"type":        "http",
+					"scheme":      "bearer",
+					"description": "The admin token of the party.",
+				},
+				"adminHeader": map[string]any{
+					"type":        "apiKey",
+					"in":          "header",
+					"name":        "X-Admin-Token",
+					"description": "The admin token of the party.",
+				},
+				"playerSession": map[string]any{
+					"type":        "apiKey",
+					"in":          "cookie",
+					"name":        sessionCookiePrefix + "{id}",
+					"description": "The session cookie set when joining the party.",
+				},
+			},
+		},
+	}
+	b, err := json.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(b, '\n'), nil
+}
+
+func openAPIParam(p APIParam, in string, required bool) map[string]any {
+	return map[string]any{
+		"name":        p.Name,
+		"in":          in,
+		"required":    required,
+		"description": p.Description,
+		"schema":      map[string]any{"type": p.Type},
+	}
+}
+
+func jsonContent(schema any) map[string]any {
+	return map[string]any{"application/json": map[string]any{"schema": schema}}
+}
+
+// openAPIGenerator collects the schemas of the structs used by the API as
+// components, so each is described once.
+type openAPIGenerator struct {
+	schemas map[string]any
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// schema returns the JSON schema of values of type t as encoded by
+// encoding/json. Structs are referred to by name.
+func (g *openAPIGenerator) schema(t reflect.Type) map[string]any {
+	switch {
+	case t == timeType:
+		return map[string]any{"type": "string", "format": "date-time"}
+	case t.Kind() == reflect.Pointer:
+		return g.schema(t.Elem())
+	case t.Kind() == reflect.String:
+		return map[string]any{"type": "string"}
+	case t.Kind() == reflect.Bool:
+		return map[string]any{"type": "boolean"}
+	case t.Kind() >= reflect.Int && t.Kind() <= reflect.Uint64:
+		return map[string]any{"type": "integer"}
+	case t.Kind() == reflect.Slice:
+		return map[string]any{"type": "array", "items": g.schema(t.Elem())}
+	case t.Kind() == reflect.Map:
+		return map[string]any{"type": "object"}
+	case t.Kind() == reflect.Struct:
+		name := schemaName(t)
+		if _, ok := g.schemas[name]; !ok {
+			g.schemas[name] = nil // Reserved, for types that refer to themselves.
+			g.schemas[name] = g.structSchema(t)
+		}
+		return map[string]any{"$ref": "#/components/schemas/" + name}
+	}
+	panic("openapi: unsupported type " + t.String())
+}
+
+// structSchema describes the fields of a struct. Fields without omitempty are
+// always present and so required.
+func (g *openAPIGenerator) structSchema(t reflect.Type) map[string]any {
+	properties := make(map[string]any)
+	var required []string
+	var addFields func(t reflect.Type)
+	addFields = func(t reflect.Type) {
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			if f.Anonymous {
+				addFields(f.Type)
+				continue
+			}
+			if !f.IsExported() {
+				continue
+			}
+			name, opts, _ := strings.Cut(f.Tag.Get("json"), ",")
+			if name == "-" {
+				continue
+			}
+			if name == "" {
+				name = f.Name
+			}
+			properties[name] = g.schema(f.Type)
+			if !strings.Contains(opts, "omitempty") {
+				required = append(required, name)
+			}
+		}
+	}
+	addFields(t)
+	schema := map[string]any{
+		"type":       "object",
+		"properties": properties,
+	}
+	if len(required) > 0 {
+		schema["required"] = required
+	}
+	return schema
+}
+
+// schemaName names the schema of a struct after its type, without the API
+// prefix of the types only used by the API.
+func schemaName(t reflect.Type) string {
+	name := []rune(strings.TrimPrefix(t.Name(), "API"))
+	name[0] = unicode.ToUpper(name[0])
+	return string(name)
+}
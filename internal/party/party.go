@@ -2,14 +2,23 @@ package party
 
 import (
 	"context"
+	cryptorand "crypto/rand"
+	"crypto/subtle"
 	"database/sql"
 	"fmt"
 	"log"
+	"math/big"
 	"math/rand"
+	"slices"
 	"strings"
 	"time"
+)
 
-	"github.com/raitonoberu/ytmusic"
+// Limits on how many songs each player submits to a party.
+const (
+	DefaultSongsPerPlayer = 3
+	MinSongsPerPlayer     = 1
+	MaxSongsPerPlayer     = 10
 )
 
 type SongInput struct {
@@ -19,12 +28,34 @@ type SongInput struct {
 }
 
 type Service struct {
-	db     *sql.DB
-	logger *log.Logger
+	db           *sql.DB
+	logger       *log.Logger
+	events       *Hub
+	randomString func(n int) (string, error)
+	now          func() time.Time
+	music        MusicProvider
 }
 
+// NewService creates a service searching YouTube Music in Danish. Use
+// SetMusicProvider to search elsewhere.
 func NewService(db *sql.DB, logger *log.Logger) *Service {
-	return &Service{db: db, logger: logger}
+	return &Service{
+		db:           db,
+		logger:       logger,
+		events:       NewHub(),
+		randomString: generateRandomString,
+		now:          time.Now,
+		music:        NewYouTubeMusic("da", "DK"),
+	}
+}
+
+// Events returns the hub the service publishes party events to.
+func (s *Service) Events() *Hub {
+	return s.events
+}
+
+func (s *Service) publish(partyID string, eventType string, data interface{}) {
+	s.events.Publish(partyID, Event{Type: eventType, Data: data})
 }
 
 func (s *Service) log(partyID string, format string, v ...interface{}) {
@@ -34,85 +65,200 @@ func (s *Service) log(partyID string, format string, v ...interface{}) {
 	}
 }
 
-func (s *Service) JoinParty(ctx context.Context, partyID string, userName string, songs []SongInput) error {
+// JoinParty adds a player and their songs to a party. It returns the new
+// player's ID and the secret session token that identifies them from now on.
+func (s *Service) JoinParty(ctx context.Context, partyID string, userName string, songs []SongInput) (userID int, token string, err error) {
 	s.log(partyID, "User %s joining with %d songs", userName, len(songs))
-	if len(songs) != 3 {
-		return fmt.Errorf("der kræves præcis 3 sange, fik %d", len(songs))
+
+	token, err = newSessionToken()
+	if err != nil {
+		return 0, "", err
+	}
+
+	songs = slices.Clone(songs)
+	if err := s.completeSongs(ctx, songs); err != nil {
+		return 0, "", err
 	}
 
 	tx, err := s.db.BeginTx(ctx, nil)
 	if err != nil {
-		return err
+		return 0, "", err
 	}
 	defer tx.Rollback()
 
-	// Check if party exists and hasn't started
+	// Check if party exists and hasn't started, unless late joins are allowed
 	var started bool
 	err = tx.QueryRowContext(ctx, "SELECT started FROM parties WHERE id = ?", partyID).Scan(&started)
 	if err != nil {
 		if err == sql.ErrNoRows {
-			return fmt.Errorf("festen %s eksisterer ikke", partyID)
+			return 0, "", newError(CodePartyNotFound, partyID)
 		}
-		return err
+		return 0, "", err
 	}
-	if started {
-		return fmt.Errorf("festen %s er allerede startet", partyID)
+	settings, err := getSettings(ctx, tx, partyID)
+	if err != nil {
+		return 0, "", err
+	}
+	if started && !settings.AllowLateJoin {
+		return 0, "", newError(CodePartyStarted, partyID)
+	}
+	if len(songs) != settings.SongsPerPlayer {
+		return 0, "", newError(CodeSongCount, settings.SongsPerPlayer, len(songs))
 	}
 
 	// Check if user already exists
 	var userExists bool
 	err = tx.QueryRowContext(ctx, "SELECT EXISTS(SELECT 1 FROM users WHERE party_id = ? AND name = ?)", partyID, userName).Scan(&userExists)
 	if err != nil {
-		return err
+		return 0, "", err
 	}
 	if userExists {
-		return fmt.Errorf("navnet %s er allerede taget i denne fest", userName)
+		return 0, "", newError(CodeNameTaken, userName)
 	}
 
 	// Create user
-	res, err := tx.ExecContext(ctx, "INSERT INTO users (party_id, name) VALUES (?, ?)", partyID, userName)
+	res, err := tx.ExecContext(ctx, "INSERT INTO users (party_id, name, session_hash) VALUES (?, ?, ?)", partyID, userName, hashToken(token))
 	if err != nil {
-		return err
+		return 0, "", err
 	}
 
-	userID, err := res.LastInsertId()
+	id, err := res.LastInsertId()
 	if err != nil {
-		return err
+		return 0, "", err
 	}
+	userID = int(id)
 
 	// Create songs
+	var songIDs []int64
 	for _, song := range songs {
-		_, err = tx.ExecContext(ctx, "INSERT INTO songs (user_id, title, youtube_id, thumbnail_url) VALUES (?, ?, ?, ?)", userID, song.Title, song.YouTubeID, song.ThumbnailURL)
+		key, err := assignSongKey(ctx, tx, partyID, song)
 		if err != nil {
-			return err
+			return 0, "", err
 		}
+		res, err := tx.ExecContext(ctx, "INSERT INTO songs (user_id, title, youtube_id, thumbnail_url, song_key) VALUES (?, ?, ?, ?, ?)", userID, song.Title, song.YouTubeID, song.ThumbnailURL, key)
+		if err != nil {
+			return 0, "", err
+		}
+		songID, err := res.LastInsertId()
+		if err != nil {
+			return 0, "", err
+		}
+		songIDs = append(songIDs, songID)
 	}
 
-	return tx.Commit()
+	// Late joiners' songs are shuffled in after the songs already in play
+	if started {
+		var lastIndex int
+		err = tx.QueryRowContext(ctx, `
+			SELECT COALESCE(MAX(songs.shuffle_index), -1)
+			FROM songs
+			JOIN users ON songs.user_id = users.id
+			WHERE users.party_id = ?`, partyID).Scan(&lastIndex)
+		if err != nil {
+			return 0, "", err
+		}
+		rand.Shuffle(len(songIDs), func(i, j int) {
+			songIDs[i], songIDs[j] = songIDs[j], songIDs[i]
+		})
+		for i, songID := range songIDs {
+			if _, err := tx.ExecContext(ctx, "UPDATE songs SET shuffle_index = ? WHERE id = ?", lastIndex+1+i, songID); err != nil {
+				return 0, "", err
+			}
+		}
+		if settings.TeamMode {
+			if err := assignTeams(ctx, tx, partyID); err != nil {
+				return 0, "", err
+			}
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, "", err
+	}
+
+	s.publish(partyID, EventJoin, map[string]string{"user_name": userName})
+	return userID, token, nil
 }
 
-func (s *Service) generateRandomString(n int) string {
+// maxPartyIDAttempts bounds how many random IDs insertParty tries before
+// giving up because they are all taken.
+const maxPartyIDAttempts = 10
+
+// generateRandomString returns n characters from a cryptographically secure
+// source, suitable for party IDs and admin tokens.
+func generateRandomString(n int) (string, error) {
 	const letters = "ABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
+	max := big.NewInt(int64(len(letters)))
 	b := make([]byte, n)
 	for i := range b {
-		b[i] = letters[rand.Intn(len(letters))]
+		idx, err := cryptorand.Int(cryptorand.Reader, max)
+		if err != nil {
+			return "", err
+		}
+		b[i] = letters[idx.Int64()]
 	}
-	return string(b)
+	return string(b), nil
 }
 
-func (s *Service) CreateParty(ctx context.Context, name string) (id string, adminToken string, err error) {
-	id = s.generateRandomString(6)
-	adminToken = s.generateRandomString(12)
+// CreateParty creates a party where every player submits songsPerPlayer songs.
+// Only a hash of the returned admin token is stored.
+func (s *Service) CreateParty(ctx context.Context, name string, songsPerPlayer int) (id string, adminToken string, err error) {
+	if songsPerPlayer < MinSongsPerPlayer || songsPerPlayer > MaxSongsPerPlayer {
+		return "", "", newError(CodeSongsPerPlayerRange, MinSongsPerPlayer, MaxSongsPerPlayer, songsPerPlayer)
+	}
 
+	id, adminToken, err = s.insertParty(ctx, s.db, name, songsPerPlayer)
+	if err != nil {
+		return "", "", err
+	}
 	s.log(id, "Creating party: %s", name)
-	_, err = s.db.ExecContext(ctx, "INSERT INTO parties (id, name, admin_token) VALUES (?, ?, ?)", id, name, adminToken)
-	return id, adminToken, err
+	return id, adminToken, nil
+}
+
+// insertParty inserts a party under a random, unused ID with a new admin
+// token.
+func (s *Service) insertParty(ctx context.Context, e execer, name string, songsPerPlayer int) (id string, adminToken string, err error) {
+	adminToken, err = s.randomString(12)
+	if err != nil {
+		return "", "", err
+	}
+
+	for attempt := 0; attempt < maxPartyIDAttempts; attempt++ {
+		id, err = s.randomString(6)
+		if err != nil {
+			return "", "", err
+		}
+
+		res, err := e.ExecContext(ctx, `
+			INSERT INTO parties (id, name, admin_token, songs_per_player) VALUES (?, ?, ?, ?)
+			ON CONFLICT(id) DO NOTHING`, id, name, hashToken(adminToken), songsPerPlayer)
+		if err != nil {
+			return "", "", err
+		}
+		n, err := res.RowsAffected()
+		if err != nil {
+			return "", "", err
+		}
+		if n == 1 {
+			return id, adminToken, nil
+		}
+		s.log(id, "Party ID already taken, retrying")
+	}
+
+	return "", "", newError(CodeNoFreePartyID, maxPartyIDAttempts)
 }
 
+// VerifyAdmin reports whether token is the admin token of the party.
 func (s *Service) VerifyAdmin(ctx context.Context, partyID, token string) (bool, error) {
-	var exists bool
-	err := s.db.QueryRowContext(ctx, "SELECT EXISTS(SELECT 1 FROM parties WHERE id = ? AND admin_token = ?)", partyID, token).Scan(&exists)
-	return exists, err
+	var storedHash string
+	err := s.db.QueryRowContext(ctx, "SELECT admin_token FROM parties WHERE id = ?", partyID).Scan(&storedHash)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return subtle.ConstantTimeCompare([]byte(storedHash), []byte(hashToken(token))) == 1, nil
 }
 
 func (s *Service) StartCompetition(ctx context.Context, partyID string) error {
@@ -123,6 +269,10 @@ func (s *Service) StartCompetition(ctx context.Context, partyID string) error {
 	}
 	defer tx.Rollback()
 
+	if err := checkNotStarted(ctx, tx, partyID); err != nil {
+		return err
+	}
+
 	// Get all songs for the party
 	rows, err := tx.QueryContext(ctx, `
 		SELECT songs.id 
@@ -144,7 +294,18 @@ func (s *Service) StartCompetition(ctx context.Context, partyID string) error {
 	}
 
 	if len(songIDs) == 0 {
-		return fmt.Errorf("ingen sange fundet for festen %s", partyID)
+		return newError(CodeNoSongs, partyID)
+	}
+
+	// Players who haven't picked a team are spread over the teams
+	settings, err := getSettings(ctx, tx, partyID)
+	if err != nil {
+		return err
+	}
+	if settings.TeamMode {
+		if err := assignTeams(ctx, tx, partyID); err != nil {
+			return err
+		}
 	}
 
 	// Shuffle songs
@@ -162,12 +323,24 @@ func (s *Service) StartCompetition(ctx context.Context, partyID string) error {
 	}
 
 	// Update party state
-	_, err = tx.ExecContext(ctx, "UPDATE parties SET started = TRUE, current_round = 1 WHERE id = ?", partyID)
+	deadline, err := s.roundDeadline(ctx, tx, partyID, 1)
 	if err != nil {
 		return err
 	}
+	_, err = tx.ExecContext(ctx, "UPDATE parties SET started = TRUE, current_round = 1, round_deadline = ? WHERE id = ?", deadline, partyID)
+	if err != nil {
+		return err
+	}
+	if err := s.openRound(ctx, tx, partyID, 1); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
 
-	return tx.Commit()
+	s.publish(partyID, EventStart, map[string]int{"round": 1})
+	return nil
 }
 
 type Song struct {
@@ -180,6 +353,9 @@ type Song struct {
 func (s *Service) GetRoundSongs(ctx context.Context, partyID string, round int) ([]Song, error) {
 	var songsPerRound int
 	err := s.db.QueryRowContext(ctx, "SELECT songs_per_round FROM parties WHERE id = ?", partyID).Scan(&songsPerRound)
+	if err == sql.ErrNoRows {
+		return nil, newError(CodePartyNotFound, partyID)
+	}
 	if err != nil {
 		return nil, err
 	}
@@ -209,19 +385,40 @@ func (s *Service) GetRoundSongs(ctx context.Context, partyID string, round int)
 	return songs, nil
 }
 
+// GetSongsPerPlayer returns how many songs each player submits to the party.
+func (s *Service) GetSongsPerPlayer(ctx context.Context, partyID string) (int, error) {
+	var n int
+	err := s.db.QueryRowContext(ctx, "SELECT songs_per_player FROM parties WHERE id = ?", partyID).Scan(&n)
+	if err == sql.ErrNoRows {
+		return 0, newError(CodePartyNotFound, partyID)
+	}
+	return n, err
+}
+
 func (s *Service) GetPartyName(ctx context.Context, partyID string) (string, error) {
 	var name string
 	err := s.db.QueryRowContext(ctx, "SELECT name FROM parties WHERE id = ?", partyID).Scan(&name)
+	if err == sql.ErrNoRows {
+		return "", newError(CodePartyNotFound, partyID)
+	}
 	return name, err
 }
 
-func (s *Service) GetUserGuesses(ctx context.Context, partyID string, userName string) (map[int]string, error) {
-	rows, err := s.db.QueryContext(ctx, `
-		SELECT g.song_id, u_guessed.name
+// userGuessesFrom selects the guesses of the player named by the first
+// argument in the party of the second, or of their team in team mode. The
+// guessed user is u_guessed.
+const userGuessesFrom = `
 		FROM guesses g
 		JOIN users u_guesser ON g.guesser_id = u_guesser.id
 		JOIN users u_guessed ON g.guessed_user_id = u_guessed.id
-		WHERE u_guesser.party_id = ? AND u_guesser.name = ?`, partyID, userName)
+		JOIN users u ON u.party_id = u_guesser.party_id AND u.name = ?
+		JOIN parties p ON p.id = u.party_id
+		WHERE u.party_id = ? AND (u_guesser.id = u.id OR (p.team_mode AND u.team_id != 0 AND u_guesser.team_id = u.team_id))`
+
+// GetUserGuesses returns the owner a player guessed for each song. In team
+// mode it is the guess of the player's team.
+func (s *Service) GetUserGuesses(ctx context.Context, partyID string, userName string) (map[int]string, error) {
+	rows, err := s.db.QueryContext(ctx, "SELECT g.song_id, u_guessed.name"+userGuessesFrom, userName, partyID)
 	if err != nil {
 		return nil, err
 	}
@@ -239,8 +436,24 @@ func (s *Service) GetUserGuesses(ctx context.Context, partyID string, userName s
 	return guesses, nil
 }
 
+// checkPartyExists returns an error if the party doesn't exist.
+func checkPartyExists(ctx context.Context, q queryRower, partyID string) error {
+	var exists bool
+	err := q.QueryRowContext(ctx, "SELECT EXISTS (SELECT 1 FROM parties WHERE id = ?)", partyID).Scan(&exists)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return newError(CodePartyNotFound, partyID)
+	}
+	return nil
+}
+
 func (s *Service) GetPartyState(ctx context.Context, partyID string) (started bool, currentRound int, showResults bool, err error) {
 	err = s.db.QueryRowContext(ctx, "SELECT started, current_round, show_results FROM parties WHERE id = ?", partyID).Scan(&started, &currentRound, &showResults)
+	if err == sql.ErrNoRows {
+		err = newError(CodePartyNotFound, partyID)
+	}
 	return
 }
 
@@ -249,82 +462,192 @@ type LeaderboardEntry struct {
 	Score    int    `json:"score"`
 }
 
+// SubmitGuess records who a player thinks owns a song, wagering a single
+// point in wager mode.
 func (s *Service) SubmitGuess(ctx context.Context, guesserID, songID, guessedUserID int) error {
+	return s.SubmitGuessWithWager(ctx, guesserID, songID, guessedUserID, MinWager)
+}
+
+// SubmitGuessWithWager records a guess with the points the player wagers on
+// it. The wager only counts in wager mode, where it must fit in what is left
+// of the player's budget for the song's round. Only songs of other players in
+// the open round can be guessed, and a guess is final unless the party allows
+// guess changes.
+func (s *Service) SubmitGuessWithWager(ctx context.Context, guesserID, songID, guessedUserID, wager int) error {
 	if s.logger != nil {
-		s.logger.Printf("Guess submitted: Guesser %d, Song %d, Guessed Owner %d", guesserID, songID, guessedUserID)
+		s.logger.Printf("Guess submitted: Guesser %d, Song %d, Guessed Owner %d, Wager %d", guesserID, songID, guessedUserID, wager)
 	}
-	_, err := s.db.ExecContext(ctx, `
-		INSERT INTO guesses (guesser_id, song_id, guessed_user_id) 
-		VALUES (?, ?, ?)
-		ON CONFLICT(guesser_id, song_id) DO UPDATE SET guessed_user_id = excluded.guessed_user_id`,
-		guesserID, songID, guessedUserID)
-	return err
-}
 
-func (s *Service) GetLeaderboard(ctx context.Context, partyID string, round int) ([]LeaderboardEntry, error) {
-	var query string
-	var args []interface{}
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
 
-	if round > 0 {
-		query = `
-			SELECT u.name, COUNT(CASE WHEN (
-				(s.youtube_id != '' AND EXISTS (SELECT 1 FROM songs s2 WHERE s2.youtube_id = s.youtube_id AND s2.user_id = g.guessed_user_id)) OR
-				(s.youtube_id = '' AND g.guessed_user_id = s.user_id)
-			) AND s.shuffle_index BETWEEN (? - 1) * p.songs_per_round AND ? * p.songs_per_round - 1 THEN 1 END) as score
-			FROM users u
-			JOIN parties p ON u.party_id = p.id
-			LEFT JOIN guesses g ON u.id = g.guesser_id
-			LEFT JOIN songs s ON g.song_id = s.id
-			WHERE u.party_id = ?
-			GROUP BY u.id
-			ORDER BY score DESC`
-		args = []interface{}{round, round, partyID}
+	var partyID, teamGuessPolicy, scoringMode string
+	var deadline int64
+	var teamID, songsPerRound, wagerBudget int
+	var teamMode, allowGuessChanges bool
+	err = tx.QueryRowContext(ctx, `
+		SELECT u.party_id, u.team_id, p.round_deadline, p.team_mode, p.team_guess_policy,
+			p.scoring_mode, p.songs_per_round, p.wager_budget, p.allow_guess_changes
+		FROM users u
+		JOIN parties p ON u.party_id = p.id
+		WHERE u.id = ?`, guesserID).Scan(&partyID, &teamID, &deadline, &teamMode, &teamGuessPolicy,
+		&scoringMode, &songsPerRound, &wagerBudget, &allowGuessChanges)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return newError(CodeUserNotFound, guesserID)
+		}
+		return err
+	}
+	if deadline != 0 && !s.now().Before(time.Unix(deadline, 0)) {
+		return newError(CodeRoundClosed)
+	}
+
+	round, err := checkGuess(ctx, tx, partyID, guesserID, songID, guessedUserID, songsPerRound)
+	if err != nil {
+		return err
+	}
+	teamPlay := teamMode && teamID != 0
+	if !allowGuessChanges && !(teamPlay && teamGuessPolicy == TeamGuessLast) {
+		guessed, err := hasGuessed(ctx, tx, guesserID, songID)
+		if err != nil {
+			return err
+		}
+		if guessed {
+			return newError(CodeGuessLocked)
+		}
+	}
+
+	if scoringMode == ScoringWager {
+		if err := checkWager(ctx, tx, guesserID, songID, round, wager, songsPerRound, wagerBudget); err != nil {
+			return err
+		}
+	} else {
+		wager = MinWager
+	}
+
+	if teamPlay {
+		err = submitTeamGuess(ctx, tx, teamID, teamGuessPolicy, guesserID, songID, guessedUserID, wager, s.now().UnixMilli())
 	} else {
-		query = `
-			SELECT u.name, COUNT(CASE WHEN (
-				(s.youtube_id != '' AND EXISTS (SELECT 1 FROM songs s2 WHERE s2.youtube_id = s.youtube_id AND s2.user_id = g.guessed_user_id)) OR
-				(s.youtube_id = '' AND g.guessed_user_id = s.user_id)
-			) AND s.shuffle_index < CASE WHEN p.show_results THEN p.current_round * p.songs_per_round ELSE (p.current_round - 1) * p.songs_per_round END THEN 1 END) as score
-			FROM users u
-			JOIN parties p ON u.party_id = p.id
-			LEFT JOIN guesses g ON u.id = g.guesser_id
-			LEFT JOIN songs s ON g.song_id = s.id
-			WHERE u.party_id = ?
-			GROUP BY u.id
-			ORDER BY score DESC`
-		args = []interface{}{partyID}
-	}
-
-	rows, err := s.db.QueryContext(ctx, query, args...)
+		_, err = tx.ExecContext(ctx, `
+			INSERT INTO guesses (guesser_id, song_id, guessed_user_id, created_at, wager) 
+			VALUES (?, ?, ?, ?, ?)
+			ON CONFLICT(guesser_id, song_id) DO UPDATE SET guessed_user_id = excluded.guessed_user_id, created_at = excluded.created_at, wager = excluded.wager`,
+			guesserID, songID, guessedUserID, s.now().UnixMilli(), wager)
+	}
+	if err != nil {
+		return err
+	}
+
+	// The event only tells how many guesses the round has, so nobody can
+	// follow who guesses what.
+	var guesses int
+	err = tx.QueryRowContext(ctx, `
+		SELECT COUNT(*)
+		FROM guesses g
+		JOIN songs s ON g.song_id = s.id
+		JOIN users u ON s.user_id = u.id
+		WHERE u.party_id = ? AND s.shuffle_index BETWEEN ? AND ?`,
+		partyID, (round-1)*songsPerRound, round*songsPerRound-1).Scan(&guesses)
+	if err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	s.publish(partyID, EventGuess, map[string]int{"round": round, "guesses": guesses})
+	return nil
+}
+
+// GetLeaderboard scores a party with the Scorer of its scoring mode. For a
+// round > 0 it returns the points earned in that round, if it is revealed,
+// otherwise the total over all revealed rounds.
+func (s *Service) GetLeaderboard(ctx context.Context, partyID string, round int) ([]LeaderboardEntry, error) {
+	users, points, err := s.leaderboardPoints(ctx, partyID, round)
 	if err != nil {
 		return nil, err
 	}
-	defer rows.Close()
+	return leaderboard(users, points), nil
+}
 
-	var leaderboard []LeaderboardEntry
-	for rows.Next() {
-		var entry LeaderboardEntry
-		if err := rows.Scan(&entry.UserName, &entry.Score); err != nil {
-			return nil, err
+// leaderboardPoints returns the players of a party and the points of each,
+// as shown by GetLeaderboard.
+func (s *Service) leaderboardPoints(ctx context.Context, partyID string, round int) ([]User, map[int]int, error) {
+	var songsPerRound, currentRound int
+	var showResults bool
+	var scoringMode string
+	err := s.db.QueryRowContext(ctx, "SELECT songs_per_round, current_round, show_results, scoring_mode FROM parties WHERE id = ?", partyID).Scan(&songsPerRound, &currentRound, &showResults, &scoringMode)
+	if err == sql.ErrNoRows {
+		return nil, nil, newError(CodePartyNotFound, partyID)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	in, err := s.scoringInput(ctx, partyID, songsPerRound)
+	if err != nil {
+		return nil, nil, err
+	}
+	scores := ScorerFor(scoringMode).Score(in)
+
+	lastRevealed := currentRound - 1
+	if showResults {
+		lastRevealed = currentRound
+	}
+	if round > 0 {
+		if round > lastRevealed {
+			return nil, nil, newError(CodeRoundNotRevealed, round)
 		}
-		leaderboard = append(leaderboard, entry)
+		return in.Users, scores.ByRound[round], nil
 	}
-	return leaderboard, nil
+
+	total := make(map[int]int)
+	for r, points := range scores.ByRound {
+		if r > lastRevealed {
+			continue
+		}
+		for userID, p := range points {
+			total[userID] += p
+		}
+	}
+	return in.Users, total, nil
 }
 
 func (s *Service) NextRound(ctx context.Context, partyID string) error {
 	var showResults bool
-	err := s.db.QueryRowContext(ctx, "SELECT show_results FROM parties WHERE id = ?", partyID).Scan(&showResults)
+	var currentRound int
+	err := s.db.QueryRowContext(ctx, "SELECT show_results, current_round FROM parties WHERE id = ?", partyID).Scan(&showResults, &currentRound)
+	if err == sql.ErrNoRows {
+		return newError(CodePartyNotFound, partyID)
+	}
 	if err != nil {
 		return err
 	}
 
 	if showResults {
 		s.log(partyID, "Moving to next round")
-		_, err = s.db.ExecContext(ctx, "UPDATE parties SET current_round = current_round + 1, show_results = FALSE WHERE id = ?", partyID)
+		var deadline int64
+		deadline, err = s.roundDeadline(ctx, s.db, partyID, currentRound+1)
+		if err != nil {
+			return err
+		}
+		_, err = s.db.ExecContext(ctx, "UPDATE parties SET current_round = current_round + 1, show_results = FALSE, round_deadline = ? WHERE id = ?", deadline, partyID)
+		if err == nil {
+			err = s.openRound(ctx, s.db, partyID, currentRound+1)
+		}
+		if err == nil {
+			s.publish(partyID, EventNextRound, map[string]int{"round": currentRound + 1})
+		}
 	} else {
 		s.log(partyID, "Revealing round results")
-		_, err = s.db.ExecContext(ctx, "UPDATE parties SET show_results = TRUE WHERE id = ?", partyID)
+		_, err = s.db.ExecContext(ctx, "UPDATE parties SET show_results = TRUE, round_deadline = 0 WHERE id = ?", partyID)
+		if err == nil {
+			s.publish(partyID, EventReveal, map[string]int{"round": currentRound})
+		}
 	}
 	return err
 }
@@ -342,6 +665,8 @@ type SongResult struct {
 	YouTubeID    string `json:"youtube_id"`
 	ThumbnailURL string `json:"thumbnail_url"`
 	OwnerName    string `json:"owner_name"`
+	// Owners are everyone who submitted the song, in the order they did.
+	Owners []User `json:"owners"`
 }
 
 func (r SongResult) IsCorrect(guess string) bool {
@@ -357,75 +682,24 @@ func (r SongResult) IsCorrect(guess string) bool {
 	return false
 }
 
-func (s *Service) SearchYouTubeMusic(ctx context.Context, query string) ([]SongInput, error) {
-	ytmusic.Language = "da"
-	ytmusic.Region = "DK"
-	search := ytmusic.TrackSearch(query)
-	result, err := search.Next()
-	if err != nil {
-		return nil, err
-	}
-
-	var songs []SongInput
-	for _, track := range result.Tracks {
-		artist := ""
-		if len(track.Artists) > 0 {
-			artist = track.Artists[0].Name
-		}
-
-		fullTitle := track.Title
-		if artist != "" {
-			fullTitle = fmt.Sprintf("%s - %s", track.Title, artist)
-		}
-
-		thumbnailURL := ""
-		if len(track.Thumbnails) > 0 {
-			thumbnailURL = track.Thumbnails[len(track.Thumbnails)-1].URL
-		}
-
-		songs = append(songs, SongInput{
-			Title:        fullTitle,
-			YouTubeID:    track.VideoID,
-			ThumbnailURL: thumbnailURL,
-		})
-	}
-
-	return songs, nil
-}
-
 func (s *Service) GetPartySongs(ctx context.Context, partyID string) ([]SongResult, error) {
-	rows, err := s.db.QueryContext(ctx, `
-		SELECT s.id, s.title, s.youtube_id, s.thumbnail_url, (
-			SELECT GROUP_CONCAT(u2.name, ', ')
-			FROM songs s2
-			JOIN users u2 ON s2.user_id = u2.id
-			WHERE u2.party_id = ? AND (
-				(s.youtube_id != '' AND s2.youtube_id = s.youtube_id) OR
-				(s.youtube_id = '' AND s2.id = s.id)
-			)
-		) as owner_names
-		FROM songs s
-		JOIN users u ON s.user_id = u.id
-		WHERE u.party_id = ?
-		ORDER BY s.shuffle_index ASC, u.name ASC, s.id ASC`, partyID, partyID)
+	songs, err := s.getPartySongs(ctx, partyID)
 	if err != nil {
 		return nil, err
 	}
-	defer rows.Close()
 
-	var songs []SongResult
-	for rows.Next() {
-		var s SongResult
-		if err := rows.Scan(&s.ID, &s.Title, &s.YouTubeID, &s.ThumbnailURL, &s.OwnerName); err != nil {
-			return nil, err
-		}
-		songs = append(songs, s)
+	var results []SongResult
+	for _, ps := range songs {
+		results = append(results, ps.SongResult)
 	}
-	return songs, nil
+	return results, nil
 }
 
 // GetUsers returns all participants in a party.
 func (s *Service) GetUsers(ctx context.Context, partyID string) ([]User, error) {
+	if err := checkPartyExists(ctx, s.db, partyID); err != nil {
+		return nil, err
+	}
 	rows, err := s.db.QueryContext(ctx, "SELECT id, name FROM users WHERE party_id = ? ORDER BY name ASC", partyID)
 	if err != nil {
 		return nil, err
@@ -451,43 +725,30 @@ func (s *Service) GetRoundResults(ctx context.Context, partyID string, round int
 	var songsPerRound int
 	var showResults bool
 	err := s.db.QueryRowContext(ctx, "SELECT current_round, songs_per_round, show_results FROM parties WHERE id = ?", partyID).Scan(&currentRound, &songsPerRound, &showResults)
+	if err == sql.ErrNoRows {
+		return nil, newError(CodePartyNotFound, partyID)
+	}
 	if err != nil {
 		return nil, err
 	}
 
 	if currentRound < round || (currentRound == round && !showResults) {
-		return nil, fmt.Errorf("runde %d er ikke blevet afsløret endnu", round)
+		return nil, newError(CodeRoundNotRevealed, round)
 	}
 
 	startIndex := (round - 1) * songsPerRound
 	endIndex := round*songsPerRound - 1
 
-	rows, err := s.db.QueryContext(ctx, `
-		SELECT s.id, s.title, s.youtube_id, s.thumbnail_url, (
-			SELECT GROUP_CONCAT(u2.name, ', ')
-			FROM songs s2
-			JOIN users u2 ON s2.user_id = u2.id
-			WHERE u2.party_id = ? AND (
-				(s.youtube_id != '' AND s2.youtube_id = s.youtube_id) OR
-				(s.youtube_id = '' AND s2.id = s.id)
-			)
-		) as owner_names
-		FROM songs s
-		JOIN users u ON s.user_id = u.id
-		WHERE u.party_id = ? AND s.shuffle_index BETWEEN ? AND ?
-		ORDER BY s.shuffle_index ASC`, partyID, partyID, startIndex, endIndex)
+	songs, err := s.getPartySongs(ctx, partyID)
 	if err != nil {
 		return nil, err
 	}
-	defer rows.Close()
 
 	var results []SongResult
-	for rows.Next() {
-		var r SongResult
-		if err := rows.Scan(&r.ID, &r.Title, &r.YouTubeID, &r.ThumbnailURL, &r.OwnerName); err != nil {
-			return nil, err
+	for _, ps := range songs {
+		if ps.ShuffleIndex >= startIndex && ps.ShuffleIndex <= endIndex {
+			results = append(results, ps.SongResult)
 		}
-		results = append(results, r)
 	}
 	return results, nil
 }
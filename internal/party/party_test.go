@@ -3,10 +3,13 @@ package party_test
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
 	"testing"
+	"time"
 
 	"github.com/jehaj/new-year-wrapped/internal/db"
+	"github.com/jehaj/new-year-wrapped/internal/i18n"
 	"github.com/jehaj/new-year-wrapped/internal/party"
 	_ "github.com/mattn/go-sqlite3"
 )
@@ -19,7 +22,7 @@ func TestJoinParty(t *testing.T) {
 	defer database.Close()
 
 	// Setup schema
-	_, err = database.Exec(db.Schema)
+	_, err = db.Migrate(database)
 	if err != nil {
 		t.Fatalf("failed to create schema: %v", err)
 	}
@@ -44,7 +47,7 @@ func TestJoinParty(t *testing.T) {
 			{Title: "Song 3", YouTubeID: "id3", ThumbnailURL: "thumb3"},
 		}
 
-		err := service.JoinParty(context.Background(), partyID, userName, songs)
+		_, _, err := service.JoinParty(context.Background(), partyID, userName, songs)
 		if err != nil {
 			t.Errorf("JoinParty failed: %v", err)
 		}
@@ -74,7 +77,7 @@ func TestJoinParty(t *testing.T) {
 		// Given: A party exists
 		// When: A user tries to join with 4 songs
 		// Then: An error is returned
-		err := service.JoinParty(context.Background(), partyID, "BadUser", []party.SongInput{
+		_, _, err := service.JoinParty(context.Background(), partyID, "BadUser", []party.SongInput{
 			{Title: "1"}, {Title: "2"}, {Title: "3"}, {Title: "4"},
 		})
 		if err == nil {
@@ -87,7 +90,7 @@ func TestJoinParty(t *testing.T) {
 		// When: A new party is created
 		// Then: The party exists in the database with the correct name and a token is returned
 		name := "New Year 2025"
-		id, token, err := service.CreateParty(context.Background(), name)
+		id, token, err := service.CreateParty(context.Background(), name, 3)
 		if err != nil {
 			t.Errorf("CreateParty failed: %v", err)
 		}
@@ -113,13 +116,108 @@ func TestJoinParty(t *testing.T) {
 		if !isAdmin {
 			t.Error("expected token to be valid admin token")
 		}
+
+		// Verify only a hash of the token is stored and other tokens are rejected
+		var storedToken string
+		database.QueryRow("SELECT admin_token FROM parties WHERE id = ?", id).Scan(&storedToken)
+		if storedToken == token {
+			t.Error("expected admin token to be stored hashed")
+		}
+		isAdmin, err = service.VerifyAdmin(context.Background(), id, token+"X")
+		if err != nil {
+			t.Fatalf("VerifyAdmin failed: %v", err)
+		}
+		if isAdmin {
+			t.Error("expected wrong token to be rejected")
+		}
+	})
+}
+
+func TestCreatePartyIDCollision(t *testing.T) {
+	database, _ := sql.Open("sqlite3", ":memory:")
+	defer database.Close()
+	_, _ = db.Migrate(database)
+
+	service := party.NewService(database, nil)
+	ctx := context.Background()
+
+	// Given: A generator that yields an ID already in use before a free one
+	ids := []string{"TAKEN1", "TAKEN1", "FREE01"}
+	service.SetRandomString(func(n int) (string, error) {
+		if n != 6 {
+			return "ADMINTOKEN12", nil
+		}
+		id := ids[0]
+		ids = ids[1:]
+		return id, nil
+	})
+	if _, _, err := service.CreateParty(ctx, "First", 3); err != nil {
+		t.Fatalf("CreateParty failed: %v", err)
+	}
+
+	// When: Another party is created
+	// Then: The taken ID is skipped and the free one is used
+	id, _, err := service.CreateParty(ctx, "Second", 3)
+	if err != nil {
+		t.Fatalf("CreateParty failed: %v", err)
+	}
+	if id != "FREE01" {
+		t.Errorf("expected ID FREE01, got %s", id)
+	}
+}
+
+func TestSongsPerPlayer(t *testing.T) {
+	database, _ := sql.Open("sqlite3", ":memory:")
+	defer database.Close()
+	_, _ = db.Migrate(database)
+
+	service := party.NewService(database, nil)
+	ctx := context.Background()
+
+	t.Run("Join requires the configured number of songs", func(t *testing.T) {
+		// Given: A party where every player submits 5 songs
+		// When: Users join with 3 and 5 songs
+		// Then: Only the join with 5 songs succeeds
+		partyID, _, err := service.CreateParty(ctx, "Five Songs", 5)
+		if err != nil {
+			t.Fatalf("CreateParty failed: %v", err)
+		}
+
+		three := []party.SongInput{{Title: "1"}, {Title: "2"}, {Title: "3"}}
+		if _, _, err := service.JoinParty(ctx, partyID, "Alice", three); err == nil {
+			t.Error("expected error for 3 songs, got nil")
+		}
+
+		five := append(three, party.SongInput{Title: "4"}, party.SongInput{Title: "5"})
+		if _, _, err := service.JoinParty(ctx, partyID, "Bob", five); err != nil {
+			t.Errorf("JoinParty with 5 songs failed: %v", err)
+		}
+
+		n, err := service.GetSongsPerPlayer(ctx, partyID)
+		if err != nil {
+			t.Fatalf("GetSongsPerPlayer failed: %v", err)
+		}
+		if n != 5 {
+			t.Errorf("expected 5 songs per player, got %d", n)
+		}
+	})
+
+	t.Run("Songs per player must be within limits", func(t *testing.T) {
+		// Given: A database connection
+		// When: Parties are created with 0 and 11 songs per player
+		// Then: Both are rejected
+		for _, n := range []int{0, party.MaxSongsPerPlayer + 1} {
+			if _, _, err := service.CreateParty(ctx, "Bad Party", n); err == nil {
+				t.Errorf("expected error for %d songs per player, got nil", n)
+			}
+		}
 	})
 }
 
 func TestStartCompetition(t *testing.T) {
 	database, _ := sql.Open("sqlite3", ":memory:")
 	defer database.Close()
-	_, _ = database.Exec(db.Schema)
+	_, _ = db.Migrate(database)
 
 	partyID := "comp-party"
 	_, _ = database.Exec("INSERT INTO parties (id, name, admin_token) VALUES (?, ?, ?)", partyID, "Comp Party", "token")
@@ -173,7 +271,7 @@ func TestStartCompetition(t *testing.T) {
 func TestGuessingAndLeaderboard(t *testing.T) {
 	database, _ := sql.Open("sqlite3", ":memory:")
 	defer database.Close()
-	_, _ = database.Exec(db.Schema)
+	_, _ = db.Migrate(database)
 
 	partyID := "guess-party"
 	_, _ = database.Exec("INSERT INTO parties (id, name, admin_token, started, current_round) VALUES (?, ?, ?, TRUE, 1)", partyID, "Guess Party", "token")
@@ -194,11 +292,25 @@ func TestGuessingAndLeaderboard(t *testing.T) {
 		// Given: A started competition with a song owned by Alice and a guesser Bob
 		// When: Bob submits a correct guess for Alice's song and the round is revealed
 		// Then: Bob has 1 point on the leaderboard
+		events, unsubscribe := service.Events().Subscribe(partyID)
+		defer unsubscribe()
+
 		err := service.SubmitGuess(context.Background(), int(bobID), int(song1ID), int(aliceID))
 		if err != nil {
 			t.Fatalf("SubmitGuess failed: %v", err)
 		}
 
+		// The event only tells the progress of the round, not who guessed what
+		select {
+		case e := <-events:
+			want := map[string]int{"round": 1, "guesses": 1}
+			if e.Type != party.EventGuess || fmt.Sprint(e.Data) != fmt.Sprint(want) {
+				t.Errorf("expected %s event with %v, got %s with %v", party.EventGuess, want, e.Type, e.Data)
+			}
+		default:
+			t.Error("expected a guess event")
+		}
+
 		// Reveal the round
 		err = service.NextRound(context.Background(), partyID)
 		if err != nil {
@@ -229,10 +341,10 @@ func TestGuessingAndLeaderboard(t *testing.T) {
 func TestDuplicateSongGuessing(t *testing.T) {
 	database, _ := sql.Open("sqlite3", ":memory:")
 	defer database.Close()
-	_, _ = database.Exec(db.Schema)
+	_, _ = db.Migrate(database)
 
 	partyID := "dup-party"
-	_, _ = database.Exec("INSERT INTO parties (id, name, admin_token, started, current_round, show_results, songs_per_round) VALUES (?, ?, ?, TRUE, 1, TRUE, 5)", partyID, "Dup Party", "token")
+	_, _ = database.Exec("INSERT INTO parties (id, name, admin_token, started, current_round, show_results, songs_per_round) VALUES (?, ?, ?, TRUE, 1, FALSE, 5)", partyID, "Dup Party", "token")
 
 	service := party.NewService(database, nil)
 
@@ -258,6 +370,11 @@ func TestDuplicateSongGuessing(t *testing.T) {
 			t.Fatalf("SubmitGuess failed: %v", err)
 		}
 
+		// Reveal the round
+		if err := service.NextRound(context.Background(), partyID); err != nil {
+			t.Fatalf("NextRound failed: %v", err)
+		}
+
 		leaderboard, err := service.GetLeaderboard(context.Background(), partyID, 0)
 		if err != nil {
 			t.Fatalf("GetLeaderboard failed: %v", err)
@@ -302,14 +419,14 @@ func TestGetUsers(t *testing.T) {
 	}
 	defer dbConn.Close()
 
-	if _, err := dbConn.Exec(db.Schema); err != nil {
+	if _, err := db.Migrate(dbConn); err != nil {
 		t.Fatal(err)
 	}
 
 	svc := party.NewService(dbConn, nil)
 	ctx := context.Background()
 
-	partyID, _, _ := svc.CreateParty(ctx, "Test Party")
+	partyID, _, _ := svc.CreateParty(ctx, "Test Party", 3)
 	svc.JoinParty(ctx, partyID, "Alice", []party.SongInput{{Title: "S1"}, {Title: "S2"}, {Title: "S3"}})
 	svc.JoinParty(ctx, partyID, "Bob", []party.SongInput{{Title: "S4"}, {Title: "S5"}, {Title: "S6"}})
 
@@ -333,14 +450,14 @@ func TestGetRoundResults(t *testing.T) {
 	}
 	defer dbConn.Close()
 
-	if _, err := dbConn.Exec(db.Schema); err != nil {
+	if _, err := db.Migrate(dbConn); err != nil {
 		t.Fatal(err)
 	}
 
 	svc := party.NewService(dbConn, nil)
 	ctx := context.Background()
 
-	partyID, _, _ := svc.CreateParty(ctx, "Test Party")
+	partyID, _, _ := svc.CreateParty(ctx, "Test Party", 3)
 	svc.JoinParty(ctx, partyID, "Alice", []party.SongInput{{Title: "S1"}, {Title: "S2"}, {Title: "S3"}})
 	svc.JoinParty(ctx, partyID, "Bob", []party.SongInput{{Title: "S4"}, {Title: "S5"}, {Title: "S6"}})
 
@@ -372,3 +489,532 @@ func TestGetRoundResults(t *testing.T) {
 		}
 	}
 }
+
+func TestSessions(t *testing.T) {
+	database, _ := sql.Open("sqlite3", ":memory:")
+	defer database.Close()
+	_, _ = db.Migrate(database)
+
+	service := party.NewService(database, nil)
+	ctx := context.Background()
+
+	partyID, _, _ := service.CreateParty(ctx, "Session Party", 3)
+	aliceID, aliceToken, err := service.JoinParty(ctx, partyID, "Alice", []party.SongInput{{Title: "S1"}, {Title: "S2"}, {Title: "S3"}})
+	if err != nil {
+		t.Fatalf("JoinParty failed: %v", err)
+	}
+
+	t.Run("Join issues a session", func(t *testing.T) {
+		// Given: A user who just joined
+		// When: Their session token is looked up
+		// Then: It resolves to the user, and a wrong token does not
+		user, err := service.UserBySession(ctx, partyID, aliceID, aliceToken)
+		if err != nil {
+			t.Fatalf("UserBySession failed: %v", err)
+		}
+		if user.Name != "Alice" {
+			t.Errorf("expected Alice, got %s", user.Name)
+		}
+
+		if _, err := service.UserBySession(ctx, partyID, aliceID, "wrong"); err == nil {
+			t.Error("expected error for wrong token, got nil")
+		}
+	})
+
+	t.Run("Joined user cannot be claimed", func(t *testing.T) {
+		// Given: A user with a session
+		// When: Someone tries to claim the name
+		// Then: An error is returned
+		if _, _, err := service.ClaimSession(ctx, partyID, "Alice"); err == nil {
+			t.Error("expected error when claiming a user with a session, got nil")
+		}
+	})
+
+	t.Run("Legacy user can be claimed once", func(t *testing.T) {
+		// Given: A user without a session, as created before sessions existed
+		// When: The name is claimed twice
+		// Then: Only the first claim succeeds
+		_, _ = database.Exec("INSERT INTO users (party_id, name) VALUES (?, ?)", partyID, "Bob")
+
+		bobID, token, err := service.ClaimSession(ctx, partyID, "Bob")
+		if err != nil {
+			t.Fatalf("ClaimSession failed: %v", err)
+		}
+		if _, err := service.UserBySession(ctx, partyID, bobID, token); err != nil {
+			t.Errorf("expected claimed session to be valid: %v", err)
+		}
+
+		if _, _, err := service.ClaimSession(ctx, partyID, "Bob"); err == nil {
+			t.Error("expected second claim to fail, got nil")
+		}
+	})
+}
+
+func TestSettings(t *testing.T) {
+	database, _ := sql.Open("sqlite3", ":memory:")
+	defer database.Close()
+	_, _ = db.Migrate(database)
+
+	service := party.NewService(database, nil)
+	ctx := context.Background()
+	partyID, _, _ := service.CreateParty(ctx, "Settings Party", 3)
+
+	t.Run("Defaults", func(t *testing.T) {
+		// Given: A new party
+		// When: Its settings are fetched
+		// Then: The defaults are returned
+		settings, err := service.GetSettings(ctx, partyID)
+		if err != nil {
+			t.Fatalf("GetSettings failed: %v", err)
+		}
+		want := party.Settings{SongsPerRound: 5, SongsPerPlayer: 3, ScoringMode: party.ScoringStandard, TeamGuessPolicy: party.TeamGuessFirst, WagerBudget: party.DefaultWagerBudget}
+		if settings != want {
+			t.Errorf("expected %+v, got %+v", want, settings)
+		}
+	})
+
+	t.Run("Partial update", func(t *testing.T) {
+		// Given: A party that has not started
+		// When: Only songs per round and the time limit are updated
+		// Then: Those settings change and the rest are kept
+		songsPerRound, timeLimit := 2, 30
+		settings, err := service.UpdateSettings(ctx, partyID, party.SettingsUpdate{SongsPerRound: &songsPerRound, RoundTimeLimit: &timeLimit})
+		if err != nil {
+			t.Fatalf("UpdateSettings failed: %v", err)
+		}
+		if settings.SongsPerRound != 2 || settings.RoundTimeLimit != 30 || settings.SongsPerPlayer != 3 {
+			t.Errorf("unexpected settings after update: %+v", settings)
+		}
+	})
+
+	t.Run("Invalid values are rejected", func(t *testing.T) {
+		// Given: A party that has not started
+		// When: An unknown scoring mode is set
+		// Then: An error is returned
+		mode := "bogus"
+		if _, err := service.UpdateSettings(ctx, partyID, party.SettingsUpdate{ScoringMode: &mode}); err == nil {
+			t.Error("expected error for unknown scoring mode, got nil")
+		}
+	})
+
+	t.Run("Party language", func(t *testing.T) {
+		// Given: A party that has not started
+		// When: The admin picks English and then an unknown language
+		// Then: English is kept and the unknown language is rejected with its error code
+		lang := i18n.English
+		if _, err := service.UpdateSettings(ctx, partyID, party.SettingsUpdate{Language: &lang}); err != nil {
+			t.Fatalf("UpdateSettings failed: %v", err)
+		}
+		lang = "xx"
+		_, err := service.UpdateSettings(ctx, partyID, party.SettingsUpdate{Language: &lang})
+		var perr *party.Error
+		if !errors.As(err, &perr) || perr.Code != party.CodeUnknownLanguage {
+			t.Errorf("expected an unknown language error, got %v", err)
+		}
+		if got, _ := service.GetPartyLanguage(ctx, partyID); got != i18n.English {
+			t.Errorf("expected the party language to stay %q, got %q", i18n.English, got)
+		}
+	})
+
+	t.Run("Songs per player is fixed once someone joined", func(t *testing.T) {
+		// Given: A party with a player
+		// When: Songs per player is changed
+		// Then: An error is returned
+		service.JoinParty(ctx, partyID, "Alice", []party.SongInput{{Title: "S1"}, {Title: "S2"}, {Title: "S3"}})
+		n := 4
+		if _, err := service.UpdateSettings(ctx, partyID, party.SettingsUpdate{SongsPerPlayer: &n}); err == nil {
+			t.Error("expected error when changing songs per player after join, got nil")
+		}
+	})
+
+	t.Run("Songs per round controls the round size", func(t *testing.T) {
+		// Given: A party with 2 songs per round and 3 songs
+		// When: The competition starts
+		// Then: The first round has 2 songs
+		if err := service.StartCompetition(ctx, partyID); err != nil {
+			t.Fatalf("StartCompetition failed: %v", err)
+		}
+		songs, err := service.GetRoundSongs(ctx, partyID, 1)
+		if err != nil {
+			t.Fatalf("GetRoundSongs failed: %v", err)
+		}
+		if len(songs) != 2 {
+			t.Errorf("expected 2 songs in round 1, got %d", len(songs))
+		}
+	})
+
+	t.Run("Settings are locked after start", func(t *testing.T) {
+		// Given: A started party
+		// When: A setting is changed
+		// Then: An error is returned
+		n := 3
+		if _, err := service.UpdateSettings(ctx, partyID, party.SettingsUpdate{SongsPerRound: &n}); err == nil {
+			t.Error("expected error when updating a started party, got nil")
+		}
+	})
+}
+
+func TestLateJoin(t *testing.T) {
+	database, _ := sql.Open("sqlite3", ":memory:")
+	defer database.Close()
+	_, _ = db.Migrate(database)
+
+	service := party.NewService(database, nil)
+	ctx := context.Background()
+	partyID, _, _ := service.CreateParty(ctx, "Late Party", 1)
+	allow := true
+	service.UpdateSettings(ctx, partyID, party.SettingsUpdate{AllowLateJoin: &allow})
+	service.JoinParty(ctx, partyID, "Alice", []party.SongInput{{Title: "S1"}})
+	service.StartCompetition(ctx, partyID)
+
+	// Given: A started party that allows late joins
+	// When: Bob joins
+	// Then: His song is shuffled in after the songs already in play
+	if _, _, err := service.JoinParty(ctx, partyID, "Bob", []party.SongInput{{Title: "S2"}}); err != nil {
+		t.Fatalf("late JoinParty failed: %v", err)
+	}
+
+	var index int
+	err := database.QueryRow("SELECT shuffle_index FROM songs WHERE title = 'S2'").Scan(&index)
+	if err != nil {
+		t.Fatalf("failed to query song: %v", err)
+	}
+	if index != 1 {
+		t.Errorf("expected shuffle index 1 for late song, got %d", index)
+	}
+}
+
+func TestTimedRounds(t *testing.T) {
+	database, _ := sql.Open("sqlite3", ":memory:")
+	defer database.Close()
+	_, _ = db.Migrate(database)
+
+	service := party.NewService(database, nil)
+	ctx := context.Background()
+	now := time.Date(2025, 12, 31, 23, 0, 0, 0, time.UTC)
+	service.SetClock(func() time.Time { return now })
+
+	partyID, _, _ := service.CreateParty(ctx, "Timed Party", 1)
+	songsPerRound, timeLimit := 1, 30
+	service.UpdateSettings(ctx, partyID, party.SettingsUpdate{SongsPerRound: &songsPerRound, RoundTimeLimit: &timeLimit})
+	aliceID, _, _ := service.JoinParty(ctx, partyID, "Alice", []party.SongInput{{Title: "S1"}})
+	bobID, _, _ := service.JoinParty(ctx, partyID, "Bob", []party.SongInput{{Title: "S2"}})
+	service.StartCompetition(ctx, partyID)
+
+	songs, _ := service.GetRoundSongs(ctx, partyID, 1)
+	// Players can only guess on songs of others.
+	guesserID, ownerID := aliceID, bobID
+	if aliceSongs, _ := service.GetUserSongs(ctx, partyID, aliceID); aliceSongs[0].ID == songs[0].ID {
+		guesserID, ownerID = bobID, aliceID
+	}
+
+	t.Run("Deadline is set when the round opens", func(t *testing.T) {
+		deadline, err := service.GetRoundDeadline(ctx, partyID)
+		if err != nil {
+			t.Fatalf("GetRoundDeadline failed: %v", err)
+		}
+		if !deadline.Equal(now.Add(30 * time.Second)) {
+			t.Errorf("expected deadline %v, got %v", now.Add(30*time.Second), deadline)
+		}
+	})
+
+	t.Run("Guesses before the deadline are accepted", func(t *testing.T) {
+		now = now.Add(29 * time.Second)
+		if err := service.SubmitGuess(ctx, guesserID, songs[0].ID, ownerID); err != nil {
+			t.Errorf("SubmitGuess failed: %v", err)
+		}
+	})
+
+	t.Run("Expired round is revealed and closed for guesses", func(t *testing.T) {
+		// Given: A round whose deadline has passed
+		// When: A guess is submitted and the scheduler runs
+		// Then: The guess is rejected and the round is revealed
+		now = now.Add(2 * time.Second)
+		if err := service.SubmitGuess(ctx, ownerID, songs[0].ID, guesserID); err == nil {
+			t.Error("expected error for guess after deadline, got nil")
+		}
+
+		revealed, err := service.RevealExpiredRounds(ctx)
+		if err != nil {
+			t.Fatalf("RevealExpiredRounds failed: %v", err)
+		}
+		if revealed != 1 {
+			t.Errorf("expected 1 round revealed, got %d", revealed)
+		}
+		_, round, showResults, _ := service.GetPartyState(ctx, partyID)
+		if round != 1 || !showResults {
+			t.Errorf("expected round 1 to be revealed, got round %d showResults %v", round, showResults)
+		}
+
+		revealed, _ = service.RevealExpiredRounds(ctx)
+		if revealed != 0 {
+			t.Errorf("expected nothing left to reveal, got %d", revealed)
+		}
+	})
+
+	t.Run("Next round gets a new deadline", func(t *testing.T) {
+		if err := service.NextRound(ctx, partyID); err != nil {
+			t.Fatalf("NextRound failed: %v", err)
+		}
+		deadline, _ := service.GetRoundDeadline(ctx, partyID)
+		if !deadline.Equal(now.Add(30 * time.Second)) {
+			t.Errorf("expected deadline %v, got %v", now.Add(30*time.Second), deadline)
+		}
+	})
+}
+
+func TestSpeedScoring(t *testing.T) {
+	database, _ := sql.Open("sqlite3", ":memory:")
+	defer database.Close()
+	_, _ = db.Migrate(database)
+
+	service := party.NewService(database, nil)
+	ctx := context.Background()
+	now := time.Date(2025, 12, 31, 23, 0, 0, 0, time.UTC)
+	service.SetClock(func() time.Time { return now })
+
+	partyID := "speed-party"
+	_, _ = database.Exec("INSERT INTO parties (id, name, admin_token, started, current_round, songs_per_round, scoring_mode) VALUES (?, ?, ?, TRUE, 1, 1, ?)", partyID, "Speed Party", "token", party.ScoringSpeed)
+	_, _ = database.Exec("INSERT INTO rounds (party_id, number, opened_at) VALUES (?, 1, ?)", partyID, now.UnixMilli())
+
+	// Alice owns one song in each round, Bob and Charlie guess
+	res, _ := database.Exec("INSERT INTO users (party_id, name) VALUES (?, ?)", partyID, "Alice")
+	aliceID, _ := res.LastInsertId()
+	res, _ = database.Exec("INSERT INTO songs (user_id, title, shuffle_index) VALUES (?, ?, 0)", aliceID, "Song 1")
+	song1ID, _ := res.LastInsertId()
+	res, _ = database.Exec("INSERT INTO songs (user_id, title, shuffle_index) VALUES (?, ?, 1)", aliceID, "Song 2")
+	song2ID, _ := res.LastInsertId()
+	res, _ = database.Exec("INSERT INTO users (party_id, name) VALUES (?, ?)", partyID, "Bob")
+	bobID, _ := res.LastInsertId()
+	res, _ = database.Exec("INSERT INTO users (party_id, name) VALUES (?, ?)", partyID, "Charlie")
+	charlieID, _ := res.LastInsertId()
+
+	scores := func(round int) map[string]int {
+		t.Helper()
+		leaderboard, err := service.GetLeaderboard(ctx, partyID, round)
+		if err != nil {
+			t.Fatalf("GetLeaderboard failed: %v", err)
+		}
+		scores := make(map[string]int)
+		for _, e := range leaderboard {
+			scores[e.UserName] = e.Score
+		}
+		return scores
+	}
+
+	t.Run("Faster correct guesses earn more points", func(t *testing.T) {
+		// Given: Bob guesses right at once and Charlie after 35 seconds
+		// When: The round is revealed
+		// Then: Bob gets full points and Charlie three points less
+		service.SubmitGuess(ctx, int(bobID), int(song1ID), int(aliceID))
+		now = now.Add(35 * time.Second)
+		service.SubmitGuess(ctx, int(charlieID), int(song1ID), int(aliceID))
+		service.NextRound(ctx, partyID)
+
+		got := scores(1)
+		if got["Bob"] != party.SpeedMaxPoints {
+			t.Errorf("expected %d points for Bob, got %d", party.SpeedMaxPoints, got["Bob"])
+		}
+		if got["Charlie"] != party.SpeedMaxPoints-3 {
+			t.Errorf("expected %d points for Charlie, got %d", party.SpeedMaxPoints-3, got["Charlie"])
+		}
+	})
+
+	t.Run("Points are measured from when each round opens", func(t *testing.T) {
+		// Given: Round 2 opens and Bob guesses wrong while Charlie is an hour late
+		// When: The round is revealed
+		// Then: Bob gets nothing, Charlie the minimum and the totals add up
+		service.NextRound(ctx, partyID)
+		service.SubmitGuess(ctx, int(bobID), int(song2ID), int(charlieID))
+		now = now.Add(time.Hour)
+		service.SubmitGuess(ctx, int(charlieID), int(song2ID), int(aliceID))
+		service.NextRound(ctx, partyID)
+
+		got := scores(2)
+		if got["Bob"] != 0 || got["Charlie"] != party.SpeedMinPoints {
+			t.Errorf("expected 0 and %d points, got %v", party.SpeedMinPoints, got)
+		}
+		total := scores(0)
+		if total["Bob"] != party.SpeedMaxPoints || total["Charlie"] != party.SpeedMaxPoints-3+party.SpeedMinPoints {
+			t.Errorf("unexpected totals %v", total)
+		}
+	})
+}
+
+func TestWrapped(t *testing.T) {
+	database, _ := sql.Open("sqlite3", ":memory:")
+	defer database.Close()
+	_, _ = db.Migrate(database)
+
+	partyID := "wrapped-party"
+	_, _ = database.Exec("INSERT INTO parties (id, name, admin_token, started, current_round, songs_per_round) VALUES (?, ?, ?, TRUE, 1, 3)", partyID, "Wrapped Party", "token")
+
+	service := party.NewService(database, nil)
+	ctx := context.Background()
+
+	// Alice, Bob and Charlie each own one song in the only round
+	userIDs := make(map[string]int)
+	songIDs := make(map[string]int)
+	for i, name := range []string{"Alice", "Bob", "Charlie"} {
+		res, _ := database.Exec("INSERT INTO users (party_id, name) VALUES (?, ?)", partyID, name)
+		id, _ := res.LastInsertId()
+		userIDs[name] = int(id)
+		res, _ = database.Exec("INSERT INTO songs (user_id, title, shuffle_index) VALUES (?, ?, ?)", id, name+"'s Song", i)
+		id, _ = res.LastInsertId()
+		songIDs[name] = int(id)
+	}
+	guess := func(guesser, song, owner string) {
+		service.SubmitGuess(ctx, userIDs[guesser], songIDs[song], userIDs[owner])
+	}
+	guess("Bob", "Alice", "Alice")
+	guess("Charlie", "Alice", "Bob")
+	guess("Alice", "Bob", "Bob")
+	guess("Alice", "Charlie", "Charlie")
+	guess("Bob", "Charlie", "Alice")
+
+	t.Run("Not available before the game is over", func(t *testing.T) {
+		_, err := service.GetWrapped(ctx, partyID, userIDs["Alice"])
+		if err == nil {
+			t.Error("expected error before the game is over, got nil")
+		}
+	})
+
+	service.NextRound(ctx, partyID)
+	service.NextRound(ctx, partyID)
+
+	t.Run("Summary for the winner", func(t *testing.T) {
+		// Given: A finished game where Alice guessed everything right
+		// When: Alice's Wrapped is fetched
+		// Then: It has her rank, her song's guessers and her best friends
+		w, err := service.GetWrapped(ctx, partyID, userIDs["Alice"])
+		if err != nil {
+			t.Fatalf("GetWrapped failed: %v", err)
+		}
+		if w.Rank != 1 || w.Score != 2 || w.Players != 3 {
+			t.Errorf("expected rank 1 with 2 points of 3 players, got rank %d with %d points of %d", w.Rank, w.Score, w.Players)
+		}
+		if len(w.Songs) != 1 || len(w.Songs[0].GuessedBy) != 1 || w.Songs[0].GuessedBy[0] != "Bob" || w.SongsGuessed != 1 {
+			t.Errorf("expected her song to be guessed by Bob, got %+v", w.Songs)
+		}
+		if w.KnewYouBest == nil || w.KnewYouBest.UserName != "Bob" || w.KnewYouBest.Correct != 1 {
+			t.Errorf("expected Bob to know Alice best, got %+v", w.KnewYouBest)
+		}
+		if w.YouKnewBest == nil || w.YouKnewBest.UserName != "Bob" {
+			t.Errorf("expected Alice to know Bob best on a tie, got %+v", w.YouKnewBest)
+		}
+		if len(w.Rounds) != 1 || w.Rounds[0].Songs != 2 || w.Rounds[0].Correct != 2 || w.Rounds[0].Accuracy != 100 {
+			t.Errorf("unexpected round accuracy %+v", w.Rounds)
+		}
+	})
+
+	t.Run("Summary for the last place", func(t *testing.T) {
+		w, err := service.GetWrapped(ctx, partyID, userIDs["Charlie"])
+		if err != nil {
+			t.Fatalf("GetWrapped failed: %v", err)
+		}
+		if w.Rank != 3 || w.YouKnewBest != nil {
+			t.Errorf("expected rank 3 without correct guesses, got rank %d and %+v", w.Rank, w.YouKnewBest)
+		}
+		if w.Rounds[0].Guessed != 1 || w.Rounds[0].Accuracy != 0 {
+			t.Errorf("unexpected round accuracy %+v", w.Rounds)
+		}
+	})
+
+	t.Run("Unknown player", func(t *testing.T) {
+		if _, err := service.GetWrapped(ctx, partyID, 999); err == nil {
+			t.Error("expected error for unknown player, got nil")
+		}
+	})
+}
+
+func TestExportImport(t *testing.T) {
+	database, _ := sql.Open("sqlite3", ":memory:")
+	defer database.Close()
+	_, _ = db.Migrate(database)
+
+	service := party.NewService(database, nil)
+	ctx := context.Background()
+
+	partyID, _, _ := service.CreateParty(ctx, "Export Party", 1)
+	aliceID, _, _ := service.JoinParty(ctx, partyID, "Alice", []party.SongInput{{Title: "Alice's Song"}})
+	bobID, _, _ := service.JoinParty(ctx, partyID, "Bob", []party.SongInput{{Title: "Bob's Song"}})
+	service.StartCompetition(ctx, partyID)
+	songs, _ := service.GetRoundSongs(ctx, partyID, 1)
+	service.SubmitGuess(ctx, aliceID, songByTitle(t, songs, "Bob's Song"), bobID)
+	service.SubmitGuess(ctx, bobID, songByTitle(t, songs, "Alice's Song"), aliceID)
+	service.NextRound(ctx, partyID)
+
+	export, err := service.ExportParty(ctx, partyID)
+	if err != nil {
+		t.Fatalf("ExportParty failed: %v", err)
+	}
+
+	t.Run("Export contains the party", func(t *testing.T) {
+		if export.Version != party.ExportVersion || export.Party.Name != "Export Party" || !export.Party.Started {
+			t.Errorf("unexpected party in export %+v", export.Party)
+		}
+		if len(export.Users) != 2 || len(export.Songs) != 2 || len(export.Guesses) != 2 || len(export.Rounds) != 1 {
+			t.Errorf("expected 2 users, 2 songs, 2 guesses and 1 round, got %d, %d, %d and %d", len(export.Users), len(export.Songs), len(export.Guesses), len(export.Rounds))
+		}
+	})
+
+	t.Run("Import recreates the party", func(t *testing.T) {
+		// Given: An export of a party in progress
+		// When: It is imported
+		// Then: A new party with the same songs, order and leaderboard is created
+		newID, adminToken, err := service.ImportParty(ctx, export)
+		if err != nil {
+			t.Fatalf("ImportParty failed: %v", err)
+		}
+		if newID == partyID {
+			t.Errorf("expected a new party ID, got %s", newID)
+		}
+		if ok, _ := service.VerifyAdmin(ctx, newID, adminToken); !ok {
+			t.Error("expected the new admin token to be valid")
+		}
+
+		want, _ := service.GetLeaderboard(ctx, partyID, 0)
+		got, _ := service.GetLeaderboard(ctx, newID, 0)
+		if fmt.Sprint(got) != fmt.Sprint(want) {
+			t.Errorf("expected leaderboard %v, got %v", want, got)
+		}
+
+		wantSongs, _ := service.GetPartySongs(ctx, partyID)
+		gotSongs, _ := service.GetPartySongs(ctx, newID)
+		if len(gotSongs) != len(wantSongs) {
+			t.Fatalf("expected %d songs, got %d", len(wantSongs), len(gotSongs))
+		}
+		for i := range wantSongs {
+			if gotSongs[i].Title != wantSongs[i].Title || gotSongs[i].OwnerName != wantSongs[i].OwnerName {
+				t.Errorf("expected song %d to be %+v, got %+v", i, wantSongs[i], gotSongs[i])
+			}
+		}
+	})
+
+	t.Run("Rejects broken references", func(t *testing.T) {
+		// Given: An export with a guess on a song that is not in it
+		// When: It is imported
+		// Then: An error is returned and no party is created
+		broken := *export
+		broken.Guesses = append([]party.ExportedGuess{{GuesserID: aliceID, SongID: 999, GuessedUserID: bobID}}, export.Guesses...)
+
+		var before int
+		database.QueryRow("SELECT COUNT(*) FROM parties").Scan(&before)
+		if _, _, err := service.ImportParty(ctx, &broken); err == nil {
+			t.Error("expected error for unknown song, got nil")
+		}
+		var after int
+		database.QueryRow("SELECT COUNT(*) FROM parties").Scan(&after)
+		if after != before {
+			t.Errorf("expected no new party, got %d parties instead of %d", after, before)
+		}
+	})
+
+	t.Run("Rejects unknown version", func(t *testing.T) {
+		future := *export
+		future.Version = party.ExportVersion + 1
+		if _, _, err := service.ImportParty(ctx, &future); err == nil {
+			t.Error("expected error for unknown version, got nil")
+		}
+	})
+}
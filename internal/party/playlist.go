@@ -0,0 +1,189 @@
+package party
+
+import (
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/jehaj/new-year-wrapped/internal/i18n"
+)
+
+// PlaylistTrack is a song of a party as it appears in an exported playlist.
+// Owners are left out so the playlist doesn't spoil the game.
+type PlaylistTrack struct {
+	Title        string `json:"title"`
+	YouTubeID    string `json:"youtube_id"`
+	URL          string `json:"url"`
+	ThumbnailURL string `json:"thumbnail_url"`
+	Round        int    `json:"round"` // 0 until the competition starts.
+}
+
+// RoundPlaylist links to all songs of a round played one after another on
+// YouTube.
+type RoundPlaylist struct {
+	Round int    `json:"round"`
+	Songs int    `json:"songs"`
+	URL   string `json:"url"`
+}
+
+// GetPlaylist returns the songs of a party that can be played, in shuffled
+// order. Songs typed by hand have no YouTube ID and are left out.
+func (s *Service) GetPlaylist(ctx context.Context, partyID string) ([]PlaylistTrack, error) {
+	settings, err := s.GetSettings(ctx, partyID)
+	if err != nil {
+		return nil, err
+	}
+	songs, err := s.getPartySongs(ctx, partyID)
+	if err != nil {
+		return nil, err
+	}
+
+	tracks := []PlaylistTrack{}
+	for _, ps := range songs {
+		if ps.YouTubeID == "" {
+			continue
+		}
+		track := PlaylistTrack{
+			Title:        ps.Title,
+			YouTubeID:    ps.YouTubeID,
+			URL:          s.music.URL(ps.YouTubeID),
+			ThumbnailURL: ps.ThumbnailURL,
+		}
+		if ps.ShuffleIndex >= 0 {
+			track.Round = ps.ShuffleIndex/settings.SongsPerRound + 1
+		}
+		tracks = append(tracks, track)
+	}
+	return tracks, nil
+}
+
+// RoundPlaylists groups tracks by round into YouTube watch_videos links,
+// which play up to 50 videos in a row without a YouTube account.
+func RoundPlaylists(tracks []PlaylistTrack) []RoundPlaylist {
+	playlists := []RoundPlaylist{}
+	var ids []string
+	flush := func(round int) {
+		if len(ids) > 0 {
+			playlists = append(playlists, RoundPlaylist{
+				Round: round,
+				Songs: len(ids),
+				URL:   "https://www.youtube.com/watch_videos?video_ids=" + url.QueryEscape(strings.Join(ids, ",")),
+			})
+		}
+		ids = nil
+	}
+
+	round := 0
+	for _, t := range tracks {
+		if t.Round == 0 {
+			continue
+		}
+		if t.Round != round {
+			flush(round)
+			round = t.Round
+		}
+		ids = append(ids, t.YouTubeID)
+	}
+	flush(round)
+	return playlists
+}
+
+// playlistLine keeps a value on a single line of an M3U file.
+var playlistLine = strings.NewReplacer("\r", " ", "\n", " ")
+
+// WriteM3U writes tracks as an extended M3U playlist.
+func WriteM3U(w io.Writer, name string, tracks []PlaylistTrack) error {
+	var b strings.Builder
+	b.WriteString("#EXTM3U\n")
+	fmt.Fprintf(&b, "#PLAYLIST:%s\n", playlistLine.Replace(name))
+	for _, t := range tracks {
+		fmt.Fprintf(&b, "#EXTINF:-1,%s\n%s\n", playlistLine.Replace(t.Title), playlistLine.Replace(t.URL))
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+type xspfPlaylist struct {
+	XMLName xml.Name    `xml:"http://xspf.org/ns/0/ playlist"`
+	Version int         `xml:"version,attr"`
+	Title   string      `xml:"title"`
+	Tracks  []xspfTrack `xml:"trackList>track"`
+}
+
+type xspfTrack struct {
+	Location   string `xml:"location"`
+	Title      string `xml:"title"`
+	Image      string `xml:"image,omitempty"`
+	Annotation string `xml:"annotation,omitempty"`
+}
+
+// WriteXSPF writes tracks as an XSPF playlist, noting the round of each in
+// lang.
+func WriteXSPF(w io.Writer, name string, tracks []PlaylistTrack, lang string) error {
+	playlist := xspfPlaylist{Version: 1, Title: name}
+	for _, t := range tracks {
+		track := xspfTrack{Location: t.URL, Title: t.Title, Image: t.ThumbnailURL}
+		if t.Round > 0 {
+			track.Annotation = i18n.T(lang, "playlists.round", t.Round)
+		}
+		playlist.Tracks = append(playlist.Tracks, track)
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	return enc.Encode(playlist)
+}
+
+// playlist loads the playlist of a party, writing an error response and
+// returning false if that fails.
+func (h *Handler) playlist(w http.ResponseWriter, r *http.Request) (partyName string, tracks []PlaylistTrack, ok bool) {
+	partyID := h.getPartyID(r)
+	partyName, err := h.service.GetPartyName(r.Context(), partyID)
+	if err != nil {
+		h.writeError(w, r, err)
+		return "", nil, false
+	}
+	tracks, err = h.service.GetPlaylist(r.Context(), partyID)
+	if err != nil {
+		h.writeError(w, r, err)
+		return "", nil, false
+	}
+	return partyName, tracks, true
+}
+
+func (h *Handler) PlaylistM3U(w http.ResponseWriter, r *http.Request) {
+	name, tracks, ok := h.playlist(w, r)
+	if !ok {
+		return
+	}
+	w.Header().Set("Content-Type", "audio/x-mpegurl; charset=utf-8")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="party-%s.m3u"`, h.getPartyID(r)))
+	WriteM3U(w, name, tracks)
+}
+
+func (h *Handler) PlaylistXSPF(w http.ResponseWriter, r *http.Request) {
+	name, tracks, ok := h.playlist(w, r)
+	if !ok {
+		return
+	}
+	w.Header().Set("Content-Type", "application/xspf+xml; charset=utf-8")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="party-%s.xspf"`, h.getPartyID(r)))
+	WriteXSPF(w, name, tracks, h.lang(r))
+}
+
+func (h *Handler) RoundPlaylists(w http.ResponseWriter, r *http.Request) {
+	_, tracks, ok := h.playlist(w, r)
+	if !ok {
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(RoundPlaylists(tracks))
+}
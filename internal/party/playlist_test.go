@@ -0,0 +1,119 @@
+package party_test
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/xml"
+	"strings"
+	"testing"
+
+	"github.com/jehaj/new-year-wrapped/internal/db"
+	"github.com/jehaj/new-year-wrapped/internal/i18n"
+	"github.com/jehaj/new-year-wrapped/internal/party"
+)
+
+func TestPlaylist(t *testing.T) {
+	database, _ := sql.Open("sqlite3", ":memory:")
+	defer database.Close()
+	_, _ = db.Migrate(database)
+
+	service := party.NewService(database, nil)
+	service.SetMusicProvider(party.DefaultFakeCatalog())
+	ctx := context.Background()
+	partyID, _, _ := service.CreateParty(ctx, "Playlist Party", 2)
+	songsPerRound := 2
+	service.UpdateSettings(ctx, partyID, party.SettingsUpdate{SongsPerRound: &songsPerRound})
+	service.JoinParty(ctx, partyID, "Alice", []party.SongInput{{YouTubeID: "fake-espresso"}, {Title: "Typed By Hand"}})
+	service.JoinParty(ctx, partyID, "Bob", []party.SongInput{{YouTubeID: "fake-birds"}, {YouTubeID: "fake-apt"}})
+
+	t.Run("No rounds before the start", func(t *testing.T) {
+		tracks, err := service.GetPlaylist(ctx, partyID)
+		if err != nil {
+			t.Fatalf("GetPlaylist failed: %v", err)
+		}
+		if len(tracks) != 3 || len(party.RoundPlaylists(tracks)) != 0 {
+			t.Errorf("expected 3 tracks without rounds, got %+v", tracks)
+		}
+	})
+
+	service.StartCompetition(ctx, partyID)
+	tracks, err := service.GetPlaylist(ctx, partyID)
+	if err != nil {
+		t.Fatalf("GetPlaylist failed: %v", err)
+	}
+
+	t.Run("Tracks follow the shuffled order", func(t *testing.T) {
+		// Given: A started party with three songs from the catalog and one typed by hand
+		// When: The playlist is fetched
+		// Then: The catalog songs are listed in the order they are played
+		songs, _ := service.GetPartySongs(ctx, partyID)
+		var want []string
+		for _, s := range songs {
+			if s.YouTubeID != "" {
+				want = append(want, s.YouTubeID)
+			}
+		}
+		var got []string
+		for _, tr := range tracks {
+			got = append(got, tr.YouTubeID)
+			if tr.URL != "https://music.example/track/"+tr.YouTubeID || tr.Round < 1 || tr.Round > 2 {
+				t.Errorf("unexpected track %+v", tr)
+			}
+		}
+		if strings.Join(got, ",") != strings.Join(want, ",") {
+			t.Errorf("expected order %v, got %v", want, got)
+		}
+	})
+
+	t.Run("One YouTube link per round", func(t *testing.T) {
+		playlists := party.RoundPlaylists(tracks)
+		total := 0
+		for i, p := range playlists {
+			if p.Round != i+1 || !strings.HasPrefix(p.URL, "https://www.youtube.com/watch_videos?video_ids=fake-") {
+				t.Errorf("unexpected round playlist %+v", p)
+			}
+			total += p.Songs
+		}
+		if len(playlists) != 2 || total != 3 {
+			t.Errorf("expected 3 songs in 2 rounds, got %+v", playlists)
+		}
+	})
+
+	t.Run("M3U", func(t *testing.T) {
+		var buf bytes.Buffer
+		if err := party.WriteM3U(&buf, "Playlist\nParty", tracks); err != nil {
+			t.Fatalf("WriteM3U failed: %v", err)
+		}
+		lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+		if len(lines) != 2+2*len(tracks) || lines[0] != "#EXTM3U" || lines[1] != "#PLAYLIST:Playlist Party" {
+			t.Errorf("unexpected M3U:\n%s", buf.String())
+		}
+		if lines[2] != "#EXTINF:-1,"+tracks[0].Title || lines[3] != tracks[0].URL {
+			t.Errorf("unexpected first entry %q, %q", lines[2], lines[3])
+		}
+	})
+
+	t.Run("XSPF", func(t *testing.T) {
+		var buf bytes.Buffer
+		if err := party.WriteXSPF(&buf, "Playlist Party", tracks, i18n.Danish); err != nil {
+			t.Fatalf("WriteXSPF failed: %v", err)
+		}
+		var playlist struct {
+			Title  string `xml:"title"`
+			Tracks []struct {
+				Location   string `xml:"location"`
+				Annotation string `xml:"annotation"`
+			} `xml:"trackList>track"`
+		}
+		if err := xml.Unmarshal(buf.Bytes(), &playlist); err != nil {
+			t.Fatalf("invalid XSPF: %v", err)
+		}
+		if playlist.Title != "Playlist Party" || len(playlist.Tracks) != len(tracks) {
+			t.Fatalf("unexpected XSPF:\n%s", buf.String())
+		}
+		if playlist.Tracks[0].Location != tracks[0].URL || playlist.Tracks[0].Annotation != "Runde 1" {
+			t.Errorf("unexpected first track %+v", playlist.Tracks[0])
+		}
+	})
+}
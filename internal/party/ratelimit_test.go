@@ -0,0 +1,88 @@
+package party_test
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/jehaj/new-year-wrapped/internal/db"
+	"github.com/jehaj/new-year-wrapped/internal/party"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func TestRateLimiter(t *testing.T) {
+	database, _ := sql.Open("sqlite3", ":memory:")
+	defer database.Close()
+	_, _ = db.Migrate(database)
+
+	now := time.Date(2025, 12, 31, 23, 0, 0, 0, time.UTC)
+	limiter := party.NewRateLimiter(1, 3)
+	limiter.SetClock(func() time.Time { return now })
+
+	service := party.NewService(database, nil)
+	service.SetMusicProvider(party.DefaultFakeCatalog())
+	handler := party.NewHandler(service)
+	search := handler.RateLimit(limiter, handler.SearchSongs)
+	request := func(addr, forwardedFor string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/api/search?q=a", nil)
+		req.RemoteAddr = addr
+		if forwardedFor != "" {
+			req.Header.Set("X-Forwarded-For", forwardedFor)
+		}
+		rr := httptest.NewRecorder()
+		search(rr, req)
+		return rr
+	}
+
+	t.Run("Bursts are allowed up to the limit", func(t *testing.T) {
+		// Given: A limit of 3 requests in a burst
+		// When: A client makes 4 requests at once
+		// Then: The 4th is rejected with 429 and Retry-After
+		for i := range 3 {
+			if rr := request("10.0.0.1:1234", ""); rr.Code != http.StatusOK {
+				t.Fatalf("request %d: expected status 200, got %d", i+1, rr.Code)
+			}
+		}
+		rr := request("10.0.0.1:5678", "")
+		if rr.Code != http.StatusTooManyRequests {
+			t.Fatalf("expected status 429, got %d", rr.Code)
+		}
+		if got := rr.Header().Get("Retry-After"); got != "1" {
+			t.Errorf("expected Retry-After 1, got %q", got)
+		}
+
+		var resp struct{ Error, Code string }
+		if err := json.NewDecoder(rr.Body).Decode(&resp); err != nil || resp.Error == "" || resp.Code != string(party.CodeTooManyRequests) {
+			t.Errorf("expected a JSON error with code %q, got %v: %+v", party.CodeTooManyRequests, err, resp)
+		}
+	})
+
+	t.Run("Other clients are not affected", func(t *testing.T) {
+		if rr := request("10.0.0.2:1234", ""); rr.Code != http.StatusOK {
+			t.Errorf("expected status 200, got %d", rr.Code)
+		}
+	})
+
+	t.Run("Tokens refill over time", func(t *testing.T) {
+		now = now.Add(time.Second)
+		if rr := request("10.0.0.1:1234", ""); rr.Code != http.StatusOK {
+			t.Errorf("expected status 200 after refill, got %d", rr.Code)
+		}
+		if rr := request("10.0.0.1:1234", ""); rr.Code != http.StatusTooManyRequests {
+			t.Errorf("expected status 429, got %d", rr.Code)
+		}
+	})
+
+	t.Run("Forwarded clients are only trusted when enabled", func(t *testing.T) {
+		if rr := request("10.0.0.1:1234", "192.0.2.1"); rr.Code != http.StatusTooManyRequests {
+			t.Errorf("expected X-Forwarded-For to be ignored, got status %d", rr.Code)
+		}
+		limiter.TrustForwardedFor = true
+		if rr := request("10.0.0.1:1234", "192.0.2.1, 10.0.0.1"); rr.Code != http.StatusOK {
+			t.Errorf("expected forwarded client to have its own limit, got status %d", rr.Code)
+		}
+	})
+}
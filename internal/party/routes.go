@@ -0,0 +1,98 @@
+package party
+
+import "net/http"
+
+// Route is a route of the server. Admin routes are only served to requests
+// carrying the admin token of the party. Download routes are admin routes
+// linked from the UI, which may also carry it in the admin_token query
+// parameter.
+type Route struct {
+	Pattern  string
+	Admin    bool
+	Download bool
+	Handler  http.HandlerFunc
+}
+
+// Routes returns the routes of the server: the JSON API, the versioned API
+// and the pages and forms of the UI. Searches are rate limited by
+// searchLimiter, if set.
+func (h *Handler) Routes(searchLimiter *RateLimiter) []Route {
+	search := h.SearchSongs
+	if searchLimiter != nil {
+		search = h.RateLimit(searchLimiter, h.SearchSongs)
+	}
+
+	// API Routes
+	routes := []Route{
+		{Pattern: "POST /parties", Handler: h.CreateParty},
+		{Pattern: "POST /parties/{id}/join", Handler: h.JoinParty},
+		{Pattern: "GET /parties/{id}/users", Handler: h.GetUsers},
+		{Pattern: "GET /parties/{id}/players", Admin: true, Handler: h.GetPlayers},
+		{Pattern: "PATCH /parties/{id}/users/{user}", Admin: true, Handler: h.RenameUser},
+		{Pattern: "DELETE /parties/{id}/users/{user}", Admin: true, Handler: h.RemoveUser},
+		{Pattern: "PUT /parties/{id}/songs/{song}", Admin: true, Handler: h.UpdateSong},
+		{Pattern: "GET /parties/{id}/me/songs", Handler: h.GetMySongs},
+		{Pattern: "PUT /parties/{id}/me/songs", Handler: h.UpdateMySongs},
+		{Pattern: "POST /parties/{id}/start", Admin: true, Handler: h.StartCompetition},
+		{Pattern: "POST /parties/{id}/next", Admin: true, Handler: h.NextRound},
+		{Pattern: "GET /parties/{id}/round", Handler: h.GetCurrentRound},
+		{Pattern: "GET /parties/{id}/results", Handler: h.GetRoundResults},
+		{Pattern: "POST /parties/{id}/guess", Handler: h.SubmitGuess},
+		{Pattern: "GET /parties/{id}/leaderboard", Handler: h.GetLeaderboard},
+		{Pattern: "GET /parties/{id}/leaderboard/teams", Handler: h.GetTeamLeaderboard},
+		{Pattern: "GET /parties/{id}/teams", Handler: h.GetTeams},
+		{Pattern: "POST /parties/{id}/teams", Admin: true, Handler: h.CreateTeam},
+		{Pattern: "DELETE /parties/{id}/teams/{team}", Admin: true, Handler: h.DeleteTeam},
+		{Pattern: "PUT /parties/{id}/team", Handler: h.JoinTeam},
+		{Pattern: "GET /parties/{id}/events", Handler: h.Events},
+		{Pattern: "GET /parties/{id}/settings", Admin: true, Handler: h.GetSettings},
+		{Pattern: "PATCH /parties/{id}/settings", Admin: true, Handler: h.UpdateSettings},
+		{Pattern: "GET /parties/{id}/export", Admin: true, Download: true, Handler: h.ExportParty},
+		{Pattern: "POST /parties/import", Handler: h.ImportParty},
+		{Pattern: "GET /parties/{id}/playlist.m3u", Admin: true, Download: true, Handler: h.PlaylistM3U},
+		{Pattern: "GET /parties/{id}/playlist.xspf", Admin: true, Download: true, Handler: h.PlaylistXSPF},
+		{Pattern: "GET /parties/{id}/playlist/rounds", Admin: true, Handler: h.RoundPlaylists},
+		{Pattern: "GET /api/search", Handler: search},
+
+		// UI Routes
+		{Pattern: "GET /", Handler: h.IndexPage},
+		{Pattern: "GET /parties", Handler: h.UIPartyRedirect},
+		{Pattern: "GET /parties/{id}", Handler: h.PartyPage},
+		{Pattern: "GET /parties/{id}/game", Handler: h.GamePage},
+		{Pattern: "GET /parties/{id}/song_list", Handler: h.SongListPage},
+		{Pattern: "GET /parties/{id}/qrcode", Handler: h.QRCode},
+		{Pattern: "GET /parties/{id}/wrapped/{user}", Handler: h.WrappedPage},
+		{Pattern: "GET /parties/{id}/wrapped/{user}/card.png", Handler: h.WrappedCard},
+
+		// UI Action Routes. The admin forms check the admin token they post.
+		{Pattern: "POST /ui/parties/create", Handler: h.UICreateParty},
+		{Pattern: "POST /ui/language", Handler: h.UISetLanguage},
+		{Pattern: "POST /ui/parties/{id}/join", Handler: h.UIJoinParty},
+		{Pattern: "POST /ui/parties/{id}/settings", Handler: h.UIUpdateSettings},
+		{Pattern: "POST /ui/parties/{id}/users/{user}/rename", Handler: h.UIRenameUser},
+		{Pattern: "POST /ui/parties/{id}/users/{user}/delete", Handler: h.UIRemoveUser},
+		{Pattern: "POST /ui/parties/{id}/songs/{song}", Handler: h.UIUpdateSong},
+		{Pattern: "POST /ui/parties/{id}/teams", Handler: h.UICreateTeam},
+		{Pattern: "POST /ui/parties/{id}/teams/{team}/delete", Handler: h.UIDeleteTeam},
+		{Pattern: "POST /ui/parties/{id}/team", Handler: h.UIJoinTeam},
+		{Pattern: "POST /ui/parties/{id}/my-songs", Handler: h.UIUpdateMySongs},
+		{Pattern: "POST /ui/parties/{id}/start", Handler: h.UIStartCompetition},
+		{Pattern: "POST /ui/parties/{id}/next", Handler: h.UINextRound},
+		{Pattern: "POST /ui/parties/{id}/guess", Handler: h.UIGuess},
+	}
+	for i, rt := range routes {
+		switch {
+		case rt.Download:
+			routes[i].Handler = h.RequireAdminDownload(rt.Handler)
+		case rt.Admin:
+			routes[i].Handler = h.RequireAdmin(rt.Handler)
+		}
+	}
+
+	// Versioned API Routes, described at /api/v1/openapi.json. They are
+	// already wrapped for admins.
+	for _, rt := range h.APIRoutes(searchLimiter) {
+		routes = append(routes, Route{Pattern: rt.Pattern(), Admin: rt.Admin, Handler: rt.Handler})
+	}
+	return routes
+}
@@ -0,0 +1,121 @@
+package party
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+type execer interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+}
+
+// openRound records when a round opened, which speed scoring measures
+// guesses against.
+func (s *Service) openRound(ctx context.Context, e execer, partyID string, round int) error {
+	_, err := e.ExecContext(ctx, `
+		INSERT INTO rounds (party_id, number, opened_at) VALUES (?, ?, ?)
+		ON CONFLICT(party_id, number) DO UPDATE SET opened_at = excluded.opened_at`,
+		partyID, round, s.now().UnixMilli())
+	return err
+}
+
+// roundDeadline returns when a round opening now should close, as a Unix
+// timestamp. It is 0 when the party has no time limit or the round has no
+// songs because the game is over.
+func (s *Service) roundDeadline(ctx context.Context, q queryRower, partyID string, round int) (int64, error) {
+	settings, err := getSettings(ctx, q, partyID)
+	if err != nil {
+		return 0, err
+	}
+	if settings.RoundTimeLimit == 0 {
+		return 0, nil
+	}
+
+	var count int
+	err = q.QueryRowContext(ctx, `
+		SELECT COUNT(*)
+		FROM songs
+		JOIN users ON songs.user_id = users.id
+		WHERE users.party_id = ? AND songs.shuffle_index BETWEEN ? AND ?`,
+		partyID, (round-1)*settings.SongsPerRound, round*settings.SongsPerRound-1).Scan(&count)
+	if err != nil || count == 0 {
+		return 0, err
+	}
+
+	return s.now().Add(time.Duration(settings.RoundTimeLimit) * time.Second).Unix(), nil
+}
+
+// GetRoundDeadline returns when the current round closes for guesses. It is
+// the zero time when the round has no time limit.
+func (s *Service) GetRoundDeadline(ctx context.Context, partyID string) (time.Time, error) {
+	var deadline int64
+	err := s.db.QueryRowContext(ctx, "SELECT round_deadline FROM parties WHERE id = ?", partyID).Scan(&deadline)
+	if err != nil || deadline == 0 {
+		return time.Time{}, err
+	}
+	return time.Unix(deadline, 0), nil
+}
+
+// RevealExpiredRounds reveals the results of every round whose deadline has
+// passed and returns how many rounds it revealed.
+func (s *Service) RevealExpiredRounds(ctx context.Context) (int, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT id, current_round
+		FROM parties
+		WHERE started AND NOT show_results AND round_deadline > 0 AND round_deadline <= ?`, s.now().Unix())
+	if err != nil {
+		return 0, err
+	}
+
+	type expiredRound struct {
+		partyID string
+		round   int
+	}
+	var expired []expiredRound
+	for rows.Next() {
+		var e expiredRound
+		if err := rows.Scan(&e.partyID, &e.round); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		expired = append(expired, e)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	revealed := 0
+	for _, e := range expired {
+		// The admin may have revealed the round since it was selected
+		res, err := s.db.ExecContext(ctx, "UPDATE parties SET show_results = TRUE, round_deadline = 0 WHERE id = ? AND current_round = ? AND NOT show_results", e.partyID, e.round)
+		if err != nil {
+			return revealed, err
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			continue
+		}
+		s.log(e.partyID, "Time is up, revealing round %d", e.round)
+		s.publish(e.partyID, EventReveal, map[string]int{"round": e.round})
+		revealed++
+	}
+	return revealed, nil
+}
+
+// RunScheduler reveals expired rounds every interval until ctx is cancelled.
+func (s *Service) RunScheduler(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := s.RevealExpiredRounds(ctx); err != nil && s.logger != nil {
+				s.logger.Printf("Revealing expired rounds failed: %v", err)
+			}
+		}
+	}
+}
@@ -0,0 +1,286 @@
+package party
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ScoringSong is a song as seen by a Scorer.
+type ScoringSong struct {
+	ID     int
+	Round  int   // 0 until the competition has started.
+	Owners []int // Every user who submitted the song, so duplicates count for all of them.
+}
+
+// ScoringGuess is a guess as seen by a Scorer.
+type ScoringGuess struct {
+	GuesserID     int
+	SongID        int
+	GuessedUserID int
+	At            time.Time // Zero for guesses made before timestamps were recorded.
+	Wager         int       // Points at stake in wager mode, 1 for other modes.
+}
+
+// ScoringInput is everything a Scorer needs to score a party.
+type ScoringInput struct {
+	Users         []User
+	Songs         []ScoringSong
+	Guesses       []ScoringGuess
+	RoundOpenedAt map[int]time.Time
+}
+
+// Scores are the points of each user, per round and in total.
+type Scores struct {
+	ByRound map[int]map[int]int // Round → user ID → points.
+	Total   map[int]int         // User ID → points over all rounds.
+}
+
+// Scorer turns the songs and guesses of a party into scores. New rule sets
+// are added by implementing Scorer and registering it in scorers.
+type Scorer interface {
+	Score(in ScoringInput) Scores
+}
+
+// scorers maps each scoring mode to its Scorer.
+var scorers = map[string]Scorer{
+	ScoringStandard: OnePointScorer{},
+	ScoringSpeed:    SpeedScorer{MaxPoints: SpeedMaxPoints, MinPoints: SpeedMinPoints, DecaySeconds: SpeedDecaySeconds},
+	ScoringWager:    WagerScorer{},
+}
+
+// ScorerFor returns the Scorer for a scoring mode, falling back to the
+// standard one for unknown modes.
+func ScorerFor(mode string) Scorer {
+	if scorer, ok := scorers[mode]; ok {
+		return scorer
+	}
+	return OnePointScorer{}
+}
+
+// OnePointScorer gives one point per correct guess.
+type OnePointScorer struct{}
+
+func (OnePointScorer) Score(in ScoringInput) Scores {
+	return scoreGuesses(in, func(_ ScoringSong, _ ScoringGuess, correct bool) int {
+		if !correct {
+			return 0
+		}
+		return 1
+	})
+}
+
+// SpeedScorer gives MaxPoints for a correct guess made as the round opens,
+// one point less for every DecaySeconds after that, but at least MinPoints.
+type SpeedScorer struct {
+	MaxPoints    int
+	MinPoints    int
+	DecaySeconds int
+}
+
+func (sc SpeedScorer) Score(in ScoringInput) Scores {
+	return scoreGuesses(in, func(song ScoringSong, g ScoringGuess, correct bool) int {
+		if !correct {
+			return 0
+		}
+		var elapsed time.Duration
+		if opened, ok := in.RoundOpenedAt[song.Round]; ok && !g.At.IsZero() {
+			elapsed = max(0, g.At.Sub(opened))
+		}
+		points := sc.MaxPoints - int(elapsed/time.Second)/sc.DecaySeconds
+		return min(sc.MaxPoints, max(sc.MinPoints, points))
+	})
+}
+
+// WagerScorer gives the wager of a correct guess and takes the wager of a
+// wrong one, so scores can be negative.
+type WagerScorer struct{}
+
+func (WagerScorer) Score(in ScoringInput) Scores {
+	return scoreGuesses(in, func(_ ScoringSong, g ScoringGuess, correct bool) int {
+		if !correct {
+			return -g.Wager
+		}
+		return g.Wager
+	})
+}
+
+// scoreGuesses awards the points of every guess on a song in play. A guess is
+// correct if the guessed user is one of the song's owners.
+func scoreGuesses(in ScoringInput, points func(song ScoringSong, g ScoringGuess, correct bool) int) Scores {
+	scores := Scores{ByRound: make(map[int]map[int]int), Total: make(map[int]int)}
+	for _, u := range in.Users {
+		scores.Total[u.ID] = 0
+	}
+
+	songs := make(map[int]ScoringSong, len(in.Songs))
+	for _, song := range in.Songs {
+		songs[song.ID] = song
+		if song.Round > 0 && scores.ByRound[song.Round] == nil {
+			scores.ByRound[song.Round] = make(map[int]int)
+		}
+	}
+
+	for _, g := range in.Guesses {
+		song, ok := songs[g.SongID]
+		if !ok || song.Round == 0 {
+			continue
+		}
+		p := points(song, g, slices.Contains(song.Owners, g.GuessedUserID))
+		scores.ByRound[song.Round][g.GuesserID] += p
+		scores.Total[g.GuesserID] += p
+	}
+	return scores
+}
+
+// partySong is a song of a party together with the users who submitted it.
+type partySong struct {
+	SongResult
+	SongKey      string
+	UserID       int
+	ShuffleIndex int
+}
+
+// songIdentity tells which songs count as the same song. Songs share the key
+// assigned when they were added; songs from before keys were assigned fall
+// back to their YouTube ID or, for free-text songs, only equal themselves.
+func songIdentity(key, youtubeID string, songID int) string {
+	if key != "" {
+		return "key:" + key
+	}
+	if youtubeID != "" {
+		return "yt:" + youtubeID
+	}
+	return fmt.Sprintf("id:%d", songID)
+}
+
+// getPartySongs returns all songs of a party in shuffled order, with the
+// owners of duplicate songs grouped together.
+func (s *Service) getPartySongs(ctx context.Context, partyID string) ([]partySong, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT s.id, s.title, s.youtube_id, s.thumbnail_url, s.song_key, s.shuffle_index, u.id, u.name
+		FROM songs s
+		JOIN users u ON s.user_id = u.id
+		WHERE u.party_id = ?
+		ORDER BY s.shuffle_index ASC, u.name ASC, s.id ASC`, partyID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var songs []partySong
+	for rows.Next() {
+		var ps partySong
+		var owner User
+		if err := rows.Scan(&ps.ID, &ps.Title, &ps.YouTubeID, &ps.ThumbnailURL, &ps.SongKey, &ps.ShuffleIndex, &owner.ID, &owner.Name); err != nil {
+			return nil, err
+		}
+		ps.UserID = owner.ID
+		ps.Owners = []User{owner}
+		songs = append(songs, ps)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// Group owners by song identity, listing them in the order they submitted
+	owners := make(map[string][]User)
+	bySubmission := slices.Clone(songs)
+	sort.SliceStable(bySubmission, func(i, j int) bool { return bySubmission[i].ID < bySubmission[j].ID })
+	for _, ps := range bySubmission {
+		key := songIdentity(ps.SongKey, ps.YouTubeID, ps.ID)
+		owners[key] = append(owners[key], ps.Owners[0])
+	}
+	for i := range songs {
+		songs[i].Owners = owners[songIdentity(songs[i].SongKey, songs[i].YouTubeID, songs[i].ID)]
+		names := make([]string, len(songs[i].Owners))
+		for j, o := range songs[i].Owners {
+			names[j] = o.Name
+		}
+		songs[i].OwnerName = strings.Join(names, ", ")
+	}
+	return songs, nil
+}
+
+// scoringInput loads everything needed to score a party.
+func (s *Service) scoringInput(ctx context.Context, partyID string, songsPerRound int) (ScoringInput, error) {
+	var in ScoringInput
+
+	users, err := s.GetUsers(ctx, partyID)
+	if err != nil {
+		return in, err
+	}
+	in.Users = users
+
+	songs, err := s.getPartySongs(ctx, partyID)
+	if err != nil {
+		return in, err
+	}
+	for _, ps := range songs {
+		song := ScoringSong{ID: ps.ID}
+		if ps.ShuffleIndex >= 0 {
+			song.Round = ps.ShuffleIndex/songsPerRound + 1
+		}
+		for _, o := range ps.Owners {
+			song.Owners = append(song.Owners, o.ID)
+		}
+		in.Songs = append(in.Songs, song)
+	}
+
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT g.guesser_id, g.song_id, g.guessed_user_id, g.created_at, g.wager
+		FROM guesses g
+		JOIN users u ON g.guesser_id = u.id
+		WHERE u.party_id = ?`, partyID)
+	if err != nil {
+		return in, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var g ScoringGuess
+		var createdAt int64
+		if err := rows.Scan(&g.GuesserID, &g.SongID, &g.GuessedUserID, &createdAt, &g.Wager); err != nil {
+			return in, err
+		}
+		if createdAt > 0 {
+			g.At = time.UnixMilli(createdAt)
+		}
+		in.Guesses = append(in.Guesses, g)
+	}
+	if err := rows.Err(); err != nil {
+		return in, err
+	}
+
+	roundRows, err := s.db.QueryContext(ctx, "SELECT number, opened_at FROM rounds WHERE party_id = ?", partyID)
+	if err != nil {
+		return in, err
+	}
+	defer roundRows.Close()
+	in.RoundOpenedAt = make(map[int]time.Time)
+	for roundRows.Next() {
+		var number int
+		var openedAt int64
+		if err := roundRows.Scan(&number, &openedAt); err != nil {
+			return in, err
+		}
+		in.RoundOpenedAt[number] = time.UnixMilli(openedAt)
+	}
+	return in, roundRows.Err()
+}
+
+// leaderboard orders users by points, highest first. Ties keep the order in
+// which the users joined.
+func leaderboard(users []User, points map[int]int) []LeaderboardEntry {
+	byID := slices.Clone(users)
+	sort.Slice(byID, func(i, j int) bool { return byID[i].ID < byID[j].ID })
+	sort.SliceStable(byID, func(i, j int) bool { return points[byID[i].ID] > points[byID[j].ID] })
+
+	entries := make([]LeaderboardEntry, len(byID))
+	for i, u := range byID {
+		entries[i] = LeaderboardEntry{UserName: u.Name, Score: points[u.ID]}
+	}
+	return entries
+}
@@ -0,0 +1,102 @@
+package party_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/jehaj/new-year-wrapped/internal/party"
+)
+
+func TestScorers(t *testing.T) {
+	opened := time.Date(2025, 12, 31, 23, 0, 0, 0, time.UTC)
+
+	// Alice (1) and Bob (2) both submitted song 10, Charlie (3) song 11
+	in := party.ScoringInput{
+		Users: []party.User{{ID: 1, Name: "Alice"}, {ID: 2, Name: "Bob"}, {ID: 3, Name: "Charlie"}},
+		Songs: []party.ScoringSong{
+			{ID: 10, Round: 1, Owners: []int{1, 2}},
+			{ID: 11, Round: 2, Owners: []int{3}},
+			{ID: 12, Round: 0, Owners: []int{3}},
+		},
+		Guesses: []party.ScoringGuess{
+			{GuesserID: 3, SongID: 10, GuessedUserID: 2, At: opened.Add(5 * time.Second)},
+			{GuesserID: 1, SongID: 10, GuessedUserID: 3, At: opened},
+			{GuesserID: 1, SongID: 11, GuessedUserID: 3, At: opened.Add(time.Minute + 25*time.Second)},
+			{GuesserID: 2, SongID: 11, GuessedUserID: 3},
+			{GuesserID: 1, SongID: 12, GuessedUserID: 3, At: opened},
+		},
+		RoundOpenedAt: map[int]time.Time{1: opened, 2: opened.Add(time.Minute)},
+	}
+
+	t.Run("One point per correct guess", func(t *testing.T) {
+		// Given: Guesses on a duplicate song, a wrong guess and an unshuffled song
+		// When: The party is scored with the standard scorer
+		// Then: Any owner of a duplicate counts and unshuffled songs are ignored
+		scores := party.OnePointScorer{}.Score(in)
+
+		if scores.ByRound[1][3] != 1 || scores.ByRound[1][1] != 0 {
+			t.Errorf("unexpected round 1 scores %v", scores.ByRound[1])
+		}
+		if scores.ByRound[2][1] != 1 || scores.ByRound[2][2] != 1 {
+			t.Errorf("unexpected round 2 scores %v", scores.ByRound[2])
+		}
+		want := map[int]int{1: 1, 2: 1, 3: 1}
+		for id, points := range want {
+			if scores.Total[id] != points {
+				t.Errorf("expected total %d for user %d, got %d", points, id, scores.Total[id])
+			}
+		}
+	})
+
+	t.Run("Speed scorer rewards fast guesses", func(t *testing.T) {
+		// Given: Guesses made at different times after their round opened
+		// When: The party is scored with the speed scorer
+		// Then: Points decay with time and untimed guesses count as instant
+		scorer := party.SpeedScorer{MaxPoints: 10, MinPoints: 1, DecaySeconds: 10}
+		scores := scorer.Score(in)
+
+		if got := scores.ByRound[1][3]; got != 10 {
+			t.Errorf("expected 10 points for a guess after 5s, got %d", got)
+		}
+		if got := scores.ByRound[2][1]; got != 8 {
+			t.Errorf("expected 8 points for a guess after 25s, got %d", got)
+		}
+		if got := scores.ByRound[2][2]; got != 10 {
+			t.Errorf("expected 10 points for an untimed guess, got %d", got)
+		}
+	})
+
+	t.Run("Wager scorer adds or subtracts the wager", func(t *testing.T) {
+		// Given: A correct guess with wager 3 and a wrong guess with wager 2
+		// When: The guesses are scored with the wager scorer
+		// Then: The correct guess earns 3 points and the wrong one loses 2
+		in := party.ScoringInput{
+			Users: []party.User{{ID: 1, Name: "Alice"}, {ID: 2, Name: "Bob"}},
+			Songs: []party.ScoringSong{
+				{ID: 10, Round: 1, Owners: []int{1}},
+				{ID: 11, Round: 1, Owners: []int{2}},
+			},
+			Guesses: []party.ScoringGuess{
+				{GuesserID: 2, SongID: 10, GuessedUserID: 1, Wager: 3},
+				{GuesserID: 1, SongID: 11, GuessedUserID: 1, Wager: 2},
+			},
+		}
+		scores := party.WagerScorer{}.Score(in)
+
+		if got := scores.Total[2]; got != 3 {
+			t.Errorf("expected 3 points for a correct wager of 3, got %d", got)
+		}
+		if got := scores.Total[1]; got != -2 {
+			t.Errorf("expected -2 points for a wrong wager of 2, got %d", got)
+		}
+	})
+
+	t.Run("Unknown modes fall back to one point", func(t *testing.T) {
+		if _, ok := party.ScorerFor("nonsense").(party.OnePointScorer); !ok {
+			t.Error("expected OnePointScorer for unknown mode")
+		}
+		if _, ok := party.ScorerFor(party.ScoringSpeed).(party.SpeedScorer); !ok {
+			t.Error("expected SpeedScorer for speed mode")
+		}
+	})
+}
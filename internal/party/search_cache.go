@@ -0,0 +1,137 @@
+package party
+
+import (
+	"container/list"
+	"context"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Localized is implemented by music providers whose results depend on a
+// language or region.
+type Localized interface {
+	Locale() string
+}
+
+func (y *YouTubeMusic) Locale() string {
+	return y.Language + "-" + y.Region
+}
+
+// CachedMusicProvider caches search results of another MusicProvider. The
+// least recently used results are evicted once the cache is full, and results
+// expire after a while so new releases show up. Concurrent identical searches
+// share a single request to the provider, which is given up after a timeout.
+type CachedMusicProvider struct {
+	MusicProvider
+	size    int
+	ttl     time.Duration
+	timeout time.Duration
+	now     func() time.Time
+
+	mu       sync.Mutex
+	entries  map[string]*list.Element
+	order    *list.List // Most recently used at the front.
+	inflight map[string]*searchCall
+}
+
+type cacheEntry struct {
+	key     string
+	songs   []SongInput
+	expires time.Time
+}
+
+type searchCall struct {
+	done  chan struct{}
+	songs []SongInput
+	err   error
+}
+
+// searchTimeout is how long a shared search may take. Without it a hung
+// search would block every later search for the same query.
+const searchTimeout = 15 * time.Second
+
+// NewCachedMusicProvider caches up to size searches for ttl each.
+func NewCachedMusicProvider(p MusicProvider, size int, ttl time.Duration) *CachedMusicProvider {
+	return &CachedMusicProvider{
+		MusicProvider: p,
+		size:          size,
+		ttl:           ttl,
+		timeout:       searchTimeout,
+		now:           time.Now,
+		entries:       make(map[string]*list.Element),
+		order:         list.New(),
+		inflight:      make(map[string]*searchCall),
+	}
+}
+
+// normalizeQuery makes searches differing only in case or spacing share a
+// cache entry.
+func normalizeQuery(query string) string {
+	return strings.Join(strings.Fields(strings.ToLower(query)), " ")
+}
+
+func (c *CachedMusicProvider) Search(ctx context.Context, query string) ([]SongInput, error) {
+	query = normalizeQuery(query)
+	key := query
+	if l, ok := c.MusicProvider.(Localized); ok {
+		key = l.Locale() + "|" + query
+	}
+
+	c.mu.Lock()
+	if el, ok := c.entries[key]; ok {
+		entry := el.Value.(*cacheEntry)
+		if c.now().Before(entry.expires) {
+			c.order.MoveToFront(el)
+			c.mu.Unlock()
+			return entry.songs, nil
+		}
+		c.order.Remove(el)
+		delete(c.entries, key)
+	}
+	if call, ok := c.inflight[key]; ok {
+		c.mu.Unlock()
+		select {
+		case <-call.done:
+			return call.songs, call.err
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	call := &searchCall{done: make(chan struct{})}
+	c.inflight[key] = call
+	c.mu.Unlock()
+
+	// The search is shared, so it must not be cancelled with the first caller
+	searchCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), c.timeout)
+	call.songs, call.err = c.MusicProvider.Search(searchCtx, query)
+	cancel()
+
+	c.mu.Lock()
+	delete(c.inflight, key)
+	if call.err == nil {
+		c.add(key, call.songs)
+	}
+	c.mu.Unlock()
+	close(call.done)
+
+	return call.songs, call.err
+}
+
+// add stores a search result, evicting the least recently used one if the
+// cache is full. c.mu must be held.
+func (c *CachedMusicProvider) add(key string, songs []SongInput) {
+	c.entries[key] = c.order.PushFront(&cacheEntry{key: key, songs: songs, expires: c.now().Add(c.ttl)})
+	for c.order.Len() > c.size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*cacheEntry).key)
+	}
+}
+
+// Len returns the number of cached searches.
+func (c *CachedMusicProvider) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.order.Len()
+}
@@ -0,0 +1,165 @@
+package party_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/jehaj/new-year-wrapped/internal/party"
+)
+
+// countingProvider counts searches and can hold them until released or
+// cancelled.
+type countingProvider struct {
+	*party.FakeCatalog
+	locale   string
+	searches atomic.Int32
+	release  chan struct{}
+}
+
+func (p *countingProvider) Search(ctx context.Context, query string) ([]party.SongInput, error) {
+	p.searches.Add(1)
+	if p.release != nil {
+		select {
+		case <-p.release:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	return p.FakeCatalog.Search(ctx, query)
+}
+
+func (p *countingProvider) Locale() string { return p.locale }
+
+func TestCachedMusicProvider(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2025, 12, 31, 23, 0, 0, 0, time.UTC)
+
+	newCache := func(size int) (*party.CachedMusicProvider, *countingProvider) {
+		p := &countingProvider{FakeCatalog: party.DefaultFakeCatalog(), locale: "da-DK"}
+		c := party.NewCachedMusicProvider(p, size, time.Minute)
+		c.SetClock(func() time.Time { return now })
+		return c, p
+	}
+
+	t.Run("Normalized queries share an entry", func(t *testing.T) {
+		// Given: A search that is cached
+		// When: The same query is searched with other case and spacing
+		// Then: The provider is only asked once
+		c, p := newCache(10)
+		first, _ := c.Search(ctx, "Bruno Mars")
+		second, _ := c.Search(ctx, "  bruno   MARS ")
+		if n := p.searches.Load(); n != 1 {
+			t.Errorf("expected 1 search, got %d", n)
+		}
+		if len(first) != 2 || len(second) != 2 {
+			t.Errorf("expected 2 results both times, got %d and %d", len(first), len(second))
+		}
+	})
+
+	t.Run("Locales are cached separately", func(t *testing.T) {
+		c, p := newCache(10)
+		c.Search(ctx, "bruno")
+		p.locale = "en-US"
+		c.Search(ctx, "bruno")
+		if n := p.searches.Load(); n != 2 {
+			t.Errorf("expected 2 searches, got %d", n)
+		}
+	})
+
+	t.Run("Entries expire", func(t *testing.T) {
+		c, p := newCache(10)
+		c.Search(ctx, "bruno")
+		now = now.Add(2 * time.Minute)
+		c.Search(ctx, "bruno")
+		if n := p.searches.Load(); n != 2 {
+			t.Errorf("expected 2 searches after expiry, got %d", n)
+		}
+	})
+
+	t.Run("Least recently used entries are evicted", func(t *testing.T) {
+		c, p := newCache(2)
+		c.Search(ctx, "a")
+		c.Search(ctx, "b")
+		c.Search(ctx, "a")
+		c.Search(ctx, "c") // Evicts "b"
+		c.Search(ctx, "a")
+		if n := p.searches.Load(); n != 3 {
+			t.Errorf("expected 3 searches, got %d", n)
+		}
+		c.Search(ctx, "b")
+		if n := p.searches.Load(); n != 4 {
+			t.Errorf("expected evicted entry to be searched again, got %d searches", n)
+		}
+		if c.Len() != 2 {
+			t.Errorf("expected 2 cached entries, got %d", c.Len())
+		}
+	})
+
+	t.Run("Concurrent identical searches are coalesced", func(t *testing.T) {
+		// Given: A slow provider
+		// When: Many clients search for the same query at once
+		// Then: The provider is asked once and everyone gets the result
+		c, p := newCache(10)
+		p.release = make(chan struct{})
+
+		var wg sync.WaitGroup
+		results := make([]int, 10)
+		for i := range results {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				songs, _ := c.Search(ctx, "bruno")
+				results[i] = len(songs)
+			}()
+		}
+		for p.searches.Load() == 0 {
+			time.Sleep(time.Millisecond)
+		}
+		time.Sleep(10 * time.Millisecond)
+		close(p.release)
+		wg.Wait()
+
+		if n := p.searches.Load(); n != 1 {
+			t.Errorf("expected 1 search, got %d", n)
+		}
+		for i, n := range results {
+			if n != 2 {
+				t.Errorf("client %d got %d results, expected 2", i, n)
+			}
+		}
+	})
+
+	t.Run("Hung searches time out", func(t *testing.T) {
+		// Given: A provider that never answers
+		// When: A query is searched twice
+		// Then: Both searches give up after the timeout instead of blocking
+		// on the shared call, and the failure is not cached
+		c, p := newCache(10)
+		c.SetTimeout(10 * time.Millisecond)
+		p.release = make(chan struct{})
+		defer close(p.release)
+
+		for range 2 {
+			done := make(chan error, 1)
+			go func() {
+				_, err := c.Search(ctx, "bruno")
+				done <- err
+			}()
+			select {
+			case err := <-done:
+				if !errors.Is(err, context.DeadlineExceeded) {
+					t.Errorf("expected the search to time out, got %v", err)
+				}
+			case <-time.After(time.Second):
+				t.Fatal("expected the search to give up")
+			}
+		}
+		if n := p.searches.Load(); n != 2 {
+			t.Errorf("expected 2 searches, got %d", n)
+		}
+	})
+}
@@ -0,0 +1,161 @@
+package party
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	sessionCookiePrefix = "session_"
+	sessionMaxAge       = 7 * 24 * time.Hour
+)
+
+// newSessionToken returns a random secret that identifies a player's browser.
+func newSessionToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// hashToken returns the value stored in the database for a secret token, so
+// a leaked database does not leak usable credentials.
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// ClaimSession issues a session token for an existing player who does not have
+// one yet. It exists so old "?user=" links keep working exactly once.
+func (s *Service) ClaimSession(ctx context.Context, partyID string, userName string) (userID int, token string, err error) {
+	token, err = newSessionToken()
+	if err != nil {
+		return 0, "", err
+	}
+
+	res, err := s.db.ExecContext(ctx, "UPDATE users SET session_hash = ? WHERE party_id = ? AND name = ? AND session_hash = ''", hashToken(token), partyID, userName)
+	if err != nil {
+		return 0, "", err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return 0, "", err
+	}
+	if n == 0 {
+		return 0, "", newError(CodeSessionClaimFailed, userName)
+	}
+
+	s.log(partyID, "User %s claimed a session", userName)
+	err = s.db.QueryRowContext(ctx, "SELECT id FROM users WHERE party_id = ? AND name = ?", partyID, userName).Scan(&userID)
+	return userID, token, err
+}
+
+// UserBySession returns the player identified by a session token.
+func (s *Service) UserBySession(ctx context.Context, partyID string, userID int, token string) (User, error) {
+	var u User
+	var storedHash string
+	err := s.db.QueryRowContext(ctx, "SELECT id, name, session_hash FROM users WHERE id = ? AND party_id = ?", userID, partyID).Scan(&u.ID, &u.Name, &storedHash)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return User{}, newError(CodeInvalidSession)
+		}
+		return User{}, err
+	}
+	if storedHash == "" || subtle.ConstantTimeCompare([]byte(storedHash), []byte(hashToken(token))) != 1 {
+		return User{}, newError(CodeInvalidSession)
+	}
+	return u, nil
+}
+
+// SetSessionKey sets the key used to sign session cookies. Cookies signed with
+// a previous key stop being accepted.
+func (h *Handler) SetSessionKey(key []byte) {
+	h.sessionKey = key
+}
+
+// SessionCookie builds the signed cookie that identifies a player in a party.
+func (h *Handler) SessionCookie(partyID string, userID int, token string) *http.Cookie {
+	value := strconv.Itoa(userID) + "." + token
+	return &http.Cookie{
+		Name:     sessionCookiePrefix + partyID,
+		Value:    value + "." + h.signSession(partyID, value),
+		Path:     "/",
+		MaxAge:   int(sessionMaxAge.Seconds()),
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	}
+}
+
+func (h *Handler) signSession(partyID, value string) string {
+	mac := hmac.New(sha256.New, h.sessionKey)
+	mac.Write([]byte(partyID + "|" + value))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func (h *Handler) setSession(w http.ResponseWriter, r *http.Request, partyID string, userID int, token string) {
+	cookie := h.SessionCookie(partyID, userID, token)
+	cookie.Secure = r.TLS != nil
+	http.SetCookie(w, cookie)
+}
+
+// currentUser resolves the player making the request from their session
+// cookie for the given party.
+func (h *Handler) currentUser(r *http.Request, partyID string) (User, bool) {
+	cookie, err := r.Cookie(sessionCookiePrefix + partyID)
+	if err != nil {
+		return User{}, false
+	}
+
+	parts := strings.Split(cookie.Value, ".")
+	if len(parts) != 3 {
+		return User{}, false
+	}
+	value := parts[0] + "." + parts[1]
+	if !hmac.Equal([]byte(parts[2]), []byte(h.signSession(partyID, value))) {
+		return User{}, false
+	}
+
+	userID, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return User{}, false
+	}
+	user, err := h.service.UserBySession(r.Context(), partyID, userID, parts[1])
+	if err != nil {
+		return User{}, false
+	}
+	return user, true
+}
+
+// claimLegacySession lets an old "?user=" link log a player in once. If the
+// player has no session yet, one is issued. Either way the request is
+// redirected to the same page without the user parameter.
+func (h *Handler) claimLegacySession(w http.ResponseWriter, r *http.Request, partyID string) bool {
+	userName := r.URL.Query().Get("user")
+	if userName == "" {
+		return false
+	}
+
+	if _, ok := h.currentUser(r, partyID); !ok {
+		if userID, token, err := h.service.ClaimSession(r.Context(), partyID, userName); err == nil {
+			h.setSession(w, r, partyID, userID, token)
+		}
+	}
+
+	q := r.URL.Query()
+	q.Del("user")
+	u := *r.URL
+	u.RawQuery = q.Encode()
+	http.Redirect(w, r, u.RequestURI(), http.StatusSeeOther)
+	return true
+}
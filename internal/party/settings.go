@@ -0,0 +1,306 @@
+package party
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+
+	"github.com/jehaj/new-year-wrapped/internal/i18n"
+)
+
+// Scoring modes a party can be played with.
+const (
+	ScoringStandard = "standard" // One point per correct guess.
+	ScoringSpeed    = "speed"    // Faster correct guesses earn more points.
+	ScoringWager    = "wager"    // Guesses win or lose the points wagered on them.
+)
+
+// ScoringModes lists the scoring modes in the order they are offered to admins.
+var ScoringModes = []string{ScoringStandard, ScoringSpeed, ScoringWager}
+
+// How teammates' guesses on the same song are settled in team mode.
+const (
+	TeamGuessFirst = "first" // The first guess of the team counts.
+	TeamGuessLast  = "last"  // A later guess replaces the team's guess.
+)
+
+// TeamGuessPolicies lists the team guess policies in the order they are
+// offered to admins.
+var TeamGuessPolicies = []string{TeamGuessFirst, TeamGuessLast}
+
+// Points for a correct guess in speed mode. The points start at
+// SpeedMaxPoints when the round opens and drop by one every
+// SpeedDecaySeconds, but never below SpeedMinPoints.
+const (
+	SpeedMaxPoints    = 10
+	SpeedMinPoints    = 1
+	SpeedDecaySeconds = 10
+)
+
+// Wagers in wager mode. Each player has a budget of points to wager per
+// round, set by the admin.
+const (
+	MinWager           = 1
+	MaxWager           = 3
+	DefaultWagerBudget = 10
+	MaxWagerBudget     = MaxWager * MaxSongsPerRound
+)
+
+// Limits on the remaining party settings.
+const (
+	DefaultSongsPerRound = 5
+	MinSongsPerRound     = 1
+	MaxSongsPerRound     = 50
+	MaxRoundTimeLimit    = 600
+)
+
+// Settings configure how a party is played. They can only be changed before
+// the competition starts.
+type Settings struct {
+	SongsPerRound  int    `json:"songs_per_round"`
+	SongsPerPlayer int    `json:"songs_per_player"`
+	ScoringMode    string `json:"scoring_mode"`
+	RoundTimeLimit int    `json:"round_time_limit"` // In seconds, 0 means no limit.
+	AllowLateJoin  bool   `json:"allow_late_join"`
+	// AllowGuessChanges lets players change a guess until the round is
+	// revealed. Otherwise a guess is final, except for the team's guess with
+	// TeamGuessLast.
+	AllowGuessChanges bool `json:"allow_guess_changes"`
+	// TeamMode makes players guess as teams, with one guess per team per song.
+	TeamMode        bool   `json:"team_mode"`
+	TeamGuessPolicy string `json:"team_guess_policy"`
+	WagerBudget     int    `json:"wager_budget"` // Points each player may wager per round in wager mode.
+	// Language is the language shown to players who have not picked one.
+	// Empty follows each player's browser.
+	Language string `json:"language"`
+}
+
+// SettingsUpdate holds the settings to change. Nil fields are left unchanged.
+type SettingsUpdate struct {
+	SongsPerRound     *int    `json:"songs_per_round"`
+	SongsPerPlayer    *int    `json:"songs_per_player"`
+	ScoringMode       *string `json:"scoring_mode"`
+	RoundTimeLimit    *int    `json:"round_time_limit"`
+	AllowLateJoin     *bool   `json:"allow_late_join"`
+	AllowGuessChanges *bool   `json:"allow_guess_changes"`
+	TeamMode          *bool   `json:"team_mode"`
+	TeamGuessPolicy   *string `json:"team_guess_policy"`
+	WagerBudget       *int    `json:"wager_budget"`
+	Language          *string `json:"language"`
+}
+
+// Validate reports the first setting that is out of range.
+func (s Settings) Validate() error {
+	if s.SongsPerRound < MinSongsPerRound || s.SongsPerRound > MaxSongsPerRound {
+		return newError(CodeSongsPerRoundRange, MinSongsPerRound, MaxSongsPerRound, s.SongsPerRound)
+	}
+	if s.SongsPerPlayer < MinSongsPerPlayer || s.SongsPerPlayer > MaxSongsPerPlayer {
+		return newError(CodeSongsPerPlayerRange, MinSongsPerPlayer, MaxSongsPerPlayer, s.SongsPerPlayer)
+	}
+	if !slices.Contains(ScoringModes, s.ScoringMode) {
+		return newError(CodeUnknownScoringMode, s.ScoringMode)
+	}
+	if s.RoundTimeLimit < 0 || s.RoundTimeLimit > MaxRoundTimeLimit {
+		return newError(CodeRoundTimeLimitRange, MaxRoundTimeLimit, s.RoundTimeLimit)
+	}
+	if !slices.Contains(TeamGuessPolicies, s.TeamGuessPolicy) {
+		return newError(CodeUnknownTeamPolicy, s.TeamGuessPolicy)
+	}
+	if s.WagerBudget < MinWager || s.WagerBudget > MaxWagerBudget {
+		return newError(CodeWagerBudgetRange, MinWager, MaxWagerBudget, s.WagerBudget)
+	}
+	if s.Language != "" && !i18n.Supported(s.Language) {
+		return newError(CodeUnknownLanguage, s.Language)
+	}
+	return nil
+}
+
+func (s Settings) apply(u SettingsUpdate) Settings {
+	if u.SongsPerRound != nil {
+		s.SongsPerRound = *u.SongsPerRound
+	}
+	if u.SongsPerPlayer != nil {
+		s.SongsPerPlayer = *u.SongsPerPlayer
+	}
+	if u.ScoringMode != nil {
+		s.ScoringMode = *u.ScoringMode
+	}
+	if u.RoundTimeLimit != nil {
+		s.RoundTimeLimit = *u.RoundTimeLimit
+	}
+	if u.AllowLateJoin != nil {
+		s.AllowLateJoin = *u.AllowLateJoin
+	}
+	if u.AllowGuessChanges != nil {
+		s.AllowGuessChanges = *u.AllowGuessChanges
+	}
+	if u.TeamMode != nil {
+		s.TeamMode = *u.TeamMode
+	}
+	if u.TeamGuessPolicy != nil {
+		s.TeamGuessPolicy = *u.TeamGuessPolicy
+	}
+	if u.WagerBudget != nil {
+		s.WagerBudget = *u.WagerBudget
+	}
+	if u.Language != nil {
+		s.Language = *u.Language
+	}
+	return s
+}
+
+type queryRower interface {
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+func getSettings(ctx context.Context, q queryRower, partyID string) (Settings, error) {
+	var st Settings
+	err := q.QueryRowContext(ctx, `
+		SELECT songs_per_round, songs_per_player, scoring_mode, round_time_limit, allow_late_join, allow_guess_changes, team_mode, team_guess_policy, wager_budget, language
+		FROM parties WHERE id = ?`, partyID).Scan(&st.SongsPerRound, &st.SongsPerPlayer, &st.ScoringMode, &st.RoundTimeLimit, &st.AllowLateJoin, &st.AllowGuessChanges, &st.TeamMode, &st.TeamGuessPolicy, &st.WagerBudget, &st.Language)
+	if err == sql.ErrNoRows {
+		return st, newError(CodePartyNotFound, partyID)
+	}
+	return st, err
+}
+
+// GetSettings returns the settings of a party.
+func (s *Service) GetSettings(ctx context.Context, partyID string) (Settings, error) {
+	return getSettings(ctx, s.db, partyID)
+}
+
+// GetPartyLanguage returns the language the admin picked for a party, or an
+// empty string if players see their own language.
+func (s *Service) GetPartyLanguage(ctx context.Context, partyID string) (string, error) {
+	var language string
+	err := s.db.QueryRowContext(ctx, "SELECT language FROM parties WHERE id = ?", partyID).Scan(&language)
+	return language, err
+}
+
+// UpdateSettings changes the settings of a party that has not started yet and
+// returns the resulting settings. The number of songs per player is fixed once
+// someone has joined.
+func (s *Service) UpdateSettings(ctx context.Context, partyID string, update SettingsUpdate) (Settings, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return Settings{}, err
+	}
+	defer tx.Rollback()
+
+	current, err := getSettings(ctx, tx, partyID)
+	if err != nil {
+		return Settings{}, err
+	}
+
+	var started bool
+	var userCount int
+	err = tx.QueryRowContext(ctx, "SELECT started, (SELECT COUNT(*) FROM users WHERE party_id = parties.id) FROM parties WHERE id = ?", partyID).Scan(&started, &userCount)
+	if err != nil {
+		return Settings{}, err
+	}
+	if started {
+		return Settings{}, newError(CodePartyStarted, partyID)
+	}
+
+	updated := current.apply(update)
+	if err := updated.Validate(); err != nil {
+		return Settings{}, err
+	}
+	if updated.SongsPerPlayer != current.SongsPerPlayer && userCount > 0 {
+		return Settings{}, newError(CodeSongsPerPlayerLocked)
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		UPDATE parties
+		SET songs_per_round = ?, songs_per_player = ?, scoring_mode = ?, round_time_limit = ?, allow_late_join = ?,
+			allow_guess_changes = ?, team_mode = ?, team_guess_policy = ?, wager_budget = ?, language = ?
+		WHERE id = ?`, updated.SongsPerRound, updated.SongsPerPlayer, updated.ScoringMode, updated.RoundTimeLimit, updated.AllowLateJoin,
+		updated.AllowGuessChanges, updated.TeamMode, updated.TeamGuessPolicy, updated.WagerBudget, updated.Language, partyID)
+	if err != nil {
+		return Settings{}, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return Settings{}, err
+	}
+
+	s.log(partyID, "Updated settings: %+v", updated)
+	return updated, nil
+}
+
+func (h *Handler) GetSettings(w http.ResponseWriter, r *http.Request) {
+	partyID := h.getPartyID(r)
+	settings, err := h.service.GetSettings(r.Context(), partyID)
+	if err != nil {
+		h.writeError(w, r, err)
+		return
+	}
+
+	json.NewEncoder(w).Encode(settings)
+}
+
+func (h *Handler) UpdateSettings(w http.ResponseWriter, r *http.Request) {
+	partyID := h.getPartyID(r)
+	var update SettingsUpdate
+	if err := json.NewDecoder(r.Body).Decode(&update); err != nil {
+		h.writeError(w, r, newError(CodeInvalidRequest, err))
+		return
+	}
+
+	settings, err := h.service.UpdateSettings(r.Context(), partyID, update)
+	if err != nil {
+		h.writeError(w, r, err)
+		return
+	}
+
+	json.NewEncoder(w).Encode(settings)
+}
+
+func (h *Handler) UIUpdateSettings(w http.ResponseWriter, r *http.Request) {
+	partyID := h.getPartyID(r)
+	adminToken := r.FormValue("admin_token")
+
+	isAdmin, _ := h.service.VerifyAdmin(r.Context(), partyID, adminToken)
+	if !isAdmin {
+		h.uiError(w, r, newError(CodeNotAdmin))
+		return
+	}
+
+	songsPerRound, err1 := strconv.Atoi(r.FormValue("songs_per_round"))
+	songsPerPlayer, err2 := strconv.Atoi(r.FormValue("songs_per_player"))
+	roundTimeLimit, err3 := strconv.Atoi(r.FormValue("round_time_limit"))
+	wagerBudget, err4 := strconv.Atoi(r.FormValue("wager_budget"))
+	if err1 != nil || err2 != nil || err3 != nil || err4 != nil {
+		h.uiError(w, r, newError(CodeInvalidSettings))
+		return
+	}
+	scoringMode := r.FormValue("scoring_mode")
+	allowLateJoin := r.FormValue("allow_late_join") != ""
+	allowGuessChanges := r.FormValue("allow_guess_changes") != ""
+	teamMode := r.FormValue("team_mode") != ""
+	teamGuessPolicy := r.FormValue("team_guess_policy")
+	language := r.FormValue("language")
+
+	update := SettingsUpdate{
+		SongsPerRound:     &songsPerRound,
+		SongsPerPlayer:    &songsPerPlayer,
+		ScoringMode:       &scoringMode,
+		RoundTimeLimit:    &roundTimeLimit,
+		AllowLateJoin:     &allowLateJoin,
+		AllowGuessChanges: &allowGuessChanges,
+		TeamMode:          &teamMode,
+		TeamGuessPolicy:   &teamGuessPolicy,
+		WagerBudget:       &wagerBudget,
+		Language:          &language,
+	}
+	if _, err := h.service.UpdateSettings(r.Context(), partyID, update); err != nil {
+		h.uiError(w, r, err)
+		return
+	}
+
+	http.Redirect(w, r, fmt.Sprintf("/parties/%s?admin_token=%s", partyID, adminToken), http.StatusSeeOther)
+}
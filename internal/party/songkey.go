@@ -0,0 +1,203 @@
+package party
+
+import (
+	"context"
+	"database/sql"
+	"regexp"
+	"slices"
+	"strings"
+	"unicode"
+)
+
+// Songs typed by hand rarely match letter for letter, so each song gets a
+// key at join time that is shared with any earlier song in the party it
+// appears to be the same as. Scoring and reveals group owners by this key.
+
+var (
+	// noiseBrackets matches bracketed parts that don't tell songs apart, like
+	// "(feat. X)" or "[Official Video]".
+	noiseBrackets = regexp.MustCompile(`[(\[][^)\]]*\b(feat|ft|featuring|with|prod|official|lyrics?|audio|remaster(ed)?)\b[^)\]]*[)\]]`)
+	// featuring matches an unbracketed "feat. X" up to the next " - ".
+	featuring = regexp.MustCompile(`\b(feat|ft|featuring)\b\.?[^-]*`)
+)
+
+// songStopWords are left out of song keys.
+var songStopWords = map[string]bool{"a": true, "an": true, "the": true, "and": true, "og": true}
+
+// titleSeparator splits titles like "Title - Artist" into their parts.
+var titleSeparator = regexp.MustCompile(`\s+[-–—|]\s+`)
+
+// songTitle is a title broken into words.
+type songTitle struct {
+	tokens   []string   // Distinct words in sorted order.
+	segments [][]string // Words of each part separated by " - ".
+}
+
+// parseSongTitle normalizes a title. Sorting the words makes "Artist - Title"
+// and "Title - Artist" equal.
+func parseSongTitle(title string) songTitle {
+	title = strings.ToLower(title)
+	title = noiseBrackets.ReplaceAllString(title, " ")
+	title = featuring.ReplaceAllString(title, " ")
+	title = strings.NewReplacer("'", "", "’", "").Replace(title)
+
+	var t songTitle
+	for _, part := range titleSeparator.Split(title, -1) {
+		words := strings.FieldsFunc(part, func(r rune) bool {
+			return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+		})
+		var segment []string
+		for _, w := range words {
+			if !songStopWords[w] {
+				segment = append(segment, w)
+			}
+		}
+		if len(segment) > 0 {
+			t.segments = append(t.segments, segment)
+			t.tokens = append(t.tokens, segment...)
+		}
+	}
+	slices.Sort(t.tokens)
+	t.tokens = slices.Compact(t.tokens)
+	return t
+}
+
+// songKey is the normalized form of a title.
+func songKey(title string) string {
+	return strings.Join(parseSongTitle(title).tokens, " ")
+}
+
+// similarSongs reports whether two titles look like the same song. Every word
+// of the shorter title must appear in the longer one, allowing for typos. A
+// shorter title must also make up more than half of the longer and mention
+// each of its parts, so an artist name alone doesn't match all their songs.
+func similarSongs(a, b songTitle) bool {
+	if len(a.tokens) > len(b.tokens) {
+		a, b = b, a
+	}
+	if len(a.tokens) == 0 || !containsWords(b.tokens, a.tokens) {
+		return false
+	}
+	if len(a.tokens) == len(b.tokens) {
+		return true
+	}
+	if len(a.tokens) < 2 || len(a.tokens)*2 <= len(b.tokens) {
+		return false
+	}
+	for _, segment := range b.segments {
+		if !slices.ContainsFunc(segment, func(y string) bool { return containsWords(a.tokens, []string{y}) }) {
+			return false
+		}
+	}
+	return true
+}
+
+// containsWords reports whether every word in words is similar to one in
+// list.
+func containsWords(list, words []string) bool {
+	for _, x := range words {
+		if !slices.ContainsFunc(list, func(y string) bool { return similarWords(x, y) }) {
+			return false
+		}
+	}
+	return true
+}
+
+// similarWords allows one typo in words of six letters or more and two in
+// words of ten or more.
+func similarWords(x, y string) bool {
+	if x == y {
+		return true
+	}
+	n := min(len([]rune(x)), len([]rune(y)))
+	switch {
+	case n >= 10:
+		return levenshtein(x, y) <= 2
+	case n >= 6:
+		return levenshtein(x, y) <= 1
+	default:
+		return false
+	}
+}
+
+// levenshtein returns the edit distance between two strings.
+func levenshtein(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	prev := make([]int, len(rb)+1)
+	curr := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		curr[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			curr[j] = min(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+		}
+		prev, curr = curr, prev
+	}
+	return prev[len(rb)]
+}
+
+// assignSongKey returns the key for a new song in a party: the key of an
+// earlier song with the same YouTube ID or a similar title, or else the
+// song's own normalized title. Earlier songs from before keys were assigned
+// get theirs on the way.
+func assignSongKey(ctx context.Context, tx *sql.Tx, partyID string, song SongInput) (string, error) {
+	rows, err := tx.QueryContext(ctx, `
+		SELECT s.id, s.title, s.youtube_id, s.song_key
+		FROM songs s
+		JOIN users u ON s.user_id = u.id
+		WHERE u.party_id = ?
+		ORDER BY s.id ASC`, partyID)
+	if err != nil {
+		return "", err
+	}
+
+	type existingSong struct {
+		id                    int
+		title, youtubeID, key string
+	}
+	var existing []existingSong
+	for rows.Next() {
+		var e existingSong
+		if err := rows.Scan(&e.id, &e.title, &e.youtubeID, &e.key); err != nil {
+			rows.Close()
+			return "", err
+		}
+		existing = append(existing, e)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return "", err
+	}
+
+	title := parseSongTitle(song.Title)
+	for _, e := range existing {
+		sameID := song.YouTubeID != "" && e.youtubeID == song.YouTubeID
+		if !sameID && !similarSongs(title, parseSongTitle(e.title)) {
+			continue
+		}
+		if e.key == "" {
+			// Songs sharing its YouTube ID were grouped with it before, so
+			// they get the key too
+			e.key = songKey(e.title)
+			_, err := tx.ExecContext(ctx, `
+				UPDATE songs SET song_key = ?
+				WHERE id = ? OR (song_key = '' AND youtube_id != '' AND youtube_id = ?
+					AND user_id IN (SELECT id FROM users WHERE party_id = ?))`,
+				e.key, e.id, e.youtubeID, partyID)
+			if err != nil {
+				return "", err
+			}
+		}
+		return e.key, nil
+	}
+
+	// Titles without letters or digits get an empty key and only match
+	// themselves
+	return strings.Join(title.tokens, " "), nil
+}
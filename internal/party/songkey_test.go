@@ -0,0 +1,116 @@
+package party_test
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+
+	"github.com/jehaj/new-year-wrapped/internal/db"
+	"github.com/jehaj/new-year-wrapped/internal/party"
+)
+
+func TestSongKey(t *testing.T) {
+	tests := []struct {
+		title, want string
+	}{
+		{"Espresso - Sabrina Carpenter", "carpenter espresso sabrina"},
+		{"  ESPRESSO!!  sabrina   carpenter ", "carpenter espresso sabrina"},
+		{"Die With A Smile (feat. Bruno Mars) - Lady Gaga", "die gaga lady smile with"},
+		{"Good Luck, Babe! ft. Someone - Chappell Roan", "babe chappell good luck roan"},
+		{"Don't Stop Me Now [Official Video]", "dont me now stop"},
+		{"?!", ""},
+	}
+	for _, tt := range tests {
+		if got := party.SongKey(tt.title); got != tt.want {
+			t.Errorf("SongKey(%q) = %q, want %q", tt.title, got, tt.want)
+		}
+	}
+}
+
+func TestSimilarTitles(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want bool
+	}{
+		{"Espresso - Sabrina Carpenter", "espresso sabrina", true},
+		{"Espresso - Sabrina Carpenter", "Sabrina Carpenter - Espresso", true},
+		{"Espresso - Sabrina Carpenter", "Expresso - Sabrina Carpenter", true},
+		{"Espresso (feat. Nobody) - Sabrina Carpenter", "Espresso - Sabrina Carpenter", true},
+		{"Espresso - Sabrina Carpenter", "Please Please Please - Sabrina Carpenter", false},
+		{"Espresso - Sabrina Carpenter", "Sabrina Carpenter", false},
+		{"Love Story - Taylor Swift", "Taylor Swift", false},
+		{"Espresso", "Espresso - Sabrina Carpenter", false},
+		{"Hello", "Hallo", false},
+		{"", "", false},
+	}
+	for _, tt := range tests {
+		if got := party.SimilarTitles(tt.a, tt.b); got != tt.want {
+			t.Errorf("SimilarTitles(%q, %q) = %v, want %v", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
+
+func TestFuzzyDuplicateSongs(t *testing.T) {
+	database, _ := sql.Open("sqlite3", ":memory:")
+	defer database.Close()
+	_, _ = db.Migrate(database)
+
+	service := party.NewService(database, nil)
+	ctx := context.Background()
+	partyID, _, _ := service.CreateParty(ctx, "Fuzzy Party", 1)
+
+	// Given: One picked song and two typed variants of it, plus a different song
+	aliceID, _, _ := service.JoinParty(ctx, partyID, "Alice", []party.SongInput{{Title: "Espresso - Sabrina Carpenter", YouTubeID: "yt-espresso"}})
+	_, _, _ = service.JoinParty(ctx, partyID, "Bob", []party.SongInput{{Title: "espresso sabrina"}})
+	charlieID, _, _ := service.JoinParty(ctx, partyID, "Charlie", []party.SongInput{{Title: "Sabrina Carpenter - Expresso"}})
+	_, _, _ = service.JoinParty(ctx, partyID, "Dave", []party.SongInput{{Title: "Taste - Sabrina Carpenter"}})
+
+	t.Run("Variants share their owners", func(t *testing.T) {
+		// When: The songs are listed
+		// Then: The three variants list all three owners, the other song only Dave
+		songs, err := service.GetPartySongs(ctx, partyID)
+		if err != nil {
+			t.Fatalf("GetPartySongs failed: %v", err)
+		}
+		for _, s := range songs {
+			want := "Alice, Bob, Charlie"
+			if s.Title == "Taste - Sabrina Carpenter" {
+				want = "Dave"
+			}
+			if s.OwnerName != want {
+				t.Errorf("expected owners %q for %q, got %q", want, s.Title, s.OwnerName)
+			}
+		}
+	})
+
+	t.Run("Guessing any owner of a variant scores", func(t *testing.T) {
+		// When: Dave guesses Alice on Charlie's typed variant
+		// Then: The guess is correct
+		service.StartCompetition(ctx, partyID)
+		var charlieSong int
+		database.QueryRow("SELECT id FROM songs WHERE user_id = ?", charlieID).Scan(&charlieSong)
+		var daveID int
+		database.QueryRow("SELECT id FROM users WHERE name = 'Dave'").Scan(&daveID)
+		if err := service.SubmitGuess(ctx, daveID, charlieSong, aliceID); err != nil {
+			t.Fatalf("SubmitGuess failed: %v", err)
+		}
+		service.NextRound(ctx, partyID)
+
+		leaderboard, err := service.GetLeaderboard(ctx, partyID, 0)
+		if err != nil {
+			t.Fatalf("GetLeaderboard failed: %v", err)
+		}
+		found := false
+		for _, e := range leaderboard {
+			if e.UserName == "Dave" {
+				found = true
+				if e.Score != 1 {
+					t.Errorf("expected 1 point for Dave, got %d", e.Score)
+				}
+			}
+		}
+		if !found {
+			t.Error("Dave not found in leaderboard")
+		}
+	})
+}
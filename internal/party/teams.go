@@ -0,0 +1,476 @@
+package party
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// In team mode the admin sets up teams in the lobby and players pick one.
+// Players still guess on their own devices, but each team has a single guess
+// per song. Points are earned by the player who made the guess and add up to
+// the team's score.
+
+// Team is a group of players in a party.
+type Team struct {
+	ID      int    `json:"id"`
+	Name    string `json:"name"`
+	Members []User `json:"members"`
+}
+
+// TeamLeaderboardEntry is the score of a team.
+type TeamLeaderboardEntry struct {
+	TeamName string   `json:"team_name"`
+	Score    int      `json:"score"`
+	Members  []string `json:"members"`
+}
+
+// checkNotStarted returns an error if the party doesn't exist or has started.
+func checkNotStarted(ctx context.Context, q queryRower, partyID string) error {
+	var started bool
+	err := q.QueryRowContext(ctx, "SELECT started FROM parties WHERE id = ?", partyID).Scan(&started)
+	if err == sql.ErrNoRows {
+		return newError(CodePartyNotFound, partyID)
+	}
+	if err != nil {
+		return err
+	}
+	if started {
+		return newError(CodePartyStarted, partyID)
+	}
+	return nil
+}
+
+// CreateTeam adds a team to a party that has not started yet.
+func (s *Service) CreateTeam(ctx context.Context, partyID string, name string) (Team, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return Team{}, newError(CodeTeamNameMissing)
+	}
+	if err := checkNotStarted(ctx, s.db, partyID); err != nil {
+		return Team{}, err
+	}
+
+	res, err := s.db.ExecContext(ctx, `
+		INSERT INTO teams (party_id, name) VALUES (?, ?)
+		ON CONFLICT(party_id, name) DO NOTHING`, partyID, name)
+	if err != nil {
+		return Team{}, err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return Team{}, err
+	} else if n == 0 {
+		return Team{}, newError(CodeTeamNameTaken, name)
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return Team{}, err
+	}
+
+	s.log(partyID, "Created team: %s", name)
+	s.publish(partyID, EventTeams, nil)
+	return Team{ID: int(id), Name: name, Members: []User{}}, nil
+}
+
+// DeleteTeam removes a team from a party that has not started yet. Its
+// members are left without a team.
+func (s *Service) DeleteTeam(ctx context.Context, partyID string, teamID int) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := checkNotStarted(ctx, tx, partyID); err != nil {
+		return err
+	}
+	res, err := tx.ExecContext(ctx, "DELETE FROM teams WHERE id = ? AND party_id = ?", teamID, partyID)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return newError(CodeTeamNotFound, teamID)
+	}
+	if _, err := tx.ExecContext(ctx, "UPDATE users SET team_id = 0 WHERE team_id = ? AND party_id = ?", teamID, partyID); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	s.log(partyID, "Deleted team %d", teamID)
+	s.publish(partyID, EventTeams, nil)
+	return nil
+}
+
+// SetUserTeam moves a player to a team before the party starts. A teamID of
+// 0 leaves the player without a team.
+func (s *Service) SetUserTeam(ctx context.Context, partyID string, userID, teamID int) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := checkNotStarted(ctx, tx, partyID); err != nil {
+		return err
+	}
+	if teamID != 0 {
+		var exists bool
+		err := tx.QueryRowContext(ctx, "SELECT EXISTS(SELECT 1 FROM teams WHERE id = ? AND party_id = ?)", teamID, partyID).Scan(&exists)
+		if err != nil {
+			return err
+		}
+		if !exists {
+			return newError(CodeTeamNotFound, teamID)
+		}
+	}
+	res, err := tx.ExecContext(ctx, "UPDATE users SET team_id = ? WHERE id = ? AND party_id = ?", teamID, userID, partyID)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return newError(CodeUserNotFound, userID)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	s.log(partyID, "User %d joined team %d", userID, teamID)
+	s.publish(partyID, EventTeams, nil)
+	return nil
+}
+
+// GetTeams returns the teams of a party in the order they were created, with
+// their members sorted by name.
+func (s *Service) GetTeams(ctx context.Context, partyID string) ([]Team, error) {
+	if err := checkPartyExists(ctx, s.db, partyID); err != nil {
+		return nil, err
+	}
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT t.id, t.name, u.id, u.name
+		FROM teams t
+		LEFT JOIN users u ON u.team_id = t.id AND u.party_id = t.party_id
+		WHERE t.party_id = ?
+		ORDER BY t.id ASC, u.name ASC`, partyID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	teams := []Team{}
+	for rows.Next() {
+		var team Team
+		var userID sql.NullInt64
+		var userName sql.NullString
+		if err := rows.Scan(&team.ID, &team.Name, &userID, &userName); err != nil {
+			return nil, err
+		}
+		if len(teams) == 0 || teams[len(teams)-1].ID != team.ID {
+			team.Members = []User{}
+			teams = append(teams, team)
+		}
+		if userID.Valid {
+			last := &teams[len(teams)-1]
+			last.Members = append(last.Members, User{ID: int(userID.Int64), Name: userName.String})
+		}
+	}
+	return teams, rows.Err()
+}
+
+// GetUserTeam returns the ID of a player's team, or 0 if they have none.
+func (s *Service) GetUserTeam(ctx context.Context, userID int) (int, error) {
+	var teamID int
+	err := s.db.QueryRowContext(ctx, "SELECT team_id FROM users WHERE id = ?", userID).Scan(&teamID)
+	return teamID, err
+}
+
+// assignTeams puts every player without a team on the team with the fewest
+// members. It fails if the party has no teams.
+func assignTeams(ctx context.Context, tx *sql.Tx, partyID string) error {
+	rows, err := tx.QueryContext(ctx, `
+		SELECT t.id, (SELECT COUNT(*) FROM users u WHERE u.team_id = t.id AND u.party_id = t.party_id)
+		FROM teams t
+		WHERE t.party_id = ?
+		ORDER BY t.id ASC`, partyID)
+	if err != nil {
+		return err
+	}
+	type teamSize struct{ id, members int }
+	var teams []teamSize
+	for rows.Next() {
+		var t teamSize
+		if err := rows.Scan(&t.id, &t.members); err != nil {
+			rows.Close()
+			return err
+		}
+		teams = append(teams, t)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	if len(teams) == 0 {
+		return newError(CodeNoTeams)
+	}
+
+	var unassigned []int
+	rows, err = tx.QueryContext(ctx, "SELECT id FROM users WHERE party_id = ? AND team_id = 0 ORDER BY id ASC", partyID)
+	if err != nil {
+		return err
+	}
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return err
+		}
+		unassigned = append(unassigned, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, userID := range unassigned {
+		smallest := 0
+		for i, t := range teams {
+			if t.members < teams[smallest].members {
+				smallest = i
+			}
+		}
+		if _, err := tx.ExecContext(ctx, "UPDATE users SET team_id = ? WHERE id = ?", teams[smallest].id, userID); err != nil {
+			return err
+		}
+		teams[smallest].members++
+	}
+	return nil
+}
+
+// submitTeamGuess stores a guess on behalf of a team. With TeamGuessFirst
+// the guess is rejected if the team already guessed on the song; with
+// TeamGuessLast it replaces the team's guess.
+func submitTeamGuess(ctx context.Context, tx *sql.Tx, teamID int, policy string, guesserID, songID, guessedUserID, wager int, at int64) error {
+	if policy == TeamGuessLast {
+		_, err := tx.ExecContext(ctx, `
+			DELETE FROM guesses
+			WHERE song_id = ? AND guesser_id != ? AND guesser_id IN (SELECT id FROM users WHERE team_id = ?)`,
+			songID, guesserID, teamID)
+		if err != nil {
+			return err
+		}
+		_, err = tx.ExecContext(ctx, `
+			INSERT INTO guesses (guesser_id, song_id, guessed_user_id, created_at, wager)
+			VALUES (?, ?, ?, ?, ?)
+			ON CONFLICT(guesser_id, song_id) DO UPDATE SET guessed_user_id = excluded.guessed_user_id, created_at = excluded.created_at, wager = excluded.wager`,
+			guesserID, songID, guessedUserID, at, wager)
+		return err
+	}
+
+	res, err := tx.ExecContext(ctx, `
+		INSERT INTO guesses (guesser_id, song_id, guessed_user_id, created_at, wager)
+		SELECT ?, ?, ?, ?, ?
+		WHERE NOT EXISTS (
+			SELECT 1 FROM guesses g
+			JOIN users u ON g.guesser_id = u.id
+			WHERE g.song_id = ? AND u.team_id = ?
+		)`, guesserID, songID, guessedUserID, at, wager, songID, teamID)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return newError(CodeTeamAlreadyGuessed)
+	}
+	return nil
+}
+
+// GetTeamLeaderboard adds up the leaderboard of GetLeaderboard per team.
+// Players without a team are left out.
+func (s *Service) GetTeamLeaderboard(ctx context.Context, partyID string, round int) ([]TeamLeaderboardEntry, error) {
+	_, points, err := s.leaderboardPoints(ctx, partyID, round)
+	if err != nil {
+		return nil, err
+	}
+	teams, err := s.GetTeams(ctx, partyID)
+	if err != nil {
+		return nil, err
+	}
+
+	entries := make([]TeamLeaderboardEntry, len(teams))
+	for i, t := range teams {
+		entries[i] = TeamLeaderboardEntry{TeamName: t.Name, Members: []string{}}
+		for _, m := range t.Members {
+			entries[i].Score += points[m.ID]
+			entries[i].Members = append(entries[i].Members, m.Name)
+		}
+	}
+	// Teams are in creation order, which breaks ties
+	sort.SliceStable(entries, func(i, j int) bool { return entries[i].Score > entries[j].Score })
+	return entries, nil
+}
+
+func (h *Handler) GetTeams(w http.ResponseWriter, r *http.Request) {
+	teams, err := h.service.GetTeams(r.Context(), h.getPartyID(r))
+	if err != nil {
+		h.writeError(w, r, err)
+		return
+	}
+	json.NewEncoder(w).Encode(teams)
+}
+
+func (h *Handler) CreateTeam(w http.ResponseWriter, r *http.Request) {
+	partyID := h.getPartyID(r)
+	var req struct {
+		Name string `json:"name"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.writeError(w, r, newError(CodeInvalidRequest, err))
+		return
+	}
+
+	team, err := h.service.CreateTeam(r.Context(), partyID, req.Name)
+	if err != nil {
+		h.writeError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(team)
+}
+
+func (h *Handler) DeleteTeam(w http.ResponseWriter, r *http.Request) {
+	partyID := h.getPartyID(r)
+	teamID, err := strconv.Atoi(r.PathValue("team"))
+	if err != nil {
+		h.writeError(w, r, newError(CodeInvalidTeam))
+		return
+	}
+	if err := h.service.DeleteTeam(r.Context(), partyID, teamID); err != nil {
+		h.writeError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// JoinTeam moves the player of the session to the team in the request body.
+func (h *Handler) JoinTeam(w http.ResponseWriter, r *http.Request) {
+	partyID := h.getPartyID(r)
+	user, ok := h.currentUser(r, partyID)
+	if !ok {
+		h.writeError(w, r, newError(CodeNoSession))
+		return
+	}
+
+	var req struct {
+		TeamID int `json:"team_id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.writeError(w, r, newError(CodeInvalidRequest, err))
+		return
+	}
+
+	if err := h.service.SetUserTeam(r.Context(), partyID, user.ID, req.TeamID); err != nil {
+		h.writeError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+func (h *Handler) GetTeamLeaderboard(w http.ResponseWriter, r *http.Request) {
+	partyID := h.getPartyID(r)
+	round := 0
+	if roundStr := r.URL.Query().Get("round"); roundStr != "" {
+		var err error
+		round, err = strconv.Atoi(roundStr)
+		if err != nil {
+			h.writeError(w, r, newError(CodeInvalidRound))
+			return
+		}
+	}
+
+	leaderboard, err := h.service.GetTeamLeaderboard(r.Context(), partyID, round)
+	if err != nil {
+		h.writeError(w, r, err)
+		return
+	}
+
+	json.NewEncoder(w).Encode(leaderboard)
+}
+
+func (h *Handler) UICreateTeam(w http.ResponseWriter, r *http.Request) {
+	partyID := h.getPartyID(r)
+	adminToken := r.FormValue("admin_token")
+
+	isAdmin, _ := h.service.VerifyAdmin(r.Context(), partyID, adminToken)
+	if !isAdmin {
+		h.uiError(w, r, newError(CodeNotAdmin))
+		return
+	}
+
+	if _, err := h.service.CreateTeam(r.Context(), partyID, r.FormValue("team_name")); err != nil {
+		h.uiError(w, r, err)
+		return
+	}
+	http.Redirect(w, r, fmt.Sprintf("/parties/%s?admin_token=%s", partyID, adminToken), http.StatusSeeOther)
+}
+
+func (h *Handler) UIDeleteTeam(w http.ResponseWriter, r *http.Request) {
+	partyID := h.getPartyID(r)
+	adminToken := r.FormValue("admin_token")
+
+	isAdmin, _ := h.service.VerifyAdmin(r.Context(), partyID, adminToken)
+	if !isAdmin {
+		h.uiError(w, r, newError(CodeNotAdmin))
+		return
+	}
+
+	teamID, err := strconv.Atoi(r.PathValue("team"))
+	if err != nil {
+		h.uiError(w, r, newError(CodeInvalidTeam))
+		return
+	}
+	if err := h.service.DeleteTeam(r.Context(), partyID, teamID); err != nil {
+		h.uiError(w, r, err)
+		return
+	}
+	http.Redirect(w, r, fmt.Sprintf("/parties/%s?admin_token=%s", partyID, adminToken), http.StatusSeeOther)
+}
+
+func (h *Handler) UIJoinTeam(w http.ResponseWriter, r *http.Request) {
+	partyID := h.getPartyID(r)
+	adminToken := r.FormValue("admin_token")
+
+	user, ok := h.currentUser(r, partyID)
+	if !ok {
+		http.Redirect(w, r, fmt.Sprintf("/parties/%s?admin_token=%s", partyID, adminToken), http.StatusSeeOther)
+		return
+	}
+
+	teamID, err := strconv.Atoi(r.FormValue("team_id"))
+	if err != nil {
+		h.uiError(w, r, newError(CodeInvalidTeam))
+		return
+	}
+	if err := h.service.SetUserTeam(r.Context(), partyID, user.ID, teamID); err != nil {
+		h.uiError(w, r, err)
+		return
+	}
+	http.Redirect(w, r, fmt.Sprintf("/parties/%s?admin_token=%s", partyID, adminToken), http.StatusSeeOther)
+}
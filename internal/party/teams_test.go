@@ -0,0 +1,214 @@
+package party_test
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+
+	"github.com/jehaj/new-year-wrapped/internal/db"
+	"github.com/jehaj/new-year-wrapped/internal/party"
+)
+
+// setupTeamParty creates a party in team mode with the given guess policy,
+// two teams and four players with one song each. Alice and Bob pick the Red
+// team; Charlie and Dana are assigned one when the competition starts.
+func setupTeamParty(t *testing.T, policy string) (*party.Service, string, map[string]int) {
+	t.Helper()
+	database, _ := sql.Open("sqlite3", ":memory:")
+	t.Cleanup(func() { database.Close() })
+	_, _ = db.Migrate(database)
+
+	service := party.NewService(database, nil)
+	ctx := context.Background()
+	partyID, _, _ := service.CreateParty(ctx, "Team Party", 1)
+	teamMode := true
+	songsPerRound := 4
+	if _, err := service.UpdateSettings(ctx, partyID, party.SettingsUpdate{TeamMode: &teamMode, TeamGuessPolicy: &policy, SongsPerRound: &songsPerRound}); err != nil {
+		t.Fatalf("UpdateSettings failed: %v", err)
+	}
+	red, _ := service.CreateTeam(ctx, partyID, "Red")
+	service.CreateTeam(ctx, partyID, "Blue")
+
+	userIDs := make(map[string]int)
+	for _, name := range []string{"Alice", "Bob", "Charlie", "Dana"} {
+		id, _, err := service.JoinParty(ctx, partyID, name, []party.SongInput{{Title: name + "'s Song"}})
+		if err != nil {
+			t.Fatalf("JoinParty failed: %v", err)
+		}
+		userIDs[name] = id
+	}
+	service.SetUserTeam(ctx, partyID, userIDs["Alice"], red.ID)
+	service.SetUserTeam(ctx, partyID, userIDs["Bob"], red.ID)
+
+	if err := service.StartCompetition(ctx, partyID); err != nil {
+		t.Fatalf("StartCompetition failed: %v", err)
+	}
+	return service, partyID, userIDs
+}
+
+func TestTeams(t *testing.T) {
+	database, _ := sql.Open("sqlite3", ":memory:")
+	defer database.Close()
+	_, _ = db.Migrate(database)
+
+	service := party.NewService(database, nil)
+	ctx := context.Background()
+	partyID, _, _ := service.CreateParty(ctx, "Team Party", 1)
+
+	t.Run("Team names are unique", func(t *testing.T) {
+		if _, err := service.CreateTeam(ctx, partyID, "Red"); err != nil {
+			t.Fatalf("CreateTeam failed: %v", err)
+		}
+		if _, err := service.CreateTeam(ctx, partyID, " Red "); err == nil {
+			t.Error("expected error for duplicate team name, got nil")
+		}
+		if _, err := service.CreateTeam(ctx, partyID, ""); err == nil {
+			t.Error("expected error for empty team name, got nil")
+		}
+	})
+
+	t.Run("Starting without teams fails in team mode", func(t *testing.T) {
+		// Given: A party in team mode where the only team was deleted
+		// When: The competition is started
+		// Then: An error is returned
+		teams, _ := service.GetTeams(ctx, partyID)
+		for _, team := range teams {
+			service.DeleteTeam(ctx, partyID, team.ID)
+		}
+		teamMode := true
+		service.UpdateSettings(ctx, partyID, party.SettingsUpdate{TeamMode: &teamMode})
+		service.JoinParty(ctx, partyID, "Alice", []party.SongInput{{Title: "Song"}})
+
+		if err := service.StartCompetition(ctx, partyID); err == nil {
+			t.Error("expected error when starting without teams, got nil")
+		}
+	})
+
+	t.Run("Unknown team", func(t *testing.T) {
+		users, _ := service.GetUsers(ctx, partyID)
+		if err := service.SetUserTeam(ctx, partyID, users[0].ID, 999); err == nil {
+			t.Error("expected error for unknown team, got nil")
+		}
+	})
+}
+
+func TestTeamAssignment(t *testing.T) {
+	service, partyID, userIDs := setupTeamParty(t, party.TeamGuessFirst)
+	ctx := context.Background()
+
+	// Given: Alice and Bob picked Red before the start
+	// When: The competition starts
+	// Then: Charlie and Dana are put on Blue, the smaller team
+	teams, err := service.GetTeams(ctx, partyID)
+	if err != nil {
+		t.Fatalf("GetTeams failed: %v", err)
+	}
+	if len(teams) != 2 || len(teams[0].Members) != 2 || len(teams[1].Members) != 2 {
+		t.Fatalf("expected two teams of two, got %+v", teams)
+	}
+	if teams[1].Members[0].Name != "Charlie" || teams[1].Members[1].Name != "Dana" {
+		t.Errorf("expected Charlie and Dana on Blue, got %+v", teams[1].Members)
+	}
+
+	t.Run("Teams are fixed after the start", func(t *testing.T) {
+		if err := service.SetUserTeam(ctx, partyID, userIDs["Charlie"], teams[0].ID); err == nil {
+			t.Error("expected error when changing team after the start, got nil")
+		}
+	})
+}
+
+func TestTeamGuessing(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("First guess wins", func(t *testing.T) {
+		// Given: A team party where the first guess of a team counts
+		// When: Alice guesses on a song and Bob guesses on it after her
+		// Then: Bob's guess is rejected and the team keeps Alice's guess
+		service, partyID, userIDs := setupTeamParty(t, party.TeamGuessFirst)
+		songs, _ := service.GetRoundSongs(ctx, partyID, 1)
+		danaSong := songByTitle(t, songs, "Dana's Song")
+
+		if err := service.SubmitGuess(ctx, userIDs["Alice"], danaSong, userIDs["Dana"]); err != nil {
+			t.Fatalf("SubmitGuess failed: %v", err)
+		}
+		if err := service.SubmitGuess(ctx, userIDs["Bob"], danaSong, userIDs["Charlie"]); err == nil {
+			t.Error("expected error for second team guess, got nil")
+		}
+		guesses, _ := service.GetUserGuesses(ctx, partyID, "Bob")
+		if guesses[danaSong] != "Dana" {
+			t.Errorf("expected Bob to see the team's guess Dana, got %q", guesses[danaSong])
+		}
+	})
+
+	t.Run("Last guess wins", func(t *testing.T) {
+		// Given: A team party where the latest guess of a team counts
+		// When: Alice guesses wrong and Bob corrects it
+		// Then: The team has Bob's guess only
+		service, partyID, userIDs := setupTeamParty(t, party.TeamGuessLast)
+		songs, _ := service.GetRoundSongs(ctx, partyID, 1)
+		danaSong := songByTitle(t, songs, "Dana's Song")
+
+		service.SubmitGuess(ctx, userIDs["Alice"], danaSong, userIDs["Charlie"])
+		if err := service.SubmitGuess(ctx, userIDs["Bob"], danaSong, userIDs["Dana"]); err != nil {
+			t.Fatalf("SubmitGuess failed: %v", err)
+		}
+		guesses, _ := service.GetUserGuesses(ctx, partyID, "Alice")
+		if len(guesses) != 1 || guesses[danaSong] != "Dana" {
+			t.Errorf("expected the team's only guess to be Dana, got %v", guesses)
+		}
+
+		service.NextRound(ctx, partyID)
+		individual, _ := service.GetLeaderboard(ctx, partyID, 0)
+		if individual[0].UserName != "Bob" || individual[0].Score != 1 {
+			t.Errorf("expected Bob to earn the point, got %+v", individual)
+		}
+	})
+}
+
+func TestTeamLeaderboard(t *testing.T) {
+	service, partyID, userIDs := setupTeamParty(t, party.TeamGuessFirst)
+	ctx := context.Background()
+	songs, _ := service.GetRoundSongs(ctx, partyID, 1)
+
+	// Red guesses two songs right, Blue one
+	service.SubmitGuess(ctx, userIDs["Alice"], songByTitle(t, songs, "Charlie's Song"), userIDs["Charlie"])
+	service.SubmitGuess(ctx, userIDs["Bob"], songByTitle(t, songs, "Dana's Song"), userIDs["Dana"])
+	service.SubmitGuess(ctx, userIDs["Charlie"], songByTitle(t, songs, "Alice's Song"), userIDs["Alice"])
+	service.SubmitGuess(ctx, userIDs["Dana"], songByTitle(t, songs, "Bob's Song"), userIDs["Charlie"])
+
+	t.Run("Hidden until revealed", func(t *testing.T) {
+		leaderboard, _ := service.GetTeamLeaderboard(ctx, partyID, 0)
+		if len(leaderboard) != 2 || leaderboard[0].Score != 0 || leaderboard[1].Score != 0 {
+			t.Errorf("expected no points before the reveal, got %+v", leaderboard)
+		}
+	})
+
+	service.NextRound(ctx, partyID)
+
+	t.Run("Team scores add up", func(t *testing.T) {
+		// Given: A revealed round with Red on two correct guesses and Blue on one
+		// When: The team leaderboard is fetched
+		// Then: Red leads with 2 points before Blue with 1
+		leaderboard, err := service.GetTeamLeaderboard(ctx, partyID, 0)
+		if err != nil {
+			t.Fatalf("GetTeamLeaderboard failed: %v", err)
+		}
+		if len(leaderboard) != 2 || leaderboard[0].TeamName != "Red" || leaderboard[0].Score != 2 || leaderboard[1].Score != 1 {
+			t.Errorf("unexpected team leaderboard %+v", leaderboard)
+		}
+		if len(leaderboard[0].Members) != 2 {
+			t.Errorf("expected Red to have 2 members, got %v", leaderboard[0].Members)
+		}
+	})
+}
+
+func songByTitle(t *testing.T, songs []party.Song, title string) int {
+	t.Helper()
+	for _, s := range songs {
+		if s.Title == title {
+			return s.ID
+		}
+	}
+	t.Fatalf("song %q not found in %+v", title, songs)
+	return 0
+}
@@ -0,0 +1,165 @@
+package party
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+)
+
+// Players can change the songs they joined with until the competition
+// starts, e.g. to pick another version of a song.
+
+// GetUserSongs returns the songs a player submitted, in the order they were
+// submitted.
+func (s *Service) GetUserSongs(ctx context.Context, partyID string, userID int) ([]Song, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT s.id, s.title, s.youtube_id, s.thumbnail_url
+		FROM songs s
+		JOIN users u ON s.user_id = u.id
+		WHERE u.id = ? AND u.party_id = ?
+		ORDER BY s.id ASC`, userID, partyID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	songs := []Song{}
+	for rows.Next() {
+		var song Song
+		if err := rows.Scan(&song.ID, &song.Title, &song.YouTubeID, &song.ThumbnailURL); err != nil {
+			return nil, err
+		}
+		songs = append(songs, song)
+	}
+	return songs, rows.Err()
+}
+
+// UpdateUserSongs replaces all songs of a player in a party that has not
+// started yet. The songs keep their IDs and are replaced in the order they
+// were submitted, all or none of them.
+func (s *Service) UpdateUserSongs(ctx context.Context, partyID string, userID int, songs []SongInput) ([]Song, error) {
+	songs = slices.Clone(songs)
+	if err := s.prepareSongs(ctx, songs); err != nil {
+		return nil, err
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	if err := checkNotStarted(ctx, tx, partyID); err != nil {
+		return nil, err
+	}
+	rows, err := tx.QueryContext(ctx, `
+		SELECT s.id
+		FROM songs s
+		JOIN users u ON s.user_id = u.id
+		WHERE u.id = ? AND u.party_id = ?
+		ORDER BY s.id ASC`, userID, partyID)
+	if err != nil {
+		return nil, err
+	}
+	var songIDs []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		songIDs = append(songIDs, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(songIDs) == 0 {
+		return nil, newError(CodeUserNotFound, userID)
+	}
+	if len(songs) != len(songIDs) {
+		return nil, newError(CodeSongCount, len(songIDs), len(songs))
+	}
+
+	updated := make([]Song, len(songs))
+	for i, song := range songs {
+		if err := replaceSong(ctx, tx, partyID, songIDs[i], song); err != nil {
+			return nil, err
+		}
+		updated[i] = Song{ID: songIDs[i], Title: song.Title, YouTubeID: song.YouTubeID, ThumbnailURL: song.ThumbnailURL}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	s.log(partyID, "User %d changed their songs", userID)
+	s.publish(partyID, EventPlayers, nil)
+	return updated, nil
+}
+
+// GetMySongs returns the songs of the player of the session.
+func (h *Handler) GetMySongs(w http.ResponseWriter, r *http.Request) {
+	partyID := h.getPartyID(r)
+	user, ok := h.currentUser(r, partyID)
+	if !ok {
+		h.writeError(w, r, newError(CodeNoSession))
+		return
+	}
+
+	songs, err := h.service.GetUserSongs(r.Context(), partyID, user.ID)
+	if err != nil {
+		h.writeError(w, r, err)
+		return
+	}
+	json.NewEncoder(w).Encode(songs)
+}
+
+// UpdateMySongs replaces the songs of the player of the session.
+func (h *Handler) UpdateMySongs(w http.ResponseWriter, r *http.Request) {
+	partyID := h.getPartyID(r)
+	user, ok := h.currentUser(r, partyID)
+	if !ok {
+		h.writeError(w, r, newError(CodeNoSession))
+		return
+	}
+
+	var req struct {
+		Songs []SongInput `json:"songs"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.writeError(w, r, newError(CodeInvalidRequest, err))
+		return
+	}
+
+	songs, err := h.service.UpdateUserSongs(r.Context(), partyID, user.ID, req.Songs)
+	if err != nil {
+		h.writeError(w, r, err)
+		return
+	}
+	json.NewEncoder(w).Encode(songs)
+}
+
+func (h *Handler) UIUpdateMySongs(w http.ResponseWriter, r *http.Request) {
+	partyID := h.getPartyID(r)
+	adminToken := r.FormValue("admin_token")
+
+	user, ok := h.currentUser(r, partyID)
+	if !ok {
+		http.Redirect(w, r, fmt.Sprintf("/parties/%s?admin_token=%s", partyID, adminToken), http.StatusSeeOther)
+		return
+	}
+
+	songs, err := h.service.GetUserSongs(r.Context(), partyID, user.ID)
+	if err != nil {
+		h.uiError(w, r, err)
+		return
+	}
+	if _, err := h.service.UpdateUserSongs(r.Context(), partyID, user.ID, songsFromForm(r, len(songs))); err != nil {
+		h.uiError(w, r, err)
+		return
+	}
+	http.Redirect(w, r, fmt.Sprintf("/parties/%s?admin_token=%s", partyID, adminToken), http.StatusSeeOther)
+}
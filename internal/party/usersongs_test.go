@@ -0,0 +1,68 @@
+package party_test
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+
+	"github.com/jehaj/new-year-wrapped/internal/db"
+	"github.com/jehaj/new-year-wrapped/internal/party"
+)
+
+func TestUserSongs(t *testing.T) {
+	database, _ := sql.Open("sqlite3", ":memory:")
+	defer database.Close()
+	_, _ = db.Migrate(database)
+
+	service := party.NewService(database, nil)
+	ctx := context.Background()
+	partyID, _, _ := service.CreateParty(ctx, "Lobby Party", 2)
+	aliceID, _, _ := service.JoinParty(ctx, partyID, "Alice", []party.SongInput{{Title: "Espresso"}, {Title: "Taste"}})
+	bobID, _, _ := service.JoinParty(ctx, partyID, "Bob", []party.SongInput{{Title: "Birds of a Feather"}, {Title: "Lunch"}})
+
+	t.Run("Change my songs", func(t *testing.T) {
+		// Given: Alice joined with Espresso and Taste
+		// When: She swaps Taste for another song
+		// Then: Her songs keep their IDs and order with the new title
+		before, err := service.GetUserSongs(ctx, partyID, aliceID)
+		if err != nil {
+			t.Fatalf("GetUserSongs failed: %v", err)
+		}
+		songs, err := service.UpdateUserSongs(ctx, partyID, aliceID, []party.SongInput{{Title: "Espresso"}, {Title: "Please Please Please"}})
+		if err != nil {
+			t.Fatalf("UpdateUserSongs failed: %v", err)
+		}
+		after, _ := service.GetUserSongs(ctx, partyID, aliceID)
+		if len(after) != 2 || after[0].ID != before[0].ID || after[1].ID != before[1].ID {
+			t.Fatalf("expected the song IDs to be kept, got %+v", after)
+		}
+		if after[1].Title != "Please Please Please" || songs[1].Title != after[1].Title {
+			t.Errorf("unexpected songs %+v", after)
+		}
+	})
+
+	t.Run("All songs are replaced or none", func(t *testing.T) {
+		// Given: Bob's two songs
+		// When: He sends one song, or two where one has no title
+		// Then: Both changes are rejected and his songs are untouched
+		if _, err := service.UpdateUserSongs(ctx, partyID, bobID, []party.SongInput{{Title: "Guess"}}); err == nil {
+			t.Error("expected error for the wrong number of songs")
+		}
+		if _, err := service.UpdateUserSongs(ctx, partyID, bobID, []party.SongInput{{Title: "Guess"}, {Title: " "}}); err == nil {
+			t.Error("expected error for a song without a title")
+		}
+		songs, _ := service.GetUserSongs(ctx, partyID, bobID)
+		if songs[0].Title != "Birds of a Feather" || songs[1].Title != "Lunch" {
+			t.Errorf("expected Bob's songs to be unchanged, got %+v", songs)
+		}
+	})
+
+	t.Run("Songs are locked after the start", func(t *testing.T) {
+		if err := service.StartCompetition(ctx, partyID); err != nil {
+			t.Fatalf("StartCompetition failed: %v", err)
+		}
+		if _, err := service.UpdateUserSongs(ctx, partyID, bobID, []party.SongInput{{Title: "Guess"}, {Title: "360"}}); err == nil {
+			t.Error("expected error when changing songs after the start")
+		}
+	})
+}
@@ -0,0 +1,70 @@
+package party
+
+import (
+	"context"
+)
+
+// checkWager reports whether a wager on a song in a round fits in the
+// guesser's budget for the round. A wager replacing an earlier one on the same
+// song frees the earlier one.
+func checkWager(ctx context.Context, q queryRower, guesserID, songID, round, wager, songsPerRound, budget int) error {
+	if wager < MinWager || wager > MaxWager {
+		return newError(CodeWagerRange, MinWager, MaxWager, wager)
+	}
+
+	spent, err := spentWagers(ctx, q, guesserID, songID, round, songsPerRound)
+	if err != nil {
+		return err
+	}
+	if spent+wager > budget {
+		return newError(CodeWagerBudgetExceeded, max(0, budget-spent))
+	}
+	return nil
+}
+
+// spentWagers returns the sum of a player's wagers in a round, leaving out
+// the wager on exceptSongID.
+func spentWagers(ctx context.Context, q queryRower, guesserID, exceptSongID, round, songsPerRound int) (int, error) {
+	var spent int
+	err := q.QueryRowContext(ctx, `
+		SELECT COALESCE(SUM(g.wager), 0)
+		FROM guesses g
+		JOIN songs s ON g.song_id = s.id
+		WHERE g.guesser_id = ? AND g.song_id != ? AND s.shuffle_index BETWEEN ? AND ?`,
+		guesserID, exceptSongID, (round-1)*songsPerRound, round*songsPerRound-1).Scan(&spent)
+	return spent, err
+}
+
+// RemainingWagerBudget returns how many points a player has left to wager in
+// a round.
+func (s *Service) RemainingWagerBudget(ctx context.Context, partyID string, userID, round int) (int, error) {
+	settings, err := s.GetSettings(ctx, partyID)
+	if err != nil {
+		return 0, err
+	}
+	spent, err := spentWagers(ctx, s.db, userID, 0, round, settings.SongsPerRound)
+	if err != nil {
+		return 0, err
+	}
+	return max(0, settings.WagerBudget-spent), nil
+}
+
+// GetUserWagers returns the wager on each song a player guessed, like
+// GetUserGuesses.
+func (s *Service) GetUserWagers(ctx context.Context, partyID string, userName string) (map[int]int, error) {
+	rows, err := s.db.QueryContext(ctx, "SELECT g.song_id, g.wager"+userGuessesFrom, userName, partyID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	wagers := make(map[int]int)
+	for rows.Next() {
+		var songID, wager int
+		if err := rows.Scan(&songID, &wager); err != nil {
+			return nil, err
+		}
+		wagers[songID] = wager
+	}
+	return wagers, rows.Err()
+}
@@ -0,0 +1,101 @@
+package party_test
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+
+	"github.com/jehaj/new-year-wrapped/internal/db"
+	"github.com/jehaj/new-year-wrapped/internal/party"
+)
+
+func TestWagers(t *testing.T) {
+	database, _ := sql.Open("sqlite3", ":memory:")
+	defer database.Close()
+	_, _ = db.Migrate(database)
+
+	service := party.NewService(database, nil)
+	ctx := context.Background()
+	partyID, _, _ := service.CreateParty(ctx, "Wager Party", 1)
+	mode := party.ScoringWager
+	budget := 4
+	songsPerRound := 3
+	allowChanges := true
+	update := party.SettingsUpdate{ScoringMode: &mode, WagerBudget: &budget, SongsPerRound: &songsPerRound, AllowGuessChanges: &allowChanges}
+	if _, err := service.UpdateSettings(ctx, partyID, update); err != nil {
+		t.Fatalf("UpdateSettings failed: %v", err)
+	}
+
+	userIDs := make(map[string]int)
+	for _, name := range []string{"Alice", "Bob", "Charlie"} {
+		id, _, err := service.JoinParty(ctx, partyID, name, []party.SongInput{{Title: name + "'s Song"}})
+		if err != nil {
+			t.Fatalf("JoinParty failed: %v", err)
+		}
+		userIDs[name] = id
+	}
+	if err := service.StartCompetition(ctx, partyID); err != nil {
+		t.Fatalf("StartCompetition failed: %v", err)
+	}
+	songs, _ := service.GetRoundSongs(ctx, partyID, 1)
+	bobSong := songByTitle(t, songs, "Bob's Song")
+	charlieSong := songByTitle(t, songs, "Charlie's Song")
+
+	t.Run("Wagers must be in range", func(t *testing.T) {
+		for _, wager := range []int{0, party.MaxWager + 1} {
+			if err := service.SubmitGuessWithWager(ctx, userIDs["Alice"], bobSong, userIDs["Bob"], wager); err == nil {
+				t.Errorf("expected error for wager %d", wager)
+			}
+		}
+	})
+
+	t.Run("Wagers are limited by the round budget", func(t *testing.T) {
+		// Given: A budget of 4 points per round
+		// When: Alice wagers 3 on one song and then 2 on another
+		// Then: The second wager is rejected until the first is lowered
+		if err := service.SubmitGuessWithWager(ctx, userIDs["Alice"], bobSong, userIDs["Bob"], 3); err != nil {
+			t.Fatalf("SubmitGuessWithWager failed: %v", err)
+		}
+		if left, _ := service.RemainingWagerBudget(ctx, partyID, userIDs["Alice"], 1); left != 1 {
+			t.Errorf("expected 1 point left, got %d", left)
+		}
+		if err := service.SubmitGuessWithWager(ctx, userIDs["Alice"], charlieSong, userIDs["Bob"], 2); err == nil {
+			t.Error("expected error when overspending the budget")
+		}
+
+		// A new guess on the same song replaces the old wager
+		if err := service.SubmitGuessWithWager(ctx, userIDs["Alice"], bobSong, userIDs["Bob"], 2); err != nil {
+			t.Fatalf("SubmitGuessWithWager failed: %v", err)
+		}
+		if err := service.SubmitGuessWithWager(ctx, userIDs["Alice"], charlieSong, userIDs["Bob"], 2); err != nil {
+			t.Fatalf("expected wager to fit after lowering the first, got %v", err)
+		}
+		wagers, _ := service.GetUserWagers(ctx, partyID, "Alice")
+		if wagers[bobSong] != 2 || wagers[charlieSong] != 2 {
+			t.Errorf("unexpected wagers %v", wagers)
+		}
+	})
+
+	t.Run("Leaderboard subtracts wrong wagers", func(t *testing.T) {
+		// Given: Alice won 2 on Bob's song and lost 2 on Charlie's song
+		// When: Bob wagers 3 on a wrong guess and the round is revealed
+		// Then: Alice ends at 0 and Bob at -3
+		if err := service.SubmitGuessWithWager(ctx, userIDs["Bob"], charlieSong, userIDs["Alice"], 3); err != nil {
+			t.Fatalf("SubmitGuessWithWager failed: %v", err)
+		}
+		if err := service.NextRound(ctx, partyID); err != nil {
+			t.Fatalf("NextRound failed: %v", err)
+		}
+		leaderboard, err := service.GetLeaderboard(ctx, partyID, 1)
+		if err != nil {
+			t.Fatalf("GetLeaderboard failed: %v", err)
+		}
+		scores := make(map[string]int)
+		for _, e := range leaderboard {
+			scores[e.UserName] = e.Score
+		}
+		if scores["Alice"] != 0 || scores["Bob"] != -3 {
+			t.Errorf("unexpected scores %v", scores)
+		}
+	})
+}
@@ -0,0 +1,253 @@
+package party
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"maps"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Wrapped is a player's end-of-game summary.
+type Wrapped struct {
+	PartyID      string          `json:"party_id"`
+	PartyName    string          `json:"party_name"`
+	UserID       int             `json:"user_id"`
+	UserName     string          `json:"user_name"`
+	Rank         int             `json:"rank"`
+	Players      int             `json:"players"`
+	Score        int             `json:"score"`
+	Songs        []WrappedSong   `json:"songs"`
+	SongsGuessed int             `json:"songs_guessed"` // Songs at least one other player traced back to this player.
+	KnewYouBest  *FriendStat     `json:"knew_you_best,omitempty"`
+	YouKnewBest  *FriendStat     `json:"you_knew_best,omitempty"`
+	Rounds       []RoundAccuracy `json:"rounds"`
+}
+
+// WrappedSong is one of the player's own songs and who guessed it was theirs.
+type WrappedSong struct {
+	ID           int      `json:"id"`
+	Title        string   `json:"title"`
+	YouTubeID    string   `json:"youtube_id"`
+	ThumbnailURL string   `json:"thumbnail_url"`
+	GuessedBy    []string `json:"guessed_by"`
+}
+
+// FriendStat tells how many songs one player correctly attributed to another.
+type FriendStat struct {
+	UserName string `json:"user_name"`
+	Correct  int    `json:"correct"`
+	Songs    int    `json:"songs"` // Songs the player could have guessed.
+}
+
+// RoundAccuracy is how well a player guessed the other players' songs in a
+// round.
+type RoundAccuracy struct {
+	Round    int `json:"round"`
+	Songs    int `json:"songs"`
+	Guessed  int `json:"guessed"`
+	Correct  int `json:"correct"`
+	Accuracy int `json:"accuracy"` // Percentage of Songs guessed correctly.
+}
+
+// isGameOver reports whether every round of a started party has been
+// revealed.
+func (s *Service) isGameOver(ctx context.Context, partyID string) (bool, error) {
+	var started, showResults bool
+	var currentRound, songsPerRound, totalSongs int
+	err := s.db.QueryRowContext(ctx, `
+		SELECT started, current_round, show_results, songs_per_round,
+			(SELECT COUNT(*) FROM songs JOIN users ON songs.user_id = users.id WHERE users.party_id = parties.id)
+		FROM parties WHERE id = ?`, partyID).Scan(&started, &currentRound, &showResults, &songsPerRound, &totalSongs)
+	if err != nil {
+		return false, err
+	}
+	return started && !showResults && (currentRound-1)*songsPerRound >= totalSongs, nil
+}
+
+// GetWrapped returns a player's summary once the game is over.
+func (s *Service) GetWrapped(ctx context.Context, partyID string, userID int) (Wrapped, error) {
+	w := Wrapped{PartyID: partyID, UserID: userID}
+
+	var settings Settings
+	err := s.db.QueryRowContext(ctx, "SELECT name, songs_per_round, scoring_mode FROM parties WHERE id = ?", partyID).Scan(&w.PartyName, &settings.SongsPerRound, &settings.ScoringMode)
+	if err == sql.ErrNoRows {
+		return w, newError(CodePartyNotFound, partyID)
+	}
+	if err != nil {
+		return w, err
+	}
+
+	over, err := s.isGameOver(ctx, partyID)
+	if err != nil {
+		return w, err
+	}
+	if !over {
+		return w, newError(CodeGameNotOver)
+	}
+
+	in, err := s.scoringInput(ctx, partyID, settings.SongsPerRound)
+	if err != nil {
+		return w, err
+	}
+	names := make(map[int]string, len(in.Users))
+	for _, u := range in.Users {
+		names[u.ID] = u.Name
+	}
+	name, ok := names[userID]
+	if !ok {
+		return w, newError(CodeUserNotFound, userID)
+	}
+	w.UserName = name
+	w.Players = len(in.Users)
+
+	scores := ScorerFor(settings.ScoringMode).Score(in)
+	w.Score = scores.Total[userID]
+	w.Rank = 1
+	for _, points := range scores.Total {
+		if points > w.Score {
+			w.Rank++
+		}
+	}
+
+	songs, err := s.getPartySongs(ctx, partyID)
+	if err != nil {
+		return w, err
+	}
+	scoringSongs := make(map[int]ScoringSong, len(in.Songs))
+	for _, song := range in.Songs {
+		scoringSongs[song.ID] = song
+	}
+
+	// Own songs, and how many songs each other player owns
+	ownSongs := make(map[int]int) // Song ID → index in w.Songs.
+	songsOwnedBy := make(map[int]int)
+	for _, ps := range songs {
+		for _, owner := range scoringSongs[ps.ID].Owners {
+			songsOwnedBy[owner]++
+		}
+		if ps.UserID == userID {
+			ownSongs[ps.ID] = len(w.Songs)
+			w.Songs = append(w.Songs, WrappedSong{ID: ps.ID, Title: ps.Title, YouTubeID: ps.YouTubeID, ThumbnailURL: ps.ThumbnailURL, GuessedBy: []string{}})
+		}
+	}
+
+	knewYou := make(map[int]int)
+	youKnew := make(map[int]int)
+	rounds := make(map[int]*RoundAccuracy)
+	for _, song := range in.Songs {
+		if song.Round == 0 || slices.Contains(song.Owners, userID) {
+			continue
+		}
+		if rounds[song.Round] == nil {
+			rounds[song.Round] = &RoundAccuracy{Round: song.Round}
+		}
+		rounds[song.Round].Songs++
+	}
+
+	for _, g := range in.Guesses {
+		song := scoringSongs[g.SongID]
+		correct := slices.Contains(song.Owners, g.GuessedUserID)
+		switch {
+		case g.GuesserID == userID && !slices.Contains(song.Owners, userID):
+			if ra := rounds[song.Round]; ra != nil {
+				ra.Guessed++
+				if correct {
+					ra.Correct++
+				}
+			}
+			if correct {
+				youKnew[g.GuessedUserID]++
+			}
+		case g.GuesserID != userID && g.GuessedUserID == userID && correct:
+			knewYou[g.GuesserID]++
+			if i, own := ownSongs[g.SongID]; own {
+				w.Songs[i].GuessedBy = append(w.Songs[i].GuessedBy, names[g.GuesserID])
+			}
+		}
+	}
+
+	for _, song := range w.Songs {
+		slices.Sort(song.GuessedBy)
+		if len(song.GuessedBy) > 0 {
+			w.SongsGuessed++
+		}
+	}
+	w.KnewYouBest = bestFriend(in.Users, knewYou, func(int) int { return len(ownSongs) })
+	w.YouKnewBest = bestFriend(in.Users, youKnew, func(id int) int { return songsOwnedBy[id] })
+
+	w.Rounds = []RoundAccuracy{}
+	for _, r := range slices.Sorted(maps.Keys(rounds)) {
+		ra := rounds[r]
+		ra.Accuracy = ra.Correct * 100 / ra.Songs
+		w.Rounds = append(w.Rounds, *ra)
+	}
+	return w, nil
+}
+
+// bestFriend returns the player with the most correct guesses, preferring
+// the one who joined first on ties. It is nil if nobody guessed correctly.
+func bestFriend(users []User, correct map[int]int, songs func(userID int) int) *FriendStat {
+	var best *FriendStat
+	byID := slices.Clone(users)
+	slices.SortFunc(byID, func(a, b User) int { return a.ID - b.ID })
+	for _, u := range byID {
+		if n := correct[u.ID]; n > 0 && (best == nil || n > best.Correct) {
+			best = &FriendStat{UserName: u.Name, Correct: n, Songs: songs(u.ID)}
+		}
+	}
+	return best
+}
+
+// wantsJSON reports whether a page was requested as JSON, either with
+// ?format=json or an Accept header preferring it.
+func wantsJSON(r *http.Request) bool {
+	if r.URL.Query().Get("format") == "json" {
+		return true
+	}
+	return strings.HasPrefix(r.Header.Get("Accept"), "application/json")
+}
+
+// WrappedPage shows a player's end-of-game summary, as HTML or JSON.
+func (h *Handler) WrappedPage(w http.ResponseWriter, r *http.Request) {
+	writeError := h.uiError
+	if wantsJSON(r) {
+		writeError = h.writeError
+	}
+
+	partyID := h.getPartyID(r)
+	userID, err := strconv.Atoi(r.PathValue("user"))
+	if err != nil {
+		writeError(w, r, newError(CodeInvalidPlayer))
+		return
+	}
+
+	wrapped, err := h.service.GetWrapped(r.Context(), partyID, userID)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	if wantsJSON(r) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(wrapped)
+		return
+	}
+
+	if h.templates == nil {
+		http.Error(w, h.t(r, "error.templates_missing"), http.StatusInternalServerError)
+		return
+	}
+	data := map[string]interface{}{
+		"Party": map[string]string{
+			"ID":   partyID,
+			"Name": wrapped.PartyName,
+		},
+		"IsWrapped": true,
+		"Wrapped":   wrapped,
+	}
+	h.render(w, r, data)
+}